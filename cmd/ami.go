@@ -0,0 +1,142 @@
+/*
+Copyright © 2021 Nik Ogura <nik@orionlabs.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/orion-labs/ops/pkg/ops"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+// amiCmd represents the ami command
+var amiCmd = &cobra.Command{
+	Use:   "ami",
+	Short: "Works with the Orion PTT System base AMI's.",
+	Long: `
+Works with the Orion PTT System base AMI's.
+`,
+}
+
+// amiListCmd represents the ami list command
+var amiListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the base AMI's matching ami_name.",
+	Long: `
+Lists the base AMI's matching ami_name, newest first, with their creation date, architecture and description.
+
+The image 'create' would use is marked with a '*'.  That's ami_id if it's pinned, and otherwise the newest match whose architecture suits instance_type.  e.g. Graviton instance types like m6g need arm64 images.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		if config.AMIName == "" {
+			config.AMIName = ops.DEFAULT_AMI_NAME
+		}
+
+		s, err := ops.NewStack(config, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		images, err := s.DescribeAmis(config.AMIName, "")
+		if err != nil {
+			log.Fatalf("Failed listing AMI's: %s", err)
+		}
+
+		if len(images) == 0 {
+			fmt.Printf("No AMI's named %s.\n", config.AMIName)
+			return
+		}
+
+		selected, err := s.LocalAmiID()
+		if err != nil {
+			fmt.Printf("No usable AMI: %s\n", err)
+		}
+
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintf(w, "\tID\tNAME\tARCH\tCREATED\tDESCRIPTION\n")
+
+		for _, i := range images {
+			marker := ""
+			if aws.StringValue(i.ImageId) == selected {
+				marker = "*"
+			}
+
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", marker, aws.StringValue(i.ImageId), aws.StringValue(i.Name), aws.StringValue(i.Architecture), aws.StringValue(i.CreationDate), aws.StringValue(i.Description))
+		}
+
+		_ = w.Flush()
+	},
+}
+
+// amiPruneCmd represents the ami prune command
+var amiPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes stale copies of the base AMI.",
+	Long: `
+Removes stale copies of the base AMI.
+
+When the base AMI isn't published in a region, and ami_source_region is set, 'create' copies it from there, and later creates reuse the copy.  Copies pile up as new base images are released.
+
+Deregisters every copy ops made in the region that no instance uses, except the newest copy of each architecture, and deletes their snapshots.  With --dryrun, only lists what would be removed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		s, err := ops.NewStack(config, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		pruned, err := s.PruneAmiCopies(dryRun)
+		if err != nil {
+			log.Fatalf("Failed pruning AMI copies: %s", err)
+		}
+
+		if len(pruned) == 0 {
+			fmt.Printf("No stale AMI copies.\n")
+			return
+		}
+
+		verb := "Removed"
+		if dryRun {
+			verb = "Would remove"
+		}
+
+		for _, i := range pruned {
+			fmt.Printf("%s %s (%s, copied from %s in %s)\n", verb, aws.StringValue(i.ImageId), aws.StringValue(i.Name), ops.ImageTag(i, ops.TAG_SOURCE_IMAGE), ops.ImageTag(i, ops.TAG_SOURCE_REGION))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(amiCmd)
+	amiCmd.AddCommand(amiListCmd)
+	amiCmd.AddCommand(amiPruneCmd)
+}
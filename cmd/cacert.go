@@ -45,7 +45,7 @@ You're welcome.
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -60,19 +60,18 @@ You're welcome.
 			config.StackName = name
 		}
 
-		err = config.AskForMissingParams(false)
-		if err != nil {
-			log.Fatalf("Failed asking for missing parameters")
-		}
+		askForMissingParams(config, stackParams...)
 
 		d, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
 			log.Fatalf("Failed to create devenv object: %s", err)
 		}
 
+		locateStack(d)
+
 		if dryRun {
 			fmt.Printf("Config:\n")
-			spew.Dump(config)
+			spew.Dump(config.Redacted())
 			os.Exit(0)
 		}
 
@@ -85,7 +84,7 @@ You're welcome.
 		var caURL string
 
 		for _, o := range outputs {
-			if *o.OutputKey == "CA" {
+			if *o.OutputKey == ops.OUTPUT_CA {
 				caHost = *o.OutputValue
 				caURL = fmt.Sprintf("https://%s/v1/pki/ca/pem", *o.OutputValue)
 			}
@@ -122,7 +121,7 @@ You're welcome.
 					log.Fatalf("'sudo' tool not found: %s", err)
 				}
 
-				cmd := exec.Command(sudo, "security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", "/Library/Keychains/System.keychain", fileName)
+				cmd := exec.Command(sudo, ops.SudoArgs("security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", "/Library/Keychains/System.keychain", fileName)...)
 
 				cmd.Stdout = os.Stdout
 				cmd.Stderr = os.Stderr
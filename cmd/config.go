@@ -17,16 +17,21 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/mitchellh/go-homedir"
 	"github.com/orion-labs/ops/pkg/ops"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"text/tabwriter"
 )
 
+var inherits string
+var effective bool
+
 // configCmd represents the config command
 var configCmd = &cobra.Command{
 	Use:   "config",
@@ -34,38 +39,90 @@ var configCmd = &cobra.Command{
 	Long: `
 Opens your favorite editor to create or modify your config.
 
-Opens ~/.orion-ptt-system.yaml in your favorite editor.  
+Opens ~/.orion-ptt-system.json in your favorite editor.  
 
 If it doesn't exist, we open a file with a basic template that you can fill out with the proper values for your environment.
 
+With --profile, only the named profile is opened.  If the profile doesn't exist yet, it's created, optionally inheriting from the profile named by --inherits.
+
+A config file with profiles looks like:
+
+    {
+      "default_profile": "dev",
+      "profiles": {
+        "base": { "user_name": "...", "license_file": "..." },
+        "dev": { "inherits": "base", "dns_domain": "dev.example.com" },
+        "qa": { "inherits": "base", "dns_domain": "qa.example.com" }
+      }
+    }
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		editor := os.Getenv("EDITOR")
-		if editor == "" {
-			editor = "nano"
-		}
-
-		command, err := exec.LookPath(editor)
+		filePath, err := ops.ConfigFilePath(configPath)
 		if err != nil {
-			log.Fatalf("Command %q not found: %s", editor, err)
+			log.Fatalf("failed to determine config file path: %s", err)
 		}
 
-		tmpFile, err := ioutil.TempFile("", "secretfile")
+		file, err := ops.ReadConfigFile(filePath)
 		if err != nil {
-			log.Fatalf("Error creating temp file: %s", err)
+			log.Fatalf("Error reading %s: %s", filePath, err)
 		}
 
-		hd, err := homedir.Dir()
-		if err != nil {
-			log.Fatalf("failed to read home directory: %s", err)
+		// edit a single profile
+		if profile != "" {
+			var fileContents []byte
+
+			existing, ok := file.Profiles[profile]
+			if ok {
+				fileContents, err = json.MarshalIndent(existing, "", "  ")
+				if err != nil {
+					log.Fatalf("failed marshalling profile %s: %s", profile, err)
+				}
+			} else if inherits != "" {
+				fileContents = []byte(fmt.Sprintf("{\n  %q: %q\n}\n", ops.PROFILE_INHERITS_KEY, inherits))
+			} else {
+				fileContents = []byte(ops.CONFIG_FILE_TEMPLATE)
+			}
+
+			contents, err := editInEditor(fileContents)
+			if err != nil {
+				log.Fatalf("Error editing profile %s: %s", profile, err)
+			}
+
+			values := make(map[string]interface{})
+			err = json.Unmarshal(contents, &values)
+			if err != nil {
+				log.Fatalf("Profile %s is not valid json, not saving: %s", profile, err)
+			}
+
+			file.Profiles[profile] = values
+
+			err = file.CheckKeys()
+			if err != nil {
+				log.Fatalf("Profile %s is not valid, not saving: %s", profile, err)
+			}
+
+			_, err = file.Resolve(profile)
+			if err != nil {
+				log.Fatalf("Profile %s is not usable, not saving: %s", profile, err)
+			}
+
+			err = file.Write(filePath)
+			if err != nil {
+				log.Fatalf("Error writing file %s: %s", filePath, err)
+			}
+
+			return
 		}
 
-		filePath := fmt.Sprintf("%s/%s", hd, ops.DEFAULT_CONFIG_FILE)
 		var fileContents []byte
 
-		// if the default config file doesn't exist
+		// if the config file doesn't exist
 		if _, e := os.Stat(filePath); os.IsNotExist(e) {
-			fileContents = []byte(ops.CONFIG_FILE_TEMPLATE)
+			fileContents, err = ops.ConfigFileTemplate()
+			if err != nil {
+				log.Fatalf("Error creating config template: %s", err)
+			}
 		} else {
 			fc, err := ioutil.ReadFile(filePath)
 			if err != nil {
@@ -75,46 +132,355 @@ If it doesn't exist, we open a file with a basic template that you can fill out
 			fileContents = fc
 		}
 
-		err = ioutil.WriteFile(tmpFile.Name(), fileContents, 0644)
+		contents, err := editInEditor(fileContents)
+		if err != nil {
+			log.Fatalf("Error editing %s: %s", filePath, err)
+		}
+
+		err = ops.ValidateConfigContent(filePath, contents)
+		if err != nil {
+			log.Fatalf("Config is not valid, not saving: %s", err)
+		}
+
+		err = ioutil.WriteFile(filePath, contents, 0600)
+		if err != nil {
+			log.Fatalf("Error writing file %s: %s", filePath, err)
+		}
+	},
+}
+
+// configProfilesCmd represents the config profiles command
+var configProfilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List the profiles in your config file.",
+	Long: `
+List the profiles in your config file.
+
+The profile used when none is selected is marked with a '*'.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, err := ops.ConfigFilePath(configPath)
+		if err != nil {
+			log.Fatalf("failed to determine config file path: %s", err)
+		}
+
+		file, err := ops.ReadConfigFile(filePath)
 		if err != nil {
-			log.Fatalf("failed writing temp file %s: %s", tmpFile.Name(), err)
+			log.Fatalf("Error reading %s: %s", filePath, err)
 		}
 
-		defer os.Remove(tmpFile.Name())
+		selected := file.SelectProfile("")
 
-		shellenv := os.Environ()
+		for _, name := range file.ProfileNames() {
+			marker := " "
+			if name == selected {
+				marker = "*"
+			}
 
-		prog := exec.Command(command, tmpFile.Name())
+			parent, _ := file.Profiles[name][ops.PROFILE_INHERITS_KEY].(string)
+			if parent != "" {
+				fmt.Printf("%s %s (inherits %s)\n", marker, name, parent)
+			} else {
+				fmt.Printf("%s %s\n", marker, name)
+			}
+		}
+	},
+}
 
-		prog.Env = shellenv
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the config ops will use.",
+	Long: `
+Show the config ops will use.
+
+Config is layered.  In order of increasing precedence, values come from:
 
-		prog.Stdout = os.Stdout
-		prog.Stderr = os.Stderr
-		prog.Stdin = os.Stdin
+	built in defaults
+	the config file (JSON, or YAML if it ends in .yaml or .yml), using the selected profile
+	ORION_* environment variables, e.g. ORION_DNS_DOMAIN for dns_domain
+	command line flags, e.g. --dns-domain
 
-		err = prog.Start()
+With --effective, each value is shown together with where it came from.  Secrets are masked.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, sources, err := configLoader(cmd).Load()
 		if err != nil {
-			log.Fatalf("Error starting command: %s", err)
+			log.Fatalf("failed to load config: %s", err)
+		}
+
+		if !effective {
+			content, err := json.MarshalIndent(config.Redacted(), "", "  ")
+			if err != nil {
+				log.Fatalf("failed marshalling config: %s", err)
+			}
+
+			fmt.Printf("%s\n", ops.Redact(string(content)))
+			return
 		}
 
-		err = prog.Wait()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintf(w, "FIELD\tVALUE\tSOURCE\n")
+		for _, s := range config.EffectiveSettings(sources) {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Value, s.Source)
+		}
+
+		_ = w.Flush()
+	},
+}
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [name]",
+	Short: "Check your config against your AWS account.",
+	Long: `
+Check your config against your AWS account.
+
+Confirms that every required field is set, the EC2 key pair exists, the DNS domain has a hosted zone, the AMI pattern matches an image, a configured subnet exists, the license file is valid, and the config template renders.
+
+Nothing is created.  Prints a pass/fail report, and exits non-zero if anything failed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
 		if err != nil {
-			log.Fatalf("Error waiting for command: %s", err)
+			log.Fatalf("failed to load config: %s", err)
+		}
+
+		if name == "" {
+			if len(args) > 0 {
+				name = args[0]
+			}
 		}
 
-		contents, err := ioutil.ReadFile(tmpFile.Name())
+		if name != "" {
+			config.StackName = name
+		}
+
+		s, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
-			log.Fatalf("Error reading file: %s", err)
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		results := s.ValidateConfig()
+
+		fmt.Printf("\nConfig Validation:\n")
+		ops.PrintCheckResults(results)
+
+		if !ops.ChecksPassed(results) {
+			os.Exit(1)
 		}
+	},
+}
 
-		err = ioutil.WriteFile(filePath, contents, 0644)
+// configInitCmd represents the config init command
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a config profile with a guided wizard.",
+	Long: `
+Create a config profile with a guided wizard.
+
+Lists the EC2 key pairs, Route53 hosted zones, subnets and AMI's in your AWS account, and lets you pick from them.  Each answer is checked before moving on.
+
+The answers are written to the profile named by --profile, or the default profile, in your config file.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if ops.NonInteractive {
+			log.Fatalf("'config init' is interactive.  Use 'ops config' or ORION_* environment variables in non-interactive mode.")
+		}
+
+		filePath, err := ops.ConfigFilePath(configPath)
+		if err != nil {
+			log.Fatalf("failed to determine config file path: %s", err)
+		}
+
+		file, err := ops.ReadConfigFile(filePath)
+		if err != nil {
+			log.Fatalf("Error reading %s: %s", filePath, err)
+		}
+
+		profileName := file.SelectProfile(profile)
+
+		prompter := ops.NewPrompter(os.Stdin, os.Stdout)
+
+		if _, ok := file.Profiles[profileName]; ok {
+			overwrite, err := prompter.Confirm(fmt.Sprintf("Profile %q already exists in %s.  Overwrite it?", profileName, filePath))
+			if err != nil {
+				log.Fatalf("failed reading answer: %s", err)
+			}
+
+			if !overwrite {
+				fmt.Printf("Leaving %s alone.\n", filePath)
+				return
+			}
+		}
+
+		s, err := ops.NewStack(&ops.StackConfig{}, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		fmt.Printf("Creating profile %q in %s\n\n", profileName, filePath)
+
+		values, err := prompter.Run(s.ConfigWizardSteps())
+		if err != nil {
+			log.Fatalf("config wizard failed: %s", err)
+		}
+
+		if inherits != "" {
+			values[ops.PROFILE_INHERITS_KEY] = inherits
+		}
+
+		file.Profiles[profileName] = values
+
+		err = file.Write(filePath)
 		if err != nil {
 			log.Fatalf("Error writing file %s: %s", filePath, err)
 		}
 
+		fmt.Printf("\nConfig written to %s.  Run 'ops config validate' to check it.\n", filePath)
 	},
 }
 
+// configMigrateCmd represents the config migrate command
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite your config file in the current format.",
+	Long: fmt.Sprintf(`
+Rewrite your config file in the current format.
+
+Older config files are read, and migrated in memory, every time ops runs.  This saves the migrated file, so the migrations don't have to run again.  The original is kept alongside it with a '.bak' suffix.
+
+The current config file format is version %d.
+`, ops.CONFIG_VERSION),
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, err := ops.ConfigFilePath(configPath)
+		if err != nil {
+			log.Fatalf("failed to determine config file path: %s", err)
+		}
+
+		original, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			log.Fatalf("Error reading %s: %s", filePath, err)
+		}
+
+		file, err := ops.ReadConfigFile(filePath)
+		if err != nil {
+			log.Fatalf("Error reading %s: %s", filePath, err)
+		}
+
+		if len(file.Migrations) == 0 {
+			fmt.Printf("%s is already at version %d.\n", filePath, ops.CONFIG_VERSION)
+			return
+		}
+
+		backup := fmt.Sprintf("%s.bak", filePath)
+		err = ioutil.WriteFile(backup, original, 0600)
+		if err != nil {
+			log.Fatalf("Error writing backup %s: %s", backup, err)
+		}
+
+		err = file.Write(filePath)
+		if err != nil {
+			log.Fatalf("Error writing file %s: %s", filePath, err)
+		}
+
+		fmt.Printf("Migrated %s (original saved as %s):\n", filePath, backup)
+		for _, m := range file.Migrations {
+			fmt.Printf("  %s\n", m)
+		}
+	},
+}
+
+// configSchemaCmd represents the config schema command
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file.",
+	Long: `
+Print the JSON Schema of the config file.
+
+Point your editor at it for completion and validation of your config file.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		content, err := ops.ConfigSchemaJSON()
+		if err != nil {
+			log.Fatalf("failed generating schema: %s", err)
+		}
+
+		fmt.Print(string(content))
+	},
+}
+
+// editInEditor opens the given contents in $EDITOR, and returns whatever the user saved.
+func editInEditor(fileContents []byte) (contents []byte, err error) {
+	if ops.NonInteractive {
+		err = errors.New("refusing to open an editor in non-interactive mode")
+		return contents, err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "nano"
+	}
+
+	command, err := exec.LookPath(editor)
+	if err != nil {
+		err = errors.Wrapf(err, "command %q not found", editor)
+		return contents, err
+	}
+
+	tmpFile, err := ioutil.TempFile("", "secretfile")
+	if err != nil {
+		err = errors.Wrapf(err, "error creating temp file")
+		return contents, err
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	err = ioutil.WriteFile(tmpFile.Name(), fileContents, 0600)
+	if err != nil {
+		err = errors.Wrapf(err, "failed writing temp file %s", tmpFile.Name())
+		return contents, err
+	}
+
+	prog := exec.Command(command, tmpFile.Name())
+
+	prog.Env = os.Environ()
+
+	prog.Stdout = os.Stdout
+	prog.Stderr = os.Stderr
+	prog.Stdin = os.Stdin
+
+	err = prog.Start()
+	if err != nil {
+		err = errors.Wrapf(err, "error starting command")
+		return contents, err
+	}
+
+	err = prog.Wait()
+	if err != nil {
+		err = errors.Wrapf(err, "error waiting for command")
+		return contents, err
+	}
+
+	contents, err = ioutil.ReadFile(tmpFile.Name())
+	if err != nil {
+		err = errors.Wrapf(err, "error reading file")
+		return contents, err
+	}
+
+	return contents, err
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configProfilesCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+
+	configShowCmd.Flags().BoolVarP(&effective, "effective", "e", false, "show where each value came from")
+	configCmd.Flags().StringVarP(&inherits, "inherits", "", "", "profile a newly created profile inherits from")
+	configInitCmd.Flags().StringVarP(&inherits, "inherits", "", "", "profile the new profile inherits from")
 }
@@ -0,0 +1,119 @@
+/*
+Copyright © 2021 Nik Ogura <nik@orionlabs.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/orion-labs/ops/pkg/ops"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// costCmd represents the cost command
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Estimate what your Orion PTT Stacks have cost so far.",
+	Long: `
+Estimate what your Orion PTT Stacks have cost so far.
+
+For every stack 'ops list' shows, multiplies the time since it was created by the hourly cost of its instance type and volume, in its region.
+
+With --all-regions, stacks in every region enabled in the account are priced, as 'ops list --all-regions' finds them.
+
+Prices come from a table bundled with ops, and are estimates of on demand prices only.  To update them, or add instance types or regions, put entries of the same form in ~/.orion-ptt-system-pricing.json, e.g.
+
+    {
+      "regions": {
+        "us-east-1": {
+          "instance_hourly": { "m5.2xlarge": 0.384 },
+          "volume_gb_month": 0.10
+        }
+      }
+    }
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		s, err := ops.NewStack(config, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		table, err := ops.LoadPricing()
+		if err != nil {
+			log.Fatalf("Error loading pricing: %s", err)
+		}
+
+		// each stack is priced in the region it's in.
+		var results []ops.RegionStacks
+
+		if allRegions {
+			results, err = s.ListStacksAllRegions()
+			if err != nil {
+				log.Fatalf("Error listing regions: %s", err)
+			}
+		} else {
+			stacks, err := s.ListStacks()
+			if err != nil {
+				log.Fatalf("Error listing stacks: %s", err)
+			}
+
+			results = []ops.RegionStacks{{Region: aws.StringValue(s.AwsSession.Config.Region), Stacks: stacks}}
+		}
+
+		now := time.Now()
+		total := 0.0
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintf(w, "STACK\tREGION\tINSTANCE\tCREATED\tHOURS\tHOURLY\tSO FAR\n")
+
+		for _, r := range results {
+			if r.Err != nil {
+				log.Printf("Error listing stacks in %s: %s", r.Region, r.Err)
+				continue
+			}
+
+			for _, stack := range r.Stacks {
+				cost := table.StackRunningCost(stack, r.Region, now)
+				if cost.Err != nil {
+					_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.0f\t?\t? (%s)\n", cost.StackName, r.Region, cost.Estimate.InstanceType, cost.Created.Format(time.RFC3339), cost.Hours, cost.Err)
+					continue
+				}
+
+				total += cost.SoFar
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.0f\t%.2f\t%.2f\n", cost.StackName, r.Region, cost.Estimate.InstanceType, cost.Created.Format(time.RFC3339), cost.Hours, cost.Estimate.Hourly, cost.SoFar)
+			}
+		}
+
+		_ = w.Flush()
+
+		fmt.Printf("\nEstimated total so far: %.2f %s (prices as of %s)\n", total, table.Currency, table.Updated)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(costCmd)
+
+	costCmd.Flags().BoolVarP(&allRegions, "all-regions", "", false, "price stacks in every region")
+}
@@ -25,6 +25,8 @@ import (
 	"os"
 )
 
+var assumeYes bool
+
 // createCmd represents the create command
 var createCmd = &cobra.Command{
 	Use:   "create [name]",
@@ -44,9 +46,13 @@ This is no different from using the AWS console to create the CloudFormation sta
 
 Requires an AWS account, and AWS API credentials with Administrator privileges.
 
+Runs the same checks as 'ops preflight' first, and stops if any fail.
+
+Shows an estimate of what the stack will cost to run, and asks for confirmation before creating it.  Use --yes to skip the confirmation.  It's also skipped in non-interactive mode.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -61,22 +67,43 @@ Requires an AWS account, and AWS API credentials with Administrator privileges.
 			config.StackName = name
 		}
 
-		err = config.AskForMissingParams(true)
-		if err != nil {
-			log.Fatalf("Failed asking for missing parameters")
-		}
+		askForMissingParams(config)
 
 		s, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
 			log.Fatalf("Failed to create devenv object: %s", err)
 		}
 
+		estimate, err := s.EstimateCost()
+		if err != nil {
+			fmt.Printf("Can't estimate cost: %s\n", err)
+		} else {
+			fmt.Printf("Estimated cost: %s\n", estimate)
+		}
+
 		if dryRun {
 			fmt.Printf("Config:\n")
-			spew.Dump(config)
+			spew.Dump(config.Redacted())
 			os.Exit(0)
 		}
 
+		err = s.ValidateLicense()
+		if err != nil {
+			log.Fatalf("Refusing to start, license is unusable: %s", err)
+		}
+
+		if !assumeYes && !ops.NonInteractive {
+			ok, err := ops.NewPrompter(os.Stdin, os.Stdout).Confirm(fmt.Sprintf("Create stack %s?", config.StackName))
+			if err != nil {
+				log.Fatalf("Failed reading confirmation: %s", err)
+			}
+
+			if !ok {
+				fmt.Printf("Not creating stack %s.\n", config.StackName)
+				return
+			}
+		}
+
 		err = s.Create(stageOnly)
 		if err != nil {
 			log.Fatalf("Stack creation failed: %s", err)
@@ -87,4 +114,5 @@ Requires an AWS account, and AWS API credentials with Administrator privileges.
 func init() {
 	rootCmd.AddCommand(createCmd)
 
+	createCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "create without asking for confirmation")
 }
@@ -36,7 +36,7 @@ No different from pushing the 'Delete Stack' button in the AWS Cloudformation co
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -51,19 +51,18 @@ No different from pushing the 'Delete Stack' button in the AWS Cloudformation co
 			config.StackName = name
 		}
 
-		err = config.AskForMissingParams(false)
-		if err != nil {
-			log.Fatalf("Failed asking for missing parameters")
-		}
+		askForMissingParams(config, stackParams...)
 
 		s, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
 			log.Fatalf("Failed to create devenv object: %s", err)
 		}
 
+		locateStack(s)
+
 		if dryRun {
 			fmt.Printf("Config:\n")
-			spew.Dump(config)
+			spew.Dump(config.Redacted())
 			os.Exit(0)
 		}
 
@@ -40,7 +40,7 @@ This can be useful for more complex scripting.
 e.g. "ops get ip [<name>]" fetches just the IP address of a stack.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -61,19 +61,18 @@ e.g. "ops get ip [<name>]" fetches just the IP address of a stack.
 			config.StackName = name
 		}
 
-		err = config.AskForMissingParams(false)
-		if err != nil {
-			log.Fatalf("Failed asking for missing parameters")
-		}
+		askForMissingParams(config, stackParams...)
 
 		s, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
 			log.Fatalf("Failed to create devenv object: %s", err)
 		}
 
+		locateStack(s)
+
 		if dryRun {
 			fmt.Printf("Config:\n")
-			spew.Dump(config)
+			spew.Dump(config.Redacted())
 			os.Exit(0)
 		}
 
@@ -0,0 +1,77 @@
+/*
+Copyright © 2021 Nik Ogura <nik@orionlabs.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/orion-labs/ops/pkg/ops"
+	"github.com/spf13/cobra"
+	"log"
+	"time"
+)
+
+// licenseCmd represents the license command
+var licenseCmd = &cobra.Command{
+	Use:   "license",
+	Short: "Work with Orion PTT System license files.",
+	Long: `
+Work with Orion PTT System license files.
+`,
+}
+
+// licenseInspectCmd represents the license inspect command
+var licenseInspectCmd = &cobra.Command{
+	Use:   "inspect [file]",
+	Short: "Show the contents of a license file.",
+	Long: `
+Show the contents of a license file.
+
+Parses the license locally and shows the license ID, app, channel, expiry and entitlements.  If no file is given, the 'license_file' from your config is used.
+
+Exits non-zero if the license is malformed, expired, or not for the Orion PTT System.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		licenseFile := config.LicenseFile
+		if len(args) > 0 {
+			licenseFile = args[0]
+		}
+
+		license, err := ops.LoadLicense(licenseFile)
+		if err != nil {
+			log.Fatalf("Failed loading license: %s", err)
+		}
+
+		ops.PrintLicense(license)
+
+		err = license.Validate(ops.KOTS_APP_SLUG, time.Now())
+		if err != nil {
+			log.Fatalf("License is not usable: %s", err)
+		}
+
+		fmt.Printf("\nLicense is valid.\n")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(licenseCmd)
+	licenseCmd.AddCommand(licenseInspectCmd)
+}
@@ -20,8 +20,12 @@ import (
 	"github.com/orion-labs/ops/pkg/ops"
 	"github.com/spf13/cobra"
 	"log"
+	"os"
+	"text/tabwriter"
 )
 
+var allRegions bool
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
@@ -29,10 +33,14 @@ var listCmd = &cobra.Command{
 	Long: `
 List Orion PTT Stacks.
 
-Queries AWS CloudFormation and returns a list of stacks who's description matches that of the CloudForation Yaml Template in S3.'
+Queries AWS CloudFormation and returns a list of stacks tagged orion:managed-by=ops.
+
+Stacks created before that tag was added are recognised by their description matching that of the CloudFormation Yaml Template in S3.  The description is cached in ~/.orion-ptt-system-template-cache.json for a day, and if S3 can't be reached the cached description is used regardless.  Without one, only tagged stacks are listed.
+
+With --all-regions, every region enabled in the account is searched, concurrently, and each stack's region is shown.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -42,6 +50,31 @@ Queries AWS CloudFormation and returns a list of stacks who's description matche
 			log.Fatalf("Failed to create devenv object: %s", err)
 		}
 
+		if allRegions {
+			results, err := s.ListStacksAllRegions()
+			if err != nil {
+				log.Fatalf("Error listing regions: %s", err)
+			}
+
+			fmt.Printf("Stacks currently registered in CloudFormation:\n")
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, r := range results {
+				if r.Err != nil {
+					log.Printf("Error listing stacks in %s: %s", r.Region, r.Err)
+					continue
+				}
+
+				for _, stack := range r.Stacks {
+					_, _ = fmt.Fprintf(w, "  %s\t%s\n", *stack.StackName, r.Region)
+				}
+			}
+
+			_ = w.Flush()
+
+			return
+		}
+
 		stacks, err := s.ListStacks()
 		if err != nil {
 			log.Fatalf("Error listing stacks: %s", err)
@@ -58,4 +91,6 @@ Queries AWS CloudFormation and returns a list of stacks who's description matche
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().BoolVarP(&allRegions, "all-regions", "", false, "list stacks in every region")
 }
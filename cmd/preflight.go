@@ -0,0 +1,84 @@
+/*
+Copyright © 2021 Nik Ogura <nik@orionlabs.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/orion-labs/ops/pkg/ops"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+// preflightCmd represents the preflight command
+var preflightCmd = &cobra.Command{
+	Use:   "preflight [name]",
+	Short: "Checks an Orion PTT System stack can be created.",
+	Long: `
+Checks an Orion PTT System stack can be created.
+
+Nothing is created.  Checks that:
+
+	The stack name is a valid CloudFormation stack name, and DNS label, and no stack by that name exists.
+
+	The account has enough vCPU and Elastic IP quota left for the instance type.
+
+	No Route53 records exist at, or under, <name>.<dns domain>.
+
+	The key pair exists in the region.
+
+	Your credentials are allowed the actions creating a stack needs.
+
+Every check runs, so all problems are reported at once.  Checks that can't be run are reported as warnings.  'create' runs the same checks first.  Exits non-zero if anything failed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		if name == "" {
+			if len(args) > 0 {
+				name = args[0]
+			}
+		}
+
+		if name != "" {
+			config.StackName = name
+		}
+
+		askForMissingParams(config, templateParams...)
+
+		s, err := ops.NewStack(config, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		results := s.Preflight()
+
+		fmt.Printf("\nPreflight:\n")
+		ops.PrintCheckResults(results)
+
+		if !ops.ChecksPassed(results) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(preflightCmd)
+}
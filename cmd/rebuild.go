@@ -37,7 +37,7 @@ No different from calling 'create', followed by 'destroy', but it will read the
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -52,22 +52,26 @@ No different from calling 'create', followed by 'destroy', but it will read the
 			config.StackName = name
 		}
 
-		err = config.AskForMissingParams(false)
-		if err != nil {
-			log.Fatalf("Failed asking for missing parameters")
-		}
+		askForMissingParams(config, stackParams...)
 
 		s, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
 			log.Fatalf("Failed to create devenv object: %s", err)
 		}
 
+		locateStack(s)
+
 		if dryRun {
 			fmt.Printf("Config:\n")
-			spew.Dump(config)
+			spew.Dump(config.Redacted())
 			os.Exit(0)
 		}
 
+		err = s.ValidateLicense()
+		if err != nil {
+			log.Fatalf("Refusing to start, license is unusable: %s", err)
+		}
+
 		exists := s.Exists()
 		if !exists {
 			log.Fatalf("Stack %s doesn't exist.  Try 'create' instead.", name)
@@ -84,6 +88,9 @@ No different from calling 'create', followed by 'destroy', but it will read the
 			}
 		}
 
+		// with the key known, check for everything creating the stack again needs, before destroying it.
+		askForMissingParams(s.Config)
+
 		fmt.Printf("Nuking and Paving Stack %q.\n", s.Config.StackName)
 
 		fmt.Printf("Using KeyPair: %q\n", s.Config.KeyName)
@@ -0,0 +1,73 @@
+/*
+Copyright © 2021 Nik Ogura <nik@orionlabs.io>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/orion-labs/ops/pkg/ops"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+// reconfigureCmd represents the reconfigure command
+var reconfigureCmd = &cobra.Command{
+	Use:   "reconfigure [name]",
+	Short: "Re-render and re-apply the kots config of a running stack.",
+	Long: `
+Re-render and re-apply the kots config of a running stack.
+
+Renders the config template again, compares it with the config.yaml already staged on the instance, shows the changes, and then applies them with 'kubectl kots set config' and a redeploy.
+
+The JWK keystore from the staged config is reused, so existing tokens stay valid.
+
+With --dryrun, the changes are shown but not applied.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		if name == "" {
+			if len(args) > 0 {
+				name = args[0]
+			}
+		}
+
+		if name != "" {
+			config.StackName = name
+		}
+
+		askForMissingParams(config, stackParams...)
+
+		s, err := ops.NewStack(config, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		locateStack(s)
+
+		_, err = s.Reconfigure(!dryRun)
+		if err != nil {
+			log.Fatalf("Reconfiguring stack %s failed: %s", s.Config.StackName, err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reconfigureCmd)
+}
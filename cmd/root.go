@@ -15,16 +15,22 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/orion-labs/ops/pkg/ops"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"log"
 	"os"
+	"reflect"
 )
 
 var name string
 var keyname string
 var configPath string
+var profile string
 var autoRollback bool
 var dryRun bool
 var stageOnly bool
+var nonInteractive bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -36,22 +42,117 @@ Easily manage Orion PTT System stacks.
 Instruments the AWS CloudFormation API so you don't have to all that tedious mucking about in the AWS console.
 
 `,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// if nobody's at a terminal, nobody can answer a prompt.
+		ops.NonInteractive = nonInteractive || !ops.StdinIsTerminal()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Println(ops.Redact(err.Error()))
 		os.Exit(1)
 	}
 }
 
 func init() {
+	// mask secrets in anything that goes through the log package, which is where all our fatal errors go.
+	log.SetOutput(ops.NewRedactingWriter(os.Stderr))
+
 	rootCmd.PersistentFlags().StringVarP(&name, "name", "n", "", "environment name")
 	rootCmd.PersistentFlags().StringVarP(&keyname, "keyname", "k", "", "ssh key name")
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "~/.orion-ptt-system.json", "path to config file")
+	rootCmd.PersistentFlags().StringVarP(&profile, "profile", "", "", fmt.Sprintf("config profile to use.  Defaults to $%s, then the config file's default profile.", ops.PROFILE_ENV_VAR))
 	rootCmd.PersistentFlags().BoolVarP(&autoRollback, "rollback", "r", true, "Automatically rollback if creation fails.")
 	rootCmd.PersistentFlags().BoolVarP(&dryRun, "dryrun", "d", false, "dry run.  Prints Config info and exits.")
+	rootCmd.PersistentFlags().BoolVarP(&nonInteractive, "non-interactive", "", false, fmt.Sprintf("never prompt.  Missing parameters fail with exit code %d.  Enabled automatically when stdin is not a terminal.", ops.EXIT_CODE_MISSING_PARAMS))
 	rootCmd.PersistentFlags().BoolVarP(&stageOnly, "stageonly", "s", false, "stage only.  Builds AWS resources, stages files, and then exits.")
+
+	// Every config field can be set on the command line, except secrets, which would end up in argv and shell history.  Fields that already have a flag above keep it.
+	for _, f := range ops.ConfigFields() {
+		if f.Secret || rootCmd.PersistentFlags().Lookup(f.Flag) != nil {
+			continue
+		}
+
+		if f.Type.Kind() == reflect.Bool {
+			rootCmd.PersistentFlags().Bool(f.Flag, false, f.Usage)
+		} else {
+			rootCmd.PersistentFlags().String(f.Flag, "", f.Usage)
+		}
+	}
+
+	// --beta predates template_url.  It's kept so existing scripts still work.
+	rootCmd.PersistentFlags().Bool("beta", false, "use the beta CloudFormation template")
+	_ = rootCmd.PersistentFlags().MarkDeprecated("beta", fmt.Sprintf("use --template %s instead", ops.BETA_TEMPLATE_URL))
+}
+
+// configLoader creates a config loader for the given command, carrying any config flags set on the command line.
+func configLoader(cmd *cobra.Command) (loader *ops.ConfigLoader) {
+	flags := make(map[string]string)
+
+	for _, f := range ops.ConfigFields() {
+		if cmd.Flags().Changed(f.Flag) {
+			flags[f.Flag] = cmd.Flags().Lookup(f.Flag).Value.String()
+		}
+	}
+
+	if cmd.Flags().Changed("beta") && cmd.Flags().Lookup("beta").Value.String() == "true" {
+		if _, ok := flags["template"]; !ok {
+			flags["template"] = ops.BETA_TEMPLATE_URL
+		}
+	}
+
+	loader = &ops.ConfigLoader{
+		Path:    configPath,
+		Profile: profile,
+		Flags:   flags,
+	}
+
+	return loader
+}
+
+// loadConfig loads the layered config for the given command.
+func loadConfig(cmd *cobra.Command) (config *ops.StackConfig, err error) {
+	config, _, err = configLoader(cmd).Load()
+
+	return config, err
+}
+
+// locateStack switches to the region the stack lives in, unless a region was set explicitly.  Failing to look is only a warning: the stack may well be in the default region.
+func locateStack(s *ops.Stack) {
+	switched, warning, err := s.Locate()
+	if err != nil {
+		log.Printf("Couldn't search other regions for %s: %s", s.Config.StackName, err)
+		return
+	}
+
+	if switched != "" {
+		log.Printf("Found stack %s in %s", s.Config.StackName, switched)
+	}
+
+	if warning != "" {
+		log.Printf("Warning: %s", warning)
+	}
+}
+
+// stackParams  Config keys commands acting on an existing stack need.
+var stackParams = []string{"stack_name", "dns_domain", "ami_name"}
+
+// templateParams  Config keys needed to check, or render the template of, a stack without creating it.
+var templateParams = []string{"stack_name", "key_name", "dns_domain", "ami_name"}
+
+// askForMissingParams asks for any of the given parameters missing from the config, or, without any, for everything creating a stack needs.  In non-interactive mode, missing parameters are reported together, and we exit with EXIT_CODE_MISSING_PARAMS.
+func askForMissingParams(config *ops.StackConfig, keys ...string) {
+	err := config.AskForMissingParams(keys...)
+	if err != nil {
+		var missing *ops.MissingParamsError
+		if errors.As(err, &missing) {
+			log.Print(missing)
+			os.Exit(ops.EXIT_CODE_MISSING_PARAMS)
+		}
+
+		log.Fatalf("Failed asking for missing parameters: %s", err)
+	}
 }
@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"github.com/mitchellh/go-homedir"
 	"github.com/orion-labs/ops/pkg/ops"
 	"github.com/spf13/cobra"
 	"log"
@@ -23,6 +24,8 @@ import (
 
 var address string
 var port int
+var serverConfigPath string
+var opsConfigPath string
 
 // serverCmd represents the server command
 var serverCmd = &cobra.Command{
@@ -30,13 +33,85 @@ var serverCmd = &cobra.Command{
 	Short: "Run the Orion PTT System Instance Management Server.",
 	Long: `
 Run the Orion PTT System Instance Management Server.
+
+With --config, the server reads its settings from a YAML or JSON file: the listen address and port, TLS certificate, accounts, regions, users allowed in, and how often it refreshes the stacks and checks the file for changes.  e.g.
+
+  address: 0.0.0.0
+  port: 8443
+  tls:
+    cert_file: /etc/ops/server.crt
+    key_file: /etc/ops/server.key
+  accounts:
+    prod:
+      role_arn: arn:aws:iam::123456789012:role/orion-ops
+  regions: [us-east-1, us-west-2]
+  auth:
+    users:
+      admin: ssm:/orion/ops-server-password
+  intervals:
+    refresh: 1m
+    reload: 10s
+
+Changes to the file are picked up without a restart, except for the listen address and turning TLS on or off.  A change that's invalid, or whose accounts can't be assumed, is logged and ignored: the server keeps its last good config.
+
+Each account's role is assumed from the server's own credentials, and refreshed before it expires.  Without --config, the accounts come from the accounts section of the ops config file given with --ops-config.  Without any accounts, the server manages the account its own credentials are for.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		server, err := ops.NewOpsServer(address, port)
+		config := ops.DefaultServerConfig()
+
+		if serverConfigPath != "" {
+			path, err := homedir.Expand(serverConfigPath)
+			if err != nil {
+				log.Fatalf("Failed expanding %s: %s", serverConfigPath, err)
+			}
+
+			serverConfigPath = path
+
+			config, err = ops.ReadServerConfig(serverConfigPath)
+			if err != nil {
+				log.Fatalf("Failed to read server config: %s", err)
+			}
+		} else {
+			path, err := ops.ConfigFilePath(opsConfigPath)
+			if err != nil {
+				log.Fatalf("Failed to find config file: %s", err)
+			}
+
+			file, err := ops.ReadConfigFile(path)
+			if err != nil {
+				log.Fatalf("Failed to read config file at %s: %s", path, err)
+			}
+
+			config.Accounts = file.Accounts
+
+			err = config.Validate()
+			if err != nil {
+				log.Fatalf("Invalid server config: %s", err)
+			}
+		}
+
+		// --address and --port win over the server config file, on every reload too.
+		overrideAddress := ""
+		if cmd.Flags().Changed("address") || serverConfigPath == "" {
+			overrideAddress = address
+		}
+
+		overridePort := 0
+		if cmd.Flags().Changed("port") || serverConfigPath == "" {
+			overridePort = port
+		}
+
+		config.Override(overrideAddress, overridePort)
+
+		server, err := ops.NewOpsServer(config)
 		if err != nil {
 			log.Fatalf("Failed to create server instance: %s", err)
 		}
 
+		server.ConfigPath = serverConfigPath
+		server.Address = overrideAddress
+		server.Port = overridePort
+
 		err = server.Run()
 		if err != nil {
 			log.Fatalf("Server failed to run: %s", err)
@@ -49,5 +124,24 @@ func init() {
 
 	serverCmd.Flags().StringVarP(&address, "address", "a", "0.0.0.0", "Address to run upon")
 	serverCmd.Flags().IntVarP(&port, "port", "p", 3000, "Port to run the seerver upon.")
+	// --config names the server's own config file here.  Defined locally, it shadows the root --config, so the ops config file gets a flag of its own.
+	serverCmd.Flags().StringVarP(&serverConfigPath, "config", "c", "", "path to the server config file, YAML or JSON.  Watched for changes.")
+	serverCmd.Flags().StringVarP(&opsConfigPath, "ops-config", "", "~/.orion-ptt-system.json", "path to the ops config file, whose accounts are managed if there's no server config file.")
+
+	// cobra lists a flag named like a persistent one among the global flags, described by the root.  Show ours while printing help.
+	help := serverCmd.HelpFunc()
+	serverCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		global := rootCmd.PersistentFlags().Lookup("config")
+		local := serverCmd.Flags().Lookup("config")
+
+		usage, defValue := global.Usage, global.DefValue
+		global.Usage, global.DefValue = local.Usage, local.DefValue
+
+		defer func() {
+			global.Usage, global.DefValue = usage, defValue
+		}()
+
+		help(cmd, args)
+	})
 
 }
@@ -37,7 +37,7 @@ Looks for the most recent Event for the CloudFormation stack, and returns it alo
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -52,19 +52,18 @@ Looks for the most recent Event for the CloudFormation stack, and returns it alo
 			config.StackName = name
 		}
 
-		err = config.AskForMissingParams(false)
-		if err != nil {
-			log.Fatalf("Failed asking for missing parameters")
-		}
+		askForMissingParams(config, stackParams...)
 
 		s, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
 			log.Fatalf("Failed to create devenv object: %s", err)
 		}
 
+		locateStack(s)
+
 		if dryRun {
 			fmt.Printf("Config:\n")
-			spew.Dump(config)
+			spew.Dump(config.Redacted())
 			os.Exit(0)
 		}
 
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"github.com/orion-labs/ops/pkg/ops"
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -32,7 +33,7 @@ var templateCmd = &cobra.Command{
 Dumps the onprem conifg template for debugging.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := ops.LoadConfig(configPath)
+		config, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatalf("failed to read config file at %s: %s", configPath, err)
 		}
@@ -47,10 +48,7 @@ Dumps the onprem conifg template for debugging.
 			config.StackName = name
 		}
 
-		err = config.AskForMissingParams(true)
-		if err != nil {
-			log.Fatalf("Failed asking for missing parameters")
-		}
+		askForMissingParams(config, templateParams...)
 
 		s, err := ops.NewStack(config, nil, autoRollback)
 		if err != nil {
@@ -66,7 +64,79 @@ Dumps the onprem conifg template for debugging.
 	},
 }
 
+// templateParamsCmd represents the template params command
+var templateParamsCmd = &cobra.Command{
+	Use:   "params",
+	Short: "Lists the parameters of the CloudFormation template.",
+	Long: `
+Lists the parameters of the CloudFormation template.
+
+Shows the type, default, allowed values and description of every parameter the template declares, and how ops treats it:
+
+	managed        computed by ops from your config.  Can't be overridden.
+	overridable    may be set with parameter_overrides.  Some have a default of ops' own.
+
+The template is the one stacks are created from: template_url if set, and the public template otherwise.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		s, err := ops.NewStack(config, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		template, err := s.FetchTemplate()
+		if err != nil {
+			log.Fatalf("Failed fetching CloudFormation template: %s", err)
+		}
+
+		if template.Description != "" {
+			fmt.Printf("%s\n\n", template.Description)
+		}
+
+		ops.PrintTemplateParameters(template)
+	},
+}
+
+// templateCheckCmd represents the template check command
+var templateCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Checks the CloudFormation template is compatible with ops.",
+	Long: `
+Checks the CloudFormation template is compatible with ops.
+
+Downloads the template, and confirms that every parameter ops sends is declared, that the template requires no parameter ops doesn't send, that every output ops reads is defined, and that CloudFormation's ValidateTemplate accepts it.
+
+'create' runs the same check before creating anything.  Exits non-zero if anything failed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("failed to read config file at %s: %s", configPath, err)
+		}
+
+		s, err := ops.NewStack(config, nil, autoRollback)
+		if err != nil {
+			log.Fatalf("Failed to create devenv object: %s", err)
+		}
+
+		results := s.CheckTemplate()
+
+		fmt.Printf("\nTemplate Compatibility:\n")
+		ops.PrintCheckResults(results)
+
+		if !ops.ChecksPassed(results) {
+			os.Exit(1)
+		}
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(templateCmd)
-
+	templateCmd.AddCommand(templateParamsCmd)
+	templateCmd.AddCommand(templateCheckCmd)
 }
@@ -0,0 +1,265 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ACCOUNTS_KEY Top level config file key holding the accounts ops can assume roles in.
+const ACCOUNTS_KEY = "accounts"
+
+// DEFAULT_ROLE_SESSION_NAME Session name used when assuming an account's role, if the account doesn't set one.  It shows in the account's CloudTrail.
+const DEFAULT_ROLE_SESSION_NAME = "orion-ops"
+
+// ASSUME_ROLE_EXPIRY_WINDOW How long before assumed role credentials expire that they're refreshed.
+const ASSUME_ROLE_EXPIRY_WINDOW = 5 * time.Minute
+
+// roleArnPattern  An IAM role ARN.  The account number is captured.
+var roleArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::(\d{12}):role/[\w+=,.@/-]+$`)
+
+// roleSessionNamePattern  The names STS accepts for a role session.
+var roleSessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// externalIDPattern  The characters STS accepts in an external ID.  It must also be 2 to 1224 long.
+var externalIDPattern = regexp.MustCompile(`^[\w+=,.@:/-]+$`)
+
+// staticCredentialKeys  Keys holding long lived credentials, which accounts may not have.
+var staticCredentialKeys = []string{"aws_access_key_id", "aws_secret_access_key", "aws_session_token"}
+
+// Account  An AWS account ops acts in by assuming a role from the base identity, i.e. whatever credentials the AWS SDK finds.  Accounts in a config file always have a role: see Validate.  Only the base identity's own account, which ops uses when no account is chosen, is represented without one, and never comes from a file.
+type Account struct {
+	Alias       string `json:"-"`
+	Number      string `json:"-"`
+	RoleArn     string `json:"role_arn" usage:"ARN of the IAM role to assume in the account"`
+	ExternalID  string `json:"external_id,omitempty" usage:"external ID the role's trust policy requires, if any"`
+	SessionName string `json:"session_name,omitempty" usage:"role session name, as shown in CloudTrail.  Defaults to orion-ops"`
+	Region      string `json:"region,omitempty" usage:"default region in the account"`
+}
+
+// AccountKeys returns every key allowed in a config file account, sorted.
+func AccountKeys() (keys []string) {
+	keys = make([]string, 0)
+
+	t := reflect.TypeOf(Account{})
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		keys = append(keys, name)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// RoleAccountNumber returns the number of the account a role ARN belongs to.
+func RoleAccountNumber(roleArn string) (number string, err error) {
+	matches := roleArnPattern.FindStringSubmatch(roleArn)
+	if matches == nil {
+		err = errors.New(fmt.Sprintf("%q is not an IAM role ARN, e.g. arn:aws:iam::123456789012:role/orion-ops", roleArn))
+		return number, err
+	}
+
+	number = matches[1]
+
+	return number, err
+}
+
+// RoleSessionName returns the session name used when assuming the account's role.
+func (a Account) RoleSessionName() (name string) {
+	name = a.SessionName
+	if name == "" {
+		name = DEFAULT_ROLE_SESSION_NAME
+	}
+
+	return name
+}
+
+// Validate checks the account's role ARN, external ID and session name, and fills in the account number from the ARN.  The role is required: the account number comes from it, and the base identity's own account needs no entry.
+func (a *Account) Validate() (err error) {
+	if a.RoleArn == "" {
+		err = errors.New("role_arn is required")
+		return err
+	}
+
+	a.Number, err = RoleAccountNumber(a.RoleArn)
+	if err != nil {
+		return err
+	}
+
+	if a.ExternalID != "" && (len(a.ExternalID) < 2 || len(a.ExternalID) > 1224 || !externalIDPattern.MatchString(a.ExternalID)) {
+		err = errors.New("external_id must be 2 to 1224 letters, digits or any of +=,.@:/-")
+		return err
+	}
+
+	if !roleSessionNamePattern.MatchString(a.RoleSessionName()) {
+		err = errors.New(fmt.Sprintf("session_name %q must be 2 to 64 letters, digits or any of +=,.@-", a.SessionName))
+		return err
+	}
+
+	return err
+}
+
+// checkAccountKeys reports unknown keys in the raw accounts section of a config file.  Static credentials get a message of their own: accounts are only ever reached by assuming a role.
+func checkAccountKeys(raw map[string]interface{}) (err error) {
+	section, ok := raw[ACCOUNTS_KEY]
+	if !ok {
+		return err
+	}
+
+	accounts, ok := section.(map[string]interface{})
+	if !ok {
+		err = errors.New(fmt.Sprintf("%s must map account aliases to accounts", ACCOUNTS_KEY))
+		return err
+	}
+
+	problems := make([]string, 0)
+
+	known := AccountKeys()
+
+	aliases := make([]string, 0)
+	for alias := range accounts {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		account, ok := accounts[alias].(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("account %q must be an object", alias))
+			continue
+		}
+
+		keys := make([]string, 0)
+		for k := range account {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			switch {
+			case StringInSlice(k, staticCredentialKeys):
+				problems = append(problems, fmt.Sprintf("account %q has static credentials (%s).  They aren't supported: give the role_arn to assume instead", alias, k))
+			case !StringInSlice(k, known):
+				problems = append(problems, unknownKey(k, fmt.Sprintf("account %q", alias), known))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// CheckAccounts validates every account in the config file, filling in their aliases and account numbers.
+func (f *ConfigFile) CheckAccounts() (err error) {
+	problems := make([]string, 0)
+
+	for _, alias := range f.AccountAliases() {
+		account := f.Accounts[alias]
+		account.Alias = alias
+
+		e := account.Validate()
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("account %q: %s", alias, e))
+			continue
+		}
+
+		f.Accounts[alias] = account
+	}
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// AccountAliases returns the aliases of all accounts in the file, sorted.
+func (f *ConfigFile) AccountAliases() (aliases []string) {
+	aliases = make([]string, 0)
+
+	for alias := range f.Accounts {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	return aliases
+}
+
+// Account returns the account with the given alias.
+func (f *ConfigFile) Account(alias string) (account Account, err error) {
+	account, ok := f.Accounts[alias]
+	if !ok {
+		err = errors.New(fmt.Sprintf("no account %q in the config file", alias))
+
+		suggestion := Suggest(alias, f.AccountAliases())
+		if suggestion != "" {
+			err = errors.New(fmt.Sprintf("no account %q in the config file (did you mean %q?)", alias, suggestion))
+		}
+
+		return account, err
+	}
+
+	return account, err
+}
+
+// AccountSession returns a session acting in the account: the base session, with credentials from assuming the account's role.  The credentials are refreshed ASSUME_ROLE_EXPIRY_WINDOW before they expire, so a long lived session, like the server's, keeps working.  The base identity's own account, which has no role, gets the base session as is.
+func AccountSession(base *session.Session, account Account) (awsSession *session.Session) {
+	config := &aws.Config{}
+
+	if account.RoleArn != "" {
+		config.Credentials = stscreds.NewCredentials(base, account.RoleArn, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = account.RoleSessionName()
+			p.ExpiryWindow = ASSUME_ROLE_EXPIRY_WINDOW
+
+			if account.ExternalID != "" {
+				p.ExternalID = aws.String(account.ExternalID)
+			}
+		})
+	}
+
+	if account.Region != "" {
+		config.Region = aws.String(account.Region)
+	}
+
+	awsSession = base.Copy(config)
+
+	return awsSession
+}
+
+// VerifyAccount checks that the session really acts in the account, by asking STS who it is.  For a role, this assumes it.
+func VerifyAccount(awsSession *session.Session, account Account) (err error) {
+	output, err := sts.New(awsSession).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting caller identity")
+		return err
+	}
+
+	if account.Number != "" && aws.StringValue(output.Account) != account.Number {
+		err = errors.New(fmt.Sprintf("credentials are for account %s, not %s", aws.StringValue(output.Account), account.Number))
+		return err
+	}
+
+	return err
+}
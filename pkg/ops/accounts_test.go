@@ -0,0 +1,125 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRoleAccountNumber(t *testing.T) {
+	cases := []struct {
+		name   string
+		arn    string
+		number string
+		err    bool
+	}{
+		{"role", "arn:aws:iam::123456789012:role/orion-ops", "123456789012", false},
+		{"role with path", "arn:aws:iam::123456789012:role/ops/orion-ops", "123456789012", false},
+		{"govcloud", "arn:aws-us-gov:iam::123456789012:role/orion-ops", "123456789012", false},
+		{"user", "arn:aws:iam::123456789012:user/nik", "", true},
+		{"short account", "arn:aws:iam::12345:role/orion-ops", "", true},
+		{"not an arn", "orion-ops", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			number, err := RoleAccountNumber(tc.arn)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.number, number, "account number doesn't meet expectations")
+		})
+	}
+}
+
+func TestConfigFileAccounts(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			"valid",
+			`{"version": 3, "profiles": {}, "accounts": {"prod": {"role_arn": "arn:aws:iam::123456789012:role/orion-ops", "external_id": "orion-1234", "session_name": "nik"}}}`,
+			"",
+		},
+		{
+			"static keys",
+			`{"version": 3, "profiles": {}, "accounts": {"prod": {"aws_access_key_id": "AKIA", "aws_secret_access_key": "shh"}}}`,
+			`account "prod" has static credentials (aws_access_key_id).  They aren't supported: give the role_arn to assume instead; account "prod" has static credentials (aws_secret_access_key).  They aren't supported: give the role_arn to assume instead`,
+		},
+		{
+			"typo",
+			`{"version": 3, "profiles": {}, "accounts": {"prod": {"role_arn": "arn:aws:iam::123456789012:role/orion-ops", "externalid": "x"}}}`,
+			`unknown key "externalid" in account "prod" (did you mean "external_id"?)`,
+		},
+		{
+			"no role",
+			`{"version": 3, "profiles": {}, "accounts": {"prod": {"region": "us-west-2"}}}`,
+			`account "prod": role_arn is required`,
+		},
+		{
+			"bad session name",
+			`{"version": 3, "profiles": {}, "accounts": {"prod": {"role_arn": "arn:aws:iam::123456789012:role/orion-ops", "session_name": "nik ogura"}}}`,
+			`account "prod": session_name "nik ogura" must be 2 to 64 letters, digits or any of +=,.@-`,
+		},
+		{
+			"not an object",
+			`{"version": 3, "profiles": {}, "accounts": ["prod"]}`,
+			`accounts must map account aliases to accounts`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := (&ConfigFile{}).Parse([]byte(tc.content))
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err, "expected an error") {
+				assert.Equal(t, tc.err, err.Error(), "error doesn't meet expectations")
+			}
+		})
+	}
+}
+
+func TestConfigFileAccount(t *testing.T) {
+	file := &ConfigFile{}
+
+	err := file.Parse([]byte(`{"version": 3, "profiles": {}, "accounts": {"prod": {"role_arn": "arn:aws:iam::123456789012:role/orion-ops", "region": "us-west-2"}}}`))
+	if err != nil {
+		t.Fatalf("failed parsing config: %s", err)
+	}
+
+	account, err := file.Account("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", account.Alias, "alias doesn't meet expectations")
+	assert.Equal(t, "123456789012", account.Number, "number doesn't meet expectations")
+	assert.Equal(t, DEFAULT_ROLE_SESSION_NAME, account.RoleSessionName(), "session name doesn't meet expectations")
+
+	_, err = file.Account("prd")
+	if assert.Error(t, err, "expected an error") {
+		assert.Equal(t, `no account "prd" in the config file (did you mean "prod"?)`, err.Error(), "error doesn't meet expectations")
+	}
+}
+
+func TestAccountSession(t *testing.T) {
+	base, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	if err != nil {
+		t.Fatalf("failed creating session: %s", err)
+	}
+
+	ambient := AccountSession(base, Account{})
+	assert.Equal(t, base.Config.Credentials, ambient.Config.Credentials, "an account without a role should use the base credentials")
+	assert.Equal(t, "us-east-1", aws.StringValue(ambient.Config.Region), "region doesn't meet expectations")
+
+	assumed := AccountSession(base, Account{RoleArn: "arn:aws:iam::123456789012:role/orion-ops", Region: "us-west-2"})
+	assert.NotEqual(t, base.Config.Credentials, assumed.Config.Credentials, "an account with a role should assume it")
+	assert.Equal(t, "us-west-2", aws.StringValue(assumed.Config.Region), "region doesn't meet expectations")
+}
@@ -0,0 +1,542 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TAG_AMI Stack tag recording the AMI the stack was created from.
+const TAG_AMI = "orion:ami"
+
+// ARCH_X86_64 EC2 architecture of Intel and AMD instance types.
+const ARCH_X86_64 = "x86_64"
+
+// ARCH_ARM64 EC2 architecture of Graviton instance types.
+const ARCH_ARM64 = "arm64"
+
+// TAG_SOURCE_IMAGE Tag on AMI copies naming the image they were copied from.
+const TAG_SOURCE_IMAGE = "orion:source-image"
+
+// TAG_SOURCE_REGION Tag on AMI copies naming the region they were copied from.
+const TAG_SOURCE_REGION = "orion:source-region"
+
+// AMI_COPY_TIMEOUT_MINUTES How long to wait for an AMI copy to become available.
+const AMI_COPY_TIMEOUT_MINUTES = 60
+
+// copyDescriptionPattern  The description CopyDescription gives AMI copies.  The source image and region are captured.
+var copyDescriptionPattern = regexp.MustCompile(`^Copy of (ami-[0-9a-f]+) from ([a-z0-9-]+)$`)
+
+// instanceFamilyPattern  Splits an instance family into its class, generation, and attributes.  e.g. c6gn is class c, generation 6, attributes gn.
+var instanceFamilyPattern = regexp.MustCompile(`^([a-z]+)(\d+)([a-z-]*)$`)
+
+// Architecture guesses the CPU architecture of an instance type from its family.  Graviton families carry a 'g' in their attributes, e.g. m6g, c6gn, t4g and im4gn, as does a1.  GPU families like g4dn start with a 'g', but are x86_64.
+func Architecture(instanceType string) (arch string) {
+	family := strings.ToLower(strings.SplitN(instanceType, ".", 2)[0])
+
+	if family == "a1" {
+		return ARCH_ARM64
+	}
+
+	parts := instanceFamilyPattern.FindStringSubmatch(family)
+	if parts != nil && strings.Contains(parts[3], "g") {
+		return ARCH_ARM64
+	}
+
+	return ARCH_X86_64
+}
+
+// CheckImageArchitecture checks an image can boot on the instance type.
+func CheckImageArchitecture(image *ec2.Image, instanceType string) (err error) {
+	arch := Architecture(instanceType)
+
+	if aws.StringValue(image.Architecture) != arch {
+		err = errors.New(fmt.Sprintf("AMI %s is %s, but %s needs %s", aws.StringValue(image.ImageId), aws.StringValue(image.Architecture), instanceType, arch))
+		return err
+	}
+
+	return err
+}
+
+// SortImages sorts images newest first, with ties broken by ID.
+func SortImages(images []*ec2.Image) {
+	sort.SliceStable(images, func(i, j int) bool {
+		a := aws.StringValue(images[i].CreationDate)
+		b := aws.StringValue(images[j].CreationDate)
+
+		if a != b {
+			return a > b
+		}
+
+		return aws.StringValue(images[i].ImageId) < aws.StringValue(images[j].ImageId)
+	})
+}
+
+// DescribeAmis lists the images owned by the Orion account whose names match pattern, newest first.  If arch is set, only images of that architecture are listed.
+func (s *Stack) DescribeAmis(pattern string, arch string) (images []*ec2.Image, err error) {
+	client := ec2.New(s.AwsSession)
+
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("name"),
+			Values: []*string{aws.String(pattern)},
+		},
+	}
+
+	if arch != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("architecture"),
+			Values: []*string{aws.String(arch)},
+		})
+	}
+
+	output, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners:  []*string{aws.String(orionAccount)},
+		Filters: filters,
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing images")
+		return images, err
+	}
+
+	images = output.Images
+
+	SortImages(images)
+
+	return images, err
+}
+
+// CheckAmi checks the stack has a usable base AMI, without copying anything.  An image that would be copied from ami_source_region counts.
+func (s *Stack) CheckAmi() (detail string, err error) {
+	id, err := s.LocalAmiID()
+	if err != nil {
+		return detail, err
+	}
+
+	if id != "" {
+		detail = fmt.Sprintf("%s -> %s", s.Config.AMIName, id)
+		if s.Config.AMIID != "" {
+			detail = fmt.Sprintf("%s (pinned)", id)
+		}
+
+		return detail, err
+	}
+
+	if s.Config.AMISourceRegion == "" {
+		err = errors.New("no ami found")
+		return detail, err
+	}
+
+	source, err := s.FindSourceAmi()
+	if err != nil {
+		return detail, err
+	}
+
+	detail = fmt.Sprintf("%s will be copied from %s", aws.StringValue(source.ImageId), s.Config.AMISourceRegion)
+
+	return detail, err
+}
+
+// DescribeAmi describes a single image by ID.
+func (s *Stack) DescribeAmi(id string) (image *ec2.Image, err error) {
+	client := ec2.New(s.AwsSession)
+
+	output, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(id)},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing image %s", id)
+		return image, err
+	}
+
+	if len(output.Images) == 0 {
+		err = errors.New(fmt.Sprintf("AMI %s not found", id))
+		return image, err
+	}
+
+	image = output.Images[0]
+
+	return image, err
+}
+
+// ImageTag returns the value of an image's tag, or an empty string if it isn't set.
+func ImageTag(image *ec2.Image, key string) (value string) {
+	for _, t := range image.Tags {
+		if aws.StringValue(t.Key) == key {
+			return aws.StringValue(t.Value)
+		}
+	}
+
+	return value
+}
+
+// StaleCopies returns the AMI copies that can be removed: those no instance uses, other than the newest copy of each architecture, which the next create would reuse.
+func StaleCopies(copies []*ec2.Image, inUse []string) (stale []*ec2.Image) {
+	stale = make([]*ec2.Image, 0)
+
+	sorted := make([]*ec2.Image, len(copies))
+	copy(sorted, copies)
+
+	SortImages(sorted)
+
+	newest := make(map[string]bool)
+
+	for _, i := range sorted {
+		arch := aws.StringValue(i.Architecture)
+		if !newest[arch] {
+			newest[arch] = true
+			continue
+		}
+
+		if StringInSlice(aws.StringValue(i.ImageId), inUse) {
+			continue
+		}
+
+		stale = append(stale, i)
+	}
+
+	return stale
+}
+
+// FindSourceAmi finds the base AMI in ami_source_region: ami_id if pinned, otherwise the newest match of ami_name suiting the instance type.
+func (s *Stack) FindSourceAmi() (image *ec2.Image, err error) {
+	source := &Stack{
+		Config:     s.Config,
+		AwsSession: s.AwsSession.Copy(&aws.Config{Region: aws.String(s.Config.AMISourceRegion)}),
+	}
+
+	if s.Config.AMIID != "" {
+		image, err = source.DescribeAmi(s.Config.AMIID)
+		if err != nil {
+			err = errors.Wrapf(err, "failed finding AMI in %s", s.Config.AMISourceRegion)
+			return image, err
+		}
+
+		err = CheckImageArchitecture(image, s.Config.InstanceType)
+
+		return image, err
+	}
+
+	images, err := source.DescribeAmis(s.Config.AMIName, Architecture(s.Config.InstanceType))
+	if err != nil {
+		err = errors.Wrapf(err, "failed listing AMI's in %s", s.Config.AMISourceRegion)
+		return image, err
+	}
+
+	if len(images) == 0 {
+		err = errors.New(fmt.Sprintf("no ami named %s found in %s either", s.Config.AMIName, s.Config.AMISourceRegion))
+		return image, err
+	}
+
+	image = images[0]
+
+	return image, err
+}
+
+// AmiCopies lists the AMI copies ops has made in the stack's region, newest first.  If sourceID is set, only copies of that image are listed.
+func (s *Stack) AmiCopies(sourceID string) (images []*ec2.Image, err error) {
+	client := ec2.New(s.AwsSession)
+
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", TAG_MANAGED_BY)),
+			Values: []*string{aws.String(MANAGED_BY_OPS)},
+		},
+		{
+			Name:   aws.String("tag-key"),
+			Values: []*string{aws.String(TAG_SOURCE_IMAGE)},
+		},
+	}
+
+	if sourceID != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", TAG_SOURCE_IMAGE)),
+			Values: []*string{aws.String(sourceID)},
+		})
+	}
+
+	output, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners:  []*string{aws.String("self")},
+		Filters: filters,
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing AMI copies")
+		return images, err
+	}
+
+	images = output.Images
+
+	SortImages(images)
+
+	return images, err
+}
+
+// CopyDescription returns the description an AMI copy of sourceID from sourceRegion is given.  Should tagging the copy fail, it's found by this instead.
+func CopyDescription(sourceID string, sourceRegion string) (description string) {
+	description = fmt.Sprintf("Copy of %s from %s", sourceID, sourceRegion)
+
+	return description
+}
+
+// ParseCopyDescription returns the source image and region from the description of an AMI copy.  ok is false if it isn't one.
+func ParseCopyDescription(description string) (sourceID string, sourceRegion string, ok bool) {
+	matches := copyDescriptionPattern.FindStringSubmatch(description)
+	if matches == nil {
+		return sourceID, sourceRegion, ok
+	}
+
+	sourceID = matches[1]
+	sourceRegion = matches[2]
+	ok = true
+
+	return sourceID, sourceRegion, ok
+}
+
+// CopyTags returns the tags an AMI copy is given, by which AmiCopies finds it.
+func CopyTags(name string, sourceID string, sourceRegion string) (tags []*ec2.Tag) {
+	tags = []*ec2.Tag{
+		{Key: aws.String("Name"), Value: aws.String(name)},
+		{Key: aws.String(TAG_SOURCE_IMAGE), Value: aws.String(sourceID)},
+		{Key: aws.String(TAG_SOURCE_REGION), Value: aws.String(sourceRegion)},
+		{Key: aws.String(TAG_MANAGED_BY), Value: aws.String(MANAGED_BY_OPS)},
+	}
+
+	return tags
+}
+
+// UntaggedAmiCopies lists AMI copies ops made, but never tagged, e.g. because it was interrupted between copying and tagging.  They're recognized by their description, and listed with the tags they should have, newest first.  If sourceID is set, only copies of that image are listed.
+func (s *Stack) UntaggedAmiCopies(sourceID string) (images []*ec2.Image, err error) {
+	images = make([]*ec2.Image, 0)
+
+	client := ec2.New(s.AwsSession)
+
+	pattern := sourceID
+	if pattern == "" {
+		pattern = "ami-*"
+	}
+
+	output, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: []*string{aws.String("self")},
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("description"),
+				Values: []*string{aws.String(CopyDescription(pattern, "*"))},
+			},
+		},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing untagged AMI copies")
+		return images, err
+	}
+
+	for _, i := range output.Images {
+		if ImageTag(i, TAG_SOURCE_IMAGE) != "" {
+			continue
+		}
+
+		source, region, ok := ParseCopyDescription(aws.StringValue(i.Description))
+		if !ok {
+			continue
+		}
+
+		i.Tags = append(i.Tags, CopyTags(aws.StringValue(i.Name), source, region)...)
+		images = append(images, i)
+	}
+
+	SortImages(images)
+
+	return images, err
+}
+
+// TagAmiCopies gives untagged AMI copies the tags UntaggedAmiCopies listed them with.
+func (s *Stack) TagAmiCopies(images []*ec2.Image) (err error) {
+	client := ec2.New(s.AwsSession)
+
+	for _, i := range images {
+		_, err = client.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{i.ImageId},
+			Tags:      i.Tags,
+		})
+		if err != nil {
+			err = errors.Wrapf(err, "failed tagging AMI copy %s", aws.StringValue(i.ImageId))
+			return err
+		}
+	}
+
+	return err
+}
+
+// CopyAmi copies the base AMI from ami_source_region into the stack's region, and waits for it to become available.  Copies are tagged with the image they came from, so a later create reuses an earlier copy instead of making another.
+func (s *Stack) CopyAmi() (id string, err error) {
+	source, err := s.FindSourceAmi()
+	if err != nil {
+		return id, err
+	}
+
+	sourceID := aws.StringValue(source.ImageId)
+
+	client := ec2.New(s.AwsSession)
+
+	copies, err := s.AmiCopies(sourceID)
+	if err != nil {
+		return id, err
+	}
+
+	// a copy an earlier run made, but didn't get to tag, is tagged now, and reused.
+	untagged, err := s.UntaggedAmiCopies(sourceID)
+	if err != nil {
+		return id, err
+	}
+
+	err = s.TagAmiCopies(untagged)
+	if err != nil {
+		return id, err
+	}
+
+	copies = append(copies, untagged...)
+
+	SortImages(copies)
+
+	for _, c := range copies {
+		state := aws.StringValue(c.State)
+		if state == ec2.ImageStateAvailable || state == ec2.ImageStatePending {
+			id = aws.StringValue(c.ImageId)
+			fmt.Printf("Using %s, copied from %s in %s\n", id, sourceID, s.Config.AMISourceRegion)
+			break
+		}
+	}
+
+	if id == "" {
+		fmt.Printf("Copying AMI %s (%s) from %s.  This can take a while.\n", sourceID, aws.StringValue(source.Name), s.Config.AMISourceRegion)
+
+		output, err := client.CopyImage(&ec2.CopyImageInput{
+			SourceImageId: aws.String(sourceID),
+			SourceRegion:  aws.String(s.Config.AMISourceRegion),
+			Name:          source.Name,
+			Description:   aws.String(CopyDescription(sourceID, s.Config.AMISourceRegion)),
+		})
+		if err != nil {
+			err = errors.Wrapf(err, "failed copying %s from %s", sourceID, s.Config.AMISourceRegion)
+			return id, err
+		}
+
+		id = aws.StringValue(output.ImageId)
+
+		// aws-sdk-go v1.37 can't tag the copy as it's made.  If this fails, the next run finds the copy by its description.
+		_, err = client.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{aws.String(id)},
+			Tags:      CopyTags(aws.StringValue(source.Name), sourceID, s.Config.AMISourceRegion),
+		})
+		if err != nil {
+			err = errors.Wrapf(err, "failed tagging AMI copy %s", id)
+			return id, err
+		}
+	}
+
+	fmt.Printf("Waiting for %s to become available.\n", id)
+
+	err = client.WaitUntilImageAvailableWithContext(aws.BackgroundContext(), &ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(id)},
+	}, request.WithWaiterDelay(request.ConstantWaiterDelay(30*time.Second)), request.WithWaiterMaxAttempts(AMI_COPY_TIMEOUT_MINUTES*2))
+	if err != nil {
+		err = errors.Wrapf(err, "failed waiting for AMI copy %s", id)
+		return id, err
+	}
+
+	return id, err
+}
+
+// ImagesInUse lists the images of every instance in the stack's region that hasn't been terminated.
+func (s *Stack) ImagesInUse() (ids []string, err error) {
+	ids = make([]string, 0)
+
+	client := ec2.New(s.AwsSession)
+
+	err = client.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"}),
+			},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			for _, i := range r.Instances {
+				if !StringInSlice(aws.StringValue(i.ImageId), ids) {
+					ids = append(ids, aws.StringValue(i.ImageId))
+				}
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing instances")
+		return ids, err
+	}
+
+	return ids, err
+}
+
+// PruneAmiCopies deregisters stale AMI copies, and deletes their snapshots.  See StaleCopies.  Copies that were never tagged count, and are tagged first.  With dryRun, the stale copies are only listed.
+func (s *Stack) PruneAmiCopies(dryRun bool) (pruned []*ec2.Image, err error) {
+	copies, err := s.AmiCopies("")
+	if err != nil {
+		return pruned, err
+	}
+
+	untagged, err := s.UntaggedAmiCopies("")
+	if err != nil {
+		return pruned, err
+	}
+
+	if !dryRun {
+		err = s.TagAmiCopies(untagged)
+		if err != nil {
+			return pruned, err
+		}
+	}
+
+	copies = append(copies, untagged...)
+
+	inUse, err := s.ImagesInUse()
+	if err != nil {
+		return pruned, err
+	}
+
+	pruned = StaleCopies(copies, inUse)
+
+	if dryRun {
+		return pruned, err
+	}
+
+	client := ec2.New(s.AwsSession)
+
+	for _, i := range pruned {
+		_, err = client.DeregisterImage(&ec2.DeregisterImageInput{ImageId: i.ImageId})
+		if err != nil {
+			err = errors.Wrapf(err, "failed deregistering %s", aws.StringValue(i.ImageId))
+			return pruned, err
+		}
+
+		for _, m := range i.BlockDeviceMappings {
+			if m.Ebs == nil || m.Ebs.SnapshotId == nil {
+				continue
+			}
+
+			_, err = client.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: m.Ebs.SnapshotId})
+			if err != nil {
+				err = errors.Wrapf(err, "failed deleting snapshot %s of %s", aws.StringValue(m.Ebs.SnapshotId), aws.StringValue(i.ImageId))
+				return pruned, err
+			}
+		}
+	}
+
+	return pruned, err
+}
@@ -0,0 +1,120 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestArchitecture(t *testing.T) {
+	cases := []struct {
+		instanceType string
+		arch         string
+	}{
+		{"m5.2xlarge", ARCH_X86_64},
+		{"m6g.2xlarge", ARCH_ARM64},
+		{"c6gn.large", ARCH_ARM64},
+		{"r6gd.xlarge", ARCH_ARM64},
+		{"t4g.micro", ARCH_ARM64},
+		{"im4gn.large", ARCH_ARM64},
+		{"a1.large", ARCH_ARM64},
+		{"g4dn.xlarge", ARCH_X86_64},
+		{"g5.xlarge", ARCH_X86_64},
+		{"m6i.large", ARCH_X86_64},
+		{"m5ad.large", ARCH_X86_64},
+		{"", ARCH_X86_64},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.instanceType, func(t *testing.T) {
+			assert.Equal(t, tc.arch, Architecture(tc.instanceType), "architecture doesn't meet expectations")
+		})
+	}
+}
+
+func TestCheckImageArchitecture(t *testing.T) {
+	image := &ec2.Image{ImageId: aws.String("ami-1"), Architecture: aws.String(ARCH_X86_64)}
+
+	assert.NoError(t, CheckImageArchitecture(image, "m5.2xlarge"), "x86_64 image on x86_64 instance")
+
+	err := CheckImageArchitecture(image, "m6g.2xlarge")
+	if assert.Error(t, err, "x86_64 image on a Graviton instance") {
+		assert.Equal(t, "AMI ami-1 is x86_64, but m6g.2xlarge needs arm64", err.Error(), "error doesn't meet expectations")
+	}
+}
+
+func TestSortImages(t *testing.T) {
+	images := []*ec2.Image{
+		{ImageId: aws.String("ami-old"), CreationDate: aws.String("2021-01-01T00:00:00.000Z")},
+		{ImageId: aws.String("ami-new-b"), CreationDate: aws.String("2021-03-01T00:00:00.000Z")},
+		{ImageId: aws.String("ami-mid"), CreationDate: aws.String("2021-02-01T00:00:00.000Z")},
+		{ImageId: aws.String("ami-new-a"), CreationDate: aws.String("2021-03-01T00:00:00.000Z")},
+	}
+
+	SortImages(images)
+
+	ids := make([]string, 0)
+	for _, i := range images {
+		ids = append(ids, aws.StringValue(i.ImageId))
+	}
+
+	assert.Equal(t, []string{"ami-new-a", "ami-new-b", "ami-mid", "ami-old"}, ids, "order doesn't meet expectations")
+}
+
+func TestStaleCopies(t *testing.T) {
+	copies := []*ec2.Image{
+		{ImageId: aws.String("ami-x1"), Architecture: aws.String(ARCH_X86_64), CreationDate: aws.String("2021-01-01T00:00:00.000Z")},
+		{ImageId: aws.String("ami-x3"), Architecture: aws.String(ARCH_X86_64), CreationDate: aws.String("2021-03-01T00:00:00.000Z")},
+		{ImageId: aws.String("ami-x2"), Architecture: aws.String(ARCH_X86_64), CreationDate: aws.String("2021-02-01T00:00:00.000Z")},
+		{ImageId: aws.String("ami-a1"), Architecture: aws.String(ARCH_ARM64), CreationDate: aws.String("2021-01-01T00:00:00.000Z")},
+	}
+
+	ids := make([]string, 0)
+	for _, i := range StaleCopies(copies, []string{"ami-x1"}) {
+		ids = append(ids, aws.StringValue(i.ImageId))
+	}
+
+	assert.Equal(t, []string{"ami-x2"}, ids, "stale copies don't meet expectations")
+	assert.Equal(t, "ami-x1", aws.StringValue(copies[0].ImageId), "input order should be left alone")
+}
+
+func TestImageTag(t *testing.T) {
+	image := &ec2.Image{Tags: []*ec2.Tag{{Key: aws.String(TAG_SOURCE_IMAGE), Value: aws.String("ami-src")}}}
+
+	assert.Equal(t, "ami-src", ImageTag(image, TAG_SOURCE_IMAGE), "tag doesn't meet expectations")
+	assert.Equal(t, "", ImageTag(image, TAG_SOURCE_REGION), "missing tag should be empty")
+}
+
+func TestParseCopyDescription(t *testing.T) {
+	cases := []struct {
+		name         string
+		description  string
+		sourceID     string
+		sourceRegion string
+		ok           bool
+	}{
+		{"copy", CopyDescription("ami-0123456789abcdef0", "us-east-1"), "ami-0123456789abcdef0", "us-east-1", true},
+		{"govcloud", CopyDescription("ami-0123abcd", "us-gov-west-1"), "ami-0123abcd", "us-gov-west-1", true},
+		{"console copy", "[Copied ami-0123abcd from us-east-1] orion-base", "", "", false},
+		{"empty", "", "", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sourceID, sourceRegion, ok := ParseCopyDescription(tc.description)
+			assert.Equal(t, tc.ok, ok, "ok doesn't meet expectations")
+			assert.Equal(t, tc.sourceID, sourceID, "source image doesn't meet expectations")
+			assert.Equal(t, tc.sourceRegion, sourceRegion, "source region doesn't meet expectations")
+		})
+	}
+}
+
+func TestCopyTags(t *testing.T) {
+	image := &ec2.Image{Tags: CopyTags("orion-base-1", "ami-0123abcd", "us-east-1")}
+
+	assert.Equal(t, "orion-base-1", ImageTag(image, "Name"), "name tag doesn't meet expectations")
+	assert.Equal(t, "ami-0123abcd", ImageTag(image, TAG_SOURCE_IMAGE), "source image tag doesn't meet expectations")
+	assert.Equal(t, "us-east-1", ImageTag(image, TAG_SOURCE_REGION), "source region tag doesn't meet expectations")
+	assert.Equal(t, MANAGED_BY_OPS, ImageTag(image, TAG_MANAGED_BY), "managed by tag doesn't meet expectations")
+}
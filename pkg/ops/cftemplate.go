@@ -0,0 +1,577 @@
+package ops
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// MAX_TEMPLATE_BODY_SIZE Largest template, in bytes, CloudFormation accepts as a TemplateBody.  Bigger ones have to be staged in S3.
+const MAX_TEMPLATE_BODY_SIZE = 51200
+
+// TEMPLATE_STAGING_PREFIX Key prefix under which oversized local templates are staged in template_bucket.
+const TEMPLATE_STAGING_PREFIX = "ops-templates"
+
+// managedParameters  CloudFormation template parameters that ops computes from the config.  They can't be set with parameter_overrides.  The value is the config key that controls the parameter.
+var managedParameters = map[string]string{
+	"ExistingVpcID":        "subnet_ids",
+	"ExistingPublicSubnet": "subnet_ids",
+	"KeyName":              "key_name",
+	"AmiId":                "ami_name",
+	"InstanceType":         "instance_type",
+	"CreateDNSZoneID":      "dns_domain",
+	"CreateDNSDomain":      "dns_domain",
+}
+
+// defaultParameters  Template parameters ops sets to a default value of its own.  Unlike managedParameters, these can be changed with parameter_overrides.
+var defaultParameters = map[string]string{
+	"VolumeSize":   strconv.Itoa(DEFAULT_VOLUME_SIZE),
+	"InstanceName": DEFAULT_INSTANCE_NAME,
+	"CreateDNS":    "true",
+}
+
+// CFTemplate  A CloudFormation template, as far as ops cares.  Resources aren't parsed.
+type CFTemplate struct {
+	Description string                         `yaml:"Description"`
+	Parameters  map[string]CFTemplateParameter `yaml:"Parameters"`
+	Outputs     map[string]CFTemplateOutput    `yaml:"Outputs"`
+	Metadata    CFTemplateMetadata             `yaml:"Metadata"`
+}
+
+// CFTemplateOutput  An output declared in a CloudFormation template.  Values are usually intrinsic functions (!GetAtt, !Sub ...), so they're kept as raw yaml.
+type CFTemplateOutput struct {
+	Description string    `yaml:"Description"`
+	Value       yaml.Node `yaml:"Value"`
+	Export      yaml.Node `yaml:"Export"`
+	Condition   string    `yaml:"Condition"`
+}
+
+// CFTemplateMetadata  The template's Metadata section.  Only the console's parameter grouping is parsed.
+type CFTemplateMetadata struct {
+	Interface CFTemplateInterface `yaml:"AWS::CloudFormation::Interface"`
+}
+
+// CFTemplateInterface  How the CloudFormation console groups and labels parameters.
+type CFTemplateInterface struct {
+	ParameterGroups []struct {
+		Label struct {
+			Default string `yaml:"default"`
+		} `yaml:"Label"`
+		Parameters []string `yaml:"Parameters"`
+	} `yaml:"ParameterGroups"`
+	ParameterLabels map[string]struct {
+		Default string `yaml:"default"`
+	} `yaml:"ParameterLabels"`
+}
+
+// CFTemplateParameter  A parameter declared in a CloudFormation template, with its constraints.
+type CFTemplateParameter struct {
+	Type           string   `yaml:"Type"`
+	Default        *string  `yaml:"Default"`
+	Description    string   `yaml:"Description"`
+	AllowedValues  []string `yaml:"AllowedValues"`
+	AllowedPattern string   `yaml:"AllowedPattern"`
+	MinLength      *int     `yaml:"MinLength"`
+	MaxLength      *int     `yaml:"MaxLength"`
+	MinValue       *float64 `yaml:"MinValue"`
+	MaxValue       *float64 `yaml:"MaxValue"`
+}
+
+// TemplateSource  Where a stack's CloudFormation template comes from.  Exactly one of URL or Path is set.
+type TemplateSource struct {
+	Location  string // as configured
+	URL       string // https url CloudFormation fetches the template from itself
+	Bucket    string // set for templates in S3
+	Key       string
+	VersionID string
+	Path      string // set for local files
+}
+
+// ParseTemplateSource parses a template location: an https url, an s3://bucket/key url optionally pinned with ?versionId=..., or a local file.
+func ParseTemplateSource(location string) (source TemplateSource, err error) {
+	source = TemplateSource{Location: location}
+
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		u, e := url.Parse(location)
+		if e != nil {
+			err = errors.Wrapf(e, "failed parsing %s", location)
+			return source, err
+		}
+
+		source.Bucket = u.Host
+		source.Key = strings.TrimPrefix(u.Path, "/")
+		source.VersionID = u.Query().Get("versionId")
+
+		if source.Bucket == "" || source.Key == "" {
+			err = errors.New(fmt.Sprintf("%s is not of the form s3://bucket/key", location))
+			return source, err
+		}
+
+		source.URL = fmt.Sprintf("https://%s.s3.amazonaws.com/%s", source.Bucket, source.Key)
+		if source.VersionID != "" {
+			source.URL = fmt.Sprintf("%s?versionId=%s", source.URL, url.QueryEscape(source.VersionID))
+		}
+
+	case strings.HasPrefix(location, "https://"):
+		source.URL = location
+
+	case strings.HasPrefix(location, "http://"):
+		err = errors.New(fmt.Sprintf("template url %s must use https", location))
+		return source, err
+
+	default:
+		path, e := homedir.Expand(location)
+		if e != nil {
+			err = errors.Wrapf(e, "failed expanding %s", location)
+			return source, err
+		}
+
+		source.Path = path
+	}
+
+	return source, err
+}
+
+// TemplateSource returns the source of the stack's CloudFormation template: template_url if set, and DEFAULT_TEMPLATE_URL otherwise.
+func (s *Stack) TemplateSource() (source TemplateSource, err error) {
+	location := s.Config.TemplateURL
+	if location == "" {
+		location = DEFAULT_TEMPLATE_URL
+	}
+
+	source, err = ParseTemplateSource(location)
+
+	return source, err
+}
+
+// TemplateBody fetches the content of the stack's CloudFormation template, wherever it lives.
+func (s *Stack) TemplateBody() (body []byte, err error) {
+	source, err := s.TemplateSource()
+	if err != nil {
+		return body, err
+	}
+
+	switch {
+	case source.Path != "":
+		body, err = ioutil.ReadFile(source.Path)
+		if err != nil {
+			err = errors.Wrapf(err, "failed reading template %s", source.Path)
+			return body, err
+		}
+
+	case source.Bucket != "":
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(source.Bucket),
+			Key:    aws.String(source.Key),
+		}
+
+		if source.VersionID != "" {
+			input.VersionId = aws.String(source.VersionID)
+		}
+
+		output, err := s3.New(s.AwsSession).GetObject(input)
+		if err != nil {
+			err = errors.Wrapf(err, "failed fetching template %s", source.Location)
+			return body, err
+		}
+
+		defer output.Body.Close()
+
+		body, err = ioutil.ReadAll(output.Body)
+		if err != nil {
+			err = errors.Wrapf(err, "failed reading template %s", source.Location)
+			return body, err
+		}
+
+	default:
+		resp, err := http.Get(source.URL)
+		if err != nil {
+			err = errors.Wrapf(err, "error getting %s", source.URL)
+			return body, err
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			err = errors.New(fmt.Sprintf("error getting %s: %s", source.URL, resp.Status))
+			return body, err
+		}
+
+		body, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			err = errors.Wrapf(err, "failed reading response body")
+			return body, err
+		}
+	}
+
+	return body, err
+}
+
+// ApplyTemplate points the stack input at the stack's CloudFormation template.  Urls are passed through.  Local files are sent as the template body, or, if they're too big for that, uploaded to template_bucket first.
+func (s *Stack) ApplyTemplate(input *cloudformation.CreateStackInput) (err error) {
+	source, err := s.TemplateSource()
+	if err != nil {
+		return err
+	}
+
+	if source.Path == "" {
+		input.TemplateURL = aws.String(source.URL)
+		return err
+	}
+
+	body, err := s.TemplateBody()
+	if err != nil {
+		return err
+	}
+
+	if len(body) <= MAX_TEMPLATE_BODY_SIZE {
+		input.TemplateBody = aws.String(string(body))
+		return err
+	}
+
+	if s.Config.TemplateBucket == "" {
+		err = errors.New(fmt.Sprintf("template %s is %d bytes, more than the %d CloudFormation accepts directly.  Set template_bucket to stage it in S3", source.Path, len(body), MAX_TEMPLATE_BODY_SIZE))
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	key := fmt.Sprintf("%s/%s/%x-%s", TEMPLATE_STAGING_PREFIX, s.Config.StackName, sum[:8], filepath.Base(source.Path))
+
+	fmt.Printf("Staging template %s in s3://%s/%s\n", source.Path, s.Config.TemplateBucket, key)
+
+	output, err := s3manager.NewUploader(s.AwsSession).Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.Config.TemplateBucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(body),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed staging template in %s", s.Config.TemplateBucket)
+		return err
+	}
+
+	input.TemplateURL = aws.String(output.Location)
+
+	return err
+}
+
+// StagedTemplateKey returns the key of the template_bucket object ApplyTemplate staged a template in, or "" if the url doesn't point at one.
+func StagedTemplateKey(templateURL string) (key string) {
+	u, err := url.Parse(templateURL)
+	if err != nil {
+		return key
+	}
+
+	i := strings.Index(u.Path, "/"+TEMPLATE_STAGING_PREFIX+"/")
+	if i < 0 {
+		return key
+	}
+
+	key = u.Path[i+1:]
+
+	return key
+}
+
+// RemoveStagedTemplate deletes the template ApplyTemplate staged in template_bucket for the input, if it staged one.  CloudFormation keeps its own copy once CreateStack or ValidateTemplate returns, so the object is only needed until then.
+func (s *Stack) RemoveStagedTemplate(input *cloudformation.CreateStackInput) (err error) {
+	key := StagedTemplateKey(aws.StringValue(input.TemplateURL))
+	if s.Config.TemplateBucket == "" || key == "" {
+		return err
+	}
+
+	_, err = s3.New(s.AwsSession).DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.Config.TemplateBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed removing staged template s3://%s/%s", s.Config.TemplateBucket, key)
+		return err
+	}
+
+	return err
+}
+
+// FetchTemplate fetches and parses the stack's CloudFormation template.
+func (s *Stack) FetchTemplate() (template *CFTemplate, err error) {
+	body, err := s.TemplateBody()
+	if err != nil {
+		return template, err
+	}
+
+	template, err = ParseTemplate(body)
+
+	return template, err
+}
+
+// ParseTemplate parses a CloudFormation template.
+func ParseTemplate(body []byte) (template *CFTemplate, err error) {
+	template = &CFTemplate{}
+
+	err = yaml.Unmarshal(body, template)
+	if err != nil {
+		err = errors.Wrapf(err, "failed unmarshalling CF yaml.")
+		return template, err
+	}
+
+	return template, err
+}
+
+// ParameterNames returns the names of the template's parameters, sorted.
+func (t *CFTemplate) ParameterNames() (names []string) {
+	names = make([]string, 0)
+
+	for name := range t.Parameters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// OutputNames returns the names of the template's outputs, sorted.
+func (t *CFTemplate) OutputNames() (names []string) {
+	names = make([]string, 0)
+
+	for name := range t.Outputs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ParameterGroup returns the console group label of the named parameter, if the template groups its parameters.
+func (t *CFTemplate) ParameterGroup(name string) (group string) {
+	for _, g := range t.Metadata.Interface.ParameterGroups {
+		if StringInSlice(name, g.Parameters) {
+			return g.Label.Default
+		}
+	}
+
+	return group
+}
+
+// ParameterRole describes how ops treats a template parameter: computed from the config, set to a default of ops' own, or left to the template.  Only the latter two can be changed with parameter_overrides.
+func ParameterRole(name string) (role string) {
+	if field, ok := managedParameters[name]; ok {
+		return fmt.Sprintf("managed (from %s)", field)
+	}
+
+	if value, ok := defaultParameters[name]; ok {
+		return fmt.Sprintf("overridable (ops sets %s)", value)
+	}
+
+	return "overridable"
+}
+
+// PrintTemplateParameters prints a table of the template's parameters.
+func PrintTemplateParameters(t *CFTemplate) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "PARAMETER\tTYPE\tDEFAULT\tALLOWED\tSET BY\tDESCRIPTION\n")
+
+	for _, name := range t.ParameterNames() {
+		p := t.Parameters[name]
+
+		def := "(required)"
+		if p.Default != nil {
+			def = *p.Default
+		}
+
+		allowed := strings.Join(p.AllowedValues, ",")
+		if allowed == "" && p.AllowedPattern != "" {
+			allowed = p.AllowedPattern
+		}
+
+		description := p.Description
+		if group := t.ParameterGroup(name); group != "" {
+			description = fmt.Sprintf("[%s] %s", group, description)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", name, p.Type, def, allowed, ParameterRole(name), strings.TrimSpace(description))
+	}
+
+	_ = w.Flush()
+}
+
+// StackParameters merges the parameter overrides from the config over the computed parameters.  Overrides of computed parameters keep their position, and new ones are appended in name order.
+func (c *StackConfig) StackParameters(computed []*cloudformation.Parameter) (params []*cloudformation.Parameter, err error) {
+	params = computed
+
+	keys := make([]string, 0)
+	for k := range c.ParameterOverrides {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	problems := make([]string, 0)
+
+	for _, k := range keys {
+		if field, ok := managedParameters[k]; ok {
+			problems = append(problems, fmt.Sprintf("parameter %s is managed by ops.  Set %s instead", k, field))
+			continue
+		}
+
+		found := false
+		for _, p := range params {
+			if aws.StringValue(p.ParameterKey) == k {
+				p.ParameterValue = aws.String(c.ParameterOverrides[k])
+				found = true
+			}
+		}
+
+		if !found {
+			params = append(params, &cloudformation.Parameter{
+				ParameterKey:   aws.String(k),
+				ParameterValue: aws.String(c.ParameterOverrides[k]),
+			})
+		}
+	}
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return params, err
+	}
+
+	return params, err
+}
+
+// ValidateParameters checks stack parameters against the template's Parameters section: every parameter must be declared, required parameters must be set, and values must meet the declared constraints.  All problems are reported together.
+func (t *CFTemplate) ValidateParameters(params []*cloudformation.Parameter) (err error) {
+	problems := make([]string, 0)
+
+	declared := make([]string, 0)
+	for name := range t.Parameters {
+		declared = append(declared, name)
+	}
+
+	sort.Strings(declared)
+
+	set := make(map[string]string)
+
+	for _, p := range params {
+		key := aws.StringValue(p.ParameterKey)
+		value := aws.StringValue(p.ParameterValue)
+		set[key] = value
+
+		tp, ok := t.Parameters[key]
+		if !ok {
+			problem := fmt.Sprintf("parameter %s is not declared by the template", key)
+			suggestion := Suggest(key, declared)
+			if suggestion != "" {
+				problem = fmt.Sprintf("%s (did you mean %s?)", problem, suggestion)
+			}
+
+			problems = append(problems, problem)
+			continue
+		}
+
+		e := tp.Check(value)
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("parameter %s: %s", key, e))
+		}
+	}
+
+	for _, name := range declared {
+		if _, ok := set[name]; !ok && t.Parameters[name].Default == nil {
+			problems = append(problems, fmt.Sprintf("parameter %s is required by the template, but not set", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// Check checks a value against the parameter's declared type and constraints.
+func (p CFTemplateParameter) Check(value string) (err error) {
+	if len(p.AllowedValues) > 0 && !StringInSlice(value, p.AllowedValues) {
+		err = errors.New(fmt.Sprintf("%q is not one of %s", value, strings.Join(p.AllowedValues, ", ")))
+		return err
+	}
+
+	switch p.Type {
+	case "Number":
+		err = p.checkNumber(value)
+		if err != nil {
+			return err
+		}
+
+	case "List<Number>":
+		for _, item := range strings.Split(value, ",") {
+			err = p.checkNumber(strings.TrimSpace(item))
+			if err != nil {
+				return err
+			}
+		}
+
+	case "String":
+		if p.AllowedPattern != "" {
+			re, e := regexp.Compile(fmt.Sprintf("^(?:%s)$", p.AllowedPattern))
+			if e != nil {
+				err = errors.Wrapf(e, "template has an invalid AllowedPattern")
+				return err
+			}
+
+			if !re.MatchString(value) {
+				err = errors.New(fmt.Sprintf("%q does not match %s", value, p.AllowedPattern))
+				return err
+			}
+		}
+
+		if p.MinLength != nil && len(value) < *p.MinLength {
+			err = errors.New(fmt.Sprintf("%q is shorter than %d characters", value, *p.MinLength))
+			return err
+		}
+
+		if p.MaxLength != nil && len(value) > *p.MaxLength {
+			err = errors.New(fmt.Sprintf("%q is longer than %d characters", value, *p.MaxLength))
+			return err
+		}
+	}
+
+	return err
+}
+
+// checkNumber checks that value is a number within the parameter's bounds.
+func (p CFTemplateParameter) checkNumber(value string) (err error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("%q is not a number", value))
+		return err
+	}
+
+	if p.MinValue != nil && n < *p.MinValue {
+		err = errors.New(fmt.Sprintf("%s is less than %v", value, *p.MinValue))
+		return err
+	}
+
+	if p.MaxValue != nil && n > *p.MaxValue {
+		err = errors.New(fmt.Sprintf("%s is more than %v", value, *p.MaxValue))
+		return err
+	}
+
+	return err
+}
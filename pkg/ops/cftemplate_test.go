@@ -0,0 +1,291 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const testCFTemplate = `AWSTemplateFormatVersion: "2010-09-09"
+Description: Orion PTT System
+Metadata:
+  AWS::CloudFormation::Interface:
+    ParameterGroups:
+      - Label:
+          default: Instance
+        Parameters:
+          - VolumeSize
+          - InstanceName
+Parameters:
+  KeyName:
+    Type: AWS::EC2::KeyPair::KeyName
+  VolumeSize:
+    Type: Number
+    Default: 50
+    MinValue: 20
+    MaxValue: 1000
+  InstanceName:
+    Type: String
+    Default: orion-ptt-system
+    AllowedPattern: "[a-z][a-z0-9-]*"
+    MaxLength: 20
+  CreateDNS:
+    Type: String
+    Default: "true"
+    AllowedValues:
+      - "true"
+      - "false"
+Resources:
+  Instance:
+    Type: AWS::EC2::Instance
+    Properties:
+      KeyName: !Ref KeyName
+Outputs:
+  Address:
+    Description: instance address
+    Value: !GetAtt Instance.PublicDnsName
+  Api:
+    Value: !Sub "https://api.${AWS::StackName}"
+    Export:
+      Name: !Sub "${AWS::StackName}-api"
+`
+
+func testParams(pairs ...string) (params []*cloudformation.Parameter) {
+	params = make([]*cloudformation.Parameter, 0)
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		params = append(params, &cloudformation.Parameter{
+			ParameterKey:   aws.String(pairs[i]),
+			ParameterValue: aws.String(pairs[i+1]),
+		})
+	}
+
+	return params
+}
+
+func TestParseTemplate(t *testing.T) {
+	template, err := ParseTemplate([]byte(testCFTemplate))
+	if err != nil {
+		t.Errorf("failed parsing template: %s", err)
+	}
+
+	assert.Equal(t, "Orion PTT System", template.Description, "description doesn't meet expectations")
+	assert.Equal(t, []string{"CreateDNS", "InstanceName", "KeyName", "VolumeSize"}, template.ParameterNames(), "parameters don't meet expectations")
+	assert.Equal(t, "50", *template.Parameters["VolumeSize"].Default, "number default doesn't meet expectations")
+	assert.Equal(t, []string{"Address", "Api"}, template.OutputNames(), "outputs don't meet expectations")
+	assert.Equal(t, "!GetAtt", template.Outputs["Address"].Value.Tag, "intrinsic function not kept")
+	assert.Equal(t, "Instance", template.ParameterGroup("VolumeSize"), "parameter group doesn't meet expectations")
+	assert.Equal(t, "", template.ParameterGroup("KeyName"), "ungrouped parameter should have no group")
+
+	assert.Equal(t, "managed (from key_name)", ParameterRole("KeyName"), "managed role doesn't meet expectations")
+	assert.Equal(t, "overridable (ops sets 50)", ParameterRole("VolumeSize"), "default role doesn't meet expectations")
+	assert.Equal(t, "overridable", ParameterRole("Whatever"), "overridable role doesn't meet expectations")
+}
+
+func TestStackParameters(t *testing.T) {
+	cases := []struct {
+		name      string
+		overrides map[string]string
+		expected  []*cloudformation.Parameter
+		err       bool
+	}{
+		{
+			"no overrides",
+			nil,
+			testParams("KeyName", "Nik", "VolumeSize", "50"),
+			false,
+		},
+		{
+			"override and add",
+			map[string]string{"VolumeSize": "100", "InstanceName": "demo"},
+			testParams("KeyName", "Nik", "VolumeSize", "100", "InstanceName", "demo"),
+			false,
+		},
+		{
+			"managed",
+			map[string]string{"KeyName": "someone-else"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := StackConfig{ParameterOverrides: tc.overrides}
+
+			params, err := config.StackParameters(testParams("KeyName", "Nik", "VolumeSize", "50"))
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, params, "parameters don't meet expectations")
+		})
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	template, err := ParseTemplate([]byte(testCFTemplate))
+	if err != nil {
+		t.Errorf("failed parsing template: %s", err)
+	}
+
+	cases := []struct {
+		name   string
+		params []*cloudformation.Parameter
+		err    string
+	}{
+		{
+			"valid",
+			testParams("KeyName", "Nik", "VolumeSize", "100", "InstanceName", "demo"),
+			"",
+		},
+		{
+			"missing required",
+			testParams("VolumeSize", "100"),
+			"parameter KeyName is required by the template, but not set",
+		},
+		{
+			"bad values",
+			testParams("KeyName", "Nik", "VolumeSize", "10", "InstanceName", "Demo", "CreateDNS", "yes"),
+			`parameter VolumeSize: 10 is less than 20; parameter InstanceName: "Demo" does not match [a-z][a-z0-9-]*; parameter CreateDNS: "yes" is not one of true, false`,
+		},
+		{
+			"not a number",
+			testParams("KeyName", "Nik", "VolumeSize", "big"),
+			`parameter VolumeSize: "big" is not a number`,
+		},
+		{
+			"undeclared",
+			testParams("KeyName", "Nik", "VolumeSise", "100"),
+			"parameter VolumeSise is not declared by the template (did you mean VolumeSize?)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := template.ValidateParameters(tc.params)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err, "expected an error") {
+				assert.Equal(t, tc.err, err.Error(), "error doesn't meet expectations")
+			}
+		})
+	}
+}
+
+func TestParseTemplateSource(t *testing.T) {
+	cases := []struct {
+		location string
+		expected TemplateSource
+		err      bool
+	}{
+		{
+			DEFAULT_TEMPLATE_URL,
+			TemplateSource{Location: DEFAULT_TEMPLATE_URL, URL: DEFAULT_TEMPLATE_URL},
+			false,
+		},
+		{
+			"s3://templates/orion/orion-ptt-system.yaml?versionId=abc123",
+			TemplateSource{
+				Location:  "s3://templates/orion/orion-ptt-system.yaml?versionId=abc123",
+				URL:       "https://templates.s3.amazonaws.com/orion/orion-ptt-system.yaml?versionId=abc123",
+				Bucket:    "templates",
+				Key:       "orion/orion-ptt-system.yaml",
+				VersionID: "abc123",
+			},
+			false,
+		},
+		{
+			"/tmp/orion-ptt-system.yaml",
+			TemplateSource{Location: "/tmp/orion-ptt-system.yaml", Path: "/tmp/orion-ptt-system.yaml"},
+			false,
+		},
+		{"s3://templates", TemplateSource{}, true},
+		{"http://example.com/orion-ptt-system.yaml", TemplateSource{}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.location, func(t *testing.T) {
+			source, err := ParseTemplateSource(tc.location)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, source, "template source doesn't meet expectations")
+		})
+	}
+}
+
+func TestApplyTemplateLocal(t *testing.T) {
+	small := fmt.Sprintf("%s/small-template.yaml", tmpDir)
+	large := fmt.Sprintf("%s/large-template.yaml", tmpDir)
+
+	err := ioutil.WriteFile(small, []byte(testCFTemplate), 0644)
+	if err != nil {
+		t.Errorf("failed writing template: %s", err)
+	}
+
+	err = ioutil.WriteFile(large, []byte(testCFTemplate+strings.Repeat("#", MAX_TEMPLATE_BODY_SIZE)), 0644)
+	if err != nil {
+		t.Errorf("failed writing template: %s", err)
+	}
+
+	s := &Stack{Config: &StackConfig{TemplateURL: small}}
+
+	input := cloudformation.CreateStackInput{}
+	err = s.ApplyTemplate(&input)
+	assert.NoError(t, err)
+	assert.Equal(t, testCFTemplate, aws.StringValue(input.TemplateBody), "small template not sent as the body")
+	assert.Nil(t, input.TemplateURL, "small template should not have a url")
+
+	s.Config.TemplateURL = large
+
+	err = s.ApplyTemplate(&cloudformation.CreateStackInput{})
+	assert.Error(t, err, "large template without a bucket should fail")
+}
+
+func TestStagedTemplateKey(t *testing.T) {
+	inputs := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			"virtual-hosted",
+			"https://bucket.s3.us-east-1.amazonaws.com/ops-templates/foo/0123456789abcdef-template.yaml",
+			"ops-templates/foo/0123456789abcdef-template.yaml",
+		},
+		{
+			"path-style",
+			"https://s3.amazonaws.com/bucket/ops-templates/foo/0123456789abcdef-my%20template.yaml",
+			"ops-templates/foo/0123456789abcdef-my template.yaml",
+		},
+		{
+			"not staged",
+			"https://bucket.s3.amazonaws.com/templates/template.yaml",
+			"",
+		},
+		{
+			"empty",
+			"",
+			"",
+		},
+	}
+
+	for _, tc := range inputs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, StagedTemplateKey(tc.url), "staged template key doesn't meet expectations")
+		})
+	}
+}
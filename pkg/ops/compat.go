@@ -0,0 +1,196 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"log"
+	"sort"
+	"strings"
+)
+
+// OUTPUT_ADDRESS Stack output holding the instance's address.
+const OUTPUT_ADDRESS = "Address"
+
+// OUTPUT_DATASTORE Stack output holding the datastore endpoint.
+const OUTPUT_DATASTORE = "Datastore"
+
+// OUTPUT_EVENTSTREAM Stack output holding the event stream endpoint.
+const OUTPUT_EVENTSTREAM = "EventStream"
+
+// OUTPUT_MEDIA Stack output holding the media endpoint.
+const OUTPUT_MEDIA = "Media"
+
+// OUTPUT_LOGIN Stack output holding the login endpoint.
+const OUTPUT_LOGIN = "Login"
+
+// OUTPUT_API Stack output holding the api endpoint.
+const OUTPUT_API = "Api"
+
+// OUTPUT_CDN Stack output holding the CDN endpoint.
+const OUTPUT_CDN = "CDN"
+
+// OUTPUT_CA Stack output holding the CA host.
+const OUTPUT_CA = "CA"
+
+// requiredOutputs  Every stack output ops reads.  A template that doesn't define them all can't be used.
+var requiredOutputs = []string{
+	OUTPUT_ADDRESS,
+	OUTPUT_DATASTORE,
+	OUTPUT_EVENTSTREAM,
+	OUTPUT_MEDIA,
+	OUTPUT_LOGIN,
+	OUTPUT_API,
+	OUTPUT_CDN,
+	OUTPUT_CA,
+}
+
+// StackParameterKeys returns the names of every parameter CreateCFStackInput sends, sorted.
+func (c *StackConfig) StackParameterKeys() (keys []string) {
+	keys = make([]string, 0)
+
+	for k := range managedParameters {
+		keys = append(keys, k)
+	}
+
+	for k := range defaultParameters {
+		keys = append(keys, k)
+	}
+
+	for k := range c.ParameterOverrides {
+		if !StringInSlice(k, keys) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CheckParameterKeys checks that the template declares every parameter in keys, and that keys covers every parameter the template requires.
+func (t *CFTemplate) CheckParameterKeys(keys []string) (err error) {
+	problems := make([]string, 0)
+
+	for _, k := range keys {
+		if _, ok := t.Parameters[k]; !ok {
+			problems = append(problems, fmt.Sprintf("template doesn't declare parameter %s", k))
+		}
+	}
+
+	for _, name := range t.ParameterNames() {
+		if t.Parameters[name].Default == nil && !StringInSlice(name, keys) {
+			problems = append(problems, fmt.Sprintf("template requires parameter %s, which ops doesn't set", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// CheckOutputs checks that the template defines every output ops reads.
+func (t *CFTemplate) CheckOutputs() (err error) {
+	missing := make([]string, 0)
+
+	for _, o := range requiredOutputs {
+		if _, ok := t.Outputs[o]; !ok {
+			missing = append(missing, o)
+		}
+	}
+
+	if len(missing) > 0 {
+		err = errors.New(fmt.Sprintf("template doesn't define outputs %s", strings.Join(missing, ", ")))
+		return err
+	}
+
+	return err
+}
+
+// CheckTemplate checks that the stack's CloudFormation template is compatible with this version of ops: the parameters ops sends are declared, the template requires nothing ops doesn't send, the outputs ops reads are defined, and CloudFormation itself accepts the template.
+func (s *Stack) CheckTemplate() (results []CheckResult) {
+	var template *CFTemplate
+
+	source, err := s.TemplateSource()
+	if err == nil {
+		template, err = s.FetchTemplate()
+	}
+
+	// nothing else can be checked without the template
+	if err != nil {
+		results = []CheckResult{{Name: "template", Passed: false, Detail: err.Error()}}
+		return results
+	}
+
+	checks := []Check{
+		{
+			Name: "template",
+			Run: func() (detail string, err error) {
+				detail = source.Location
+				return detail, err
+			},
+		},
+		{
+			Name: "parameters",
+			Run: func() (detail string, err error) {
+				keys := s.Config.StackParameterKeys()
+				err = template.CheckParameterKeys(keys)
+				detail = fmt.Sprintf("%d sent, all declared", len(keys))
+				return detail, err
+			},
+		},
+		{
+			Name: "outputs",
+			Run: func() (detail string, err error) {
+				err = template.CheckOutputs()
+				detail = strings.Join(requiredOutputs, ", ")
+				return detail, err
+			},
+		},
+		{
+			Name: "cloudformation",
+			Run: func() (detail string, err error) {
+				err = s.ValidateTemplate()
+				detail = "ValidateTemplate ok"
+				return detail, err
+			},
+		},
+	}
+
+	results = RunChecks(checks)
+
+	return results
+}
+
+// ValidateTemplate has CloudFormation validate the stack's template.
+func (s *Stack) ValidateTemplate() (err error) {
+	stackInput := cloudformation.CreateStackInput{}
+
+	err = s.ApplyTemplate(&stackInput)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		rmErr := s.RemoveStagedTemplate(&stackInput)
+		if rmErr != nil {
+			log.Printf("%s", rmErr)
+		}
+	}()
+
+	client := cloudformation.New(s.AwsSession)
+
+	_, err = client.ValidateTemplate(&cloudformation.ValidateTemplateInput{
+		TemplateBody: stackInput.TemplateBody,
+		TemplateURL:  stackInput.TemplateURL,
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "CloudFormation rejected the template")
+		return err
+	}
+
+	return err
+}
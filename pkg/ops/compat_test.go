@@ -0,0 +1,73 @@
+package ops
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckParameterKeys(t *testing.T) {
+	template, err := ParseTemplate([]byte(testCFTemplate))
+	if err != nil {
+		t.Errorf("failed parsing template: %s", err)
+	}
+
+	cases := []struct {
+		name string
+		keys []string
+		err  string
+	}{
+		{"compatible", []string{"KeyName", "VolumeSize"}, ""},
+		{"undeclared", []string{"KeyName", "AmiId"}, "template doesn't declare parameter AmiId"},
+		{"required", []string{"VolumeSize"}, "template requires parameter KeyName, which ops doesn't set"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := template.CheckParameterKeys(tc.keys)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err, "expected an error") {
+				assert.Equal(t, tc.err, err.Error(), "error doesn't meet expectations")
+			}
+		})
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	template, err := ParseTemplate([]byte(testCFTemplate))
+	if err != nil {
+		t.Errorf("failed parsing template: %s", err)
+	}
+
+	err = template.CheckOutputs()
+	if assert.Error(t, err, "expected missing outputs") {
+		assert.Equal(t, "template doesn't define outputs Datastore, EventStream, Media, Login, CDN, CA", err.Error(), "error doesn't meet expectations")
+	}
+
+	for _, o := range requiredOutputs {
+		template.Outputs[o] = CFTemplateOutput{}
+	}
+
+	assert.NoError(t, template.CheckOutputs(), "all outputs defined")
+}
+
+func TestStackParameterKeys(t *testing.T) {
+	config := StackConfig{ParameterOverrides: map[string]string{"VolumeSize": "100", "Environment": "demo"}}
+
+	assert.Equal(t, []string{
+		"AmiId",
+		"CreateDNS",
+		"CreateDNSDomain",
+		"CreateDNSZoneID",
+		"Environment",
+		"ExistingPublicSubnet",
+		"ExistingVpcID",
+		"InstanceName",
+		"InstanceType",
+		"KeyName",
+		"VolumeSize",
+	}, config.StackParameterKeys(), "parameter keys don't meet expectations")
+}
@@ -0,0 +1,336 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PROFILE_ENV_VAR Environment variable selecting a config profile when --profile isn't given.
+const PROFILE_ENV_VAR = "ORION_PROFILE"
+
+// DEFAULT_PROFILE Profile used when none is selected.  Flat config files without profiles are read as this profile.
+const DEFAULT_PROFILE = "default"
+
+// PROFILE_INHERITS_KEY Profile key naming the profile it inherits values from.
+const PROFILE_INHERITS_KEY = "inherits"
+
+// ConfigFile  The ops config file.  Holds any number of named profiles, each of which is a (possibly partial) StackConfig, and the accounts profiles can act in.
+type ConfigFile struct {
+	Version        int                               `json:"version"`
+	DefaultProfile string                            `json:"default_profile,omitempty"`
+	Profiles       map[string]map[string]interface{} `json:"profiles"`
+	Accounts       map[string]Account                `json:"accounts,omitempty"`
+	Migrations     []string                          `json:"-"` // migrations applied while parsing.  Saved by 'ops config migrate'.
+}
+
+// ConfigFilePath expands the config path given on the command line.  The default path, or an empty one, resolves to DEFAULT_CONFIG_FILE in the user's home directory.
+func ConfigFilePath(configPath string) (path string, err error) {
+	if configPath == "" || configPath == "~/.orion-ptt-system.json" {
+		hd, err := homedir.Dir()
+		if err != nil {
+			err = errors.Wrapf(err, "failed to read home directory")
+			return path, err
+		}
+
+		path = fmt.Sprintf("%s/%s", hd, DEFAULT_CONFIG_FILE)
+		return path, err
+	}
+
+	path, err = homedir.Expand(configPath)
+	if err != nil {
+		err = errors.Wrapf(err, "failed expanding %s", configPath)
+		return path, err
+	}
+
+	return path, err
+}
+
+// ReadConfigFile reads the config file at path.  A missing file yields an empty ConfigFile.
+func ReadConfigFile(path string) (file *ConfigFile, err error) {
+	file = &ConfigFile{
+		Version:  CONFIG_VERSION,
+		Profiles: make(map[string]map[string]interface{}),
+	}
+
+	if _, e := os.Stat(path); os.IsNotExist(e) {
+		return file, err
+	}
+
+	c, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read config file %s", path)
+		return file, err
+	}
+
+	if isYaml(path) {
+		c, err = yamlToJson(c)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse yaml in %s", path)
+			return file, err
+		}
+	}
+
+	err = file.Parse(c)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse %s", path)
+		return file, err
+	}
+
+	return file, err
+}
+
+// Parse parses config file content.  Older formats are migrated to CONFIG_VERSION in memory, e.g. content without a 'profiles' key is a single, flat profile named DEFAULT_PROFILE.  Unknown keys are an error.
+func (f *ConfigFile) Parse(content []byte) (err error) {
+	raw := make(map[string]interface{})
+
+	err = json.Unmarshal(content, &raw)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to unmarshal json")
+		return err
+	}
+
+	raw, f.Migrations, err = MigrateConfig(raw)
+	if err != nil {
+		return err
+	}
+
+	err = checkFileKeys(raw)
+	if err != nil {
+		return err
+	}
+
+	err = checkAccountKeys(raw)
+	if err != nil {
+		return err
+	}
+
+	content, err = json.Marshal(raw)
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling migrated config")
+		return err
+	}
+
+	err = json.Unmarshal(content, f)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to unmarshal profiles")
+		return err
+	}
+
+	if f.Profiles == nil {
+		f.Profiles = make(map[string]map[string]interface{})
+	}
+
+	err = f.CheckKeys()
+	if err != nil {
+		return err
+	}
+
+	err = f.CheckAccounts()
+
+	return err
+}
+
+// ConfigFileTemplate returns the content of a new config file, holding a DEFAULT_PROFILE filled out from CONFIG_FILE_TEMPLATE.
+func ConfigFileTemplate() (content []byte, err error) {
+	file := &ConfigFile{}
+
+	err = file.Parse([]byte(CONFIG_FILE_TEMPLATE))
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing config file template")
+		return content, err
+	}
+
+	content, err = json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling config file template")
+		return content, err
+	}
+
+	content = append(content, '\n')
+
+	return content, err
+}
+
+// ValidateConfigContent checks that content is a parseable config file for the given path.
+func ValidateConfigContent(path string, content []byte) (err error) {
+	if isYaml(path) {
+		content, err = yamlToJson(content)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse yaml")
+			return err
+		}
+	}
+
+	err = (&ConfigFile{}).Parse(content)
+
+	return err
+}
+
+// Write writes the config file to path, as YAML if the path ends in .yaml or .yml, and as JSON otherwise.
+func (f *ConfigFile) Write(path string) (err error) {
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling config file")
+		return err
+	}
+
+	content = append(content, '\n')
+
+	if isYaml(path) {
+		content, err = jsonToYaml(content)
+		if err != nil {
+			err = errors.Wrapf(err, "failed converting config file to yaml")
+			return err
+		}
+	}
+
+	err = ioutil.WriteFile(path, content, 0600)
+	if err != nil {
+		err = errors.Wrapf(err, "failed writing %s", path)
+		return err
+	}
+
+	return err
+}
+
+// ProfileNames returns the names of all profiles in the file, sorted.
+func (f *ConfigFile) ProfileNames() (names []string) {
+	names = make([]string, 0)
+
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// SelectProfile returns the name of the profile to use.  In order: the requested name, $ORION_PROFILE, the file's default_profile, and finally DEFAULT_PROFILE.
+func (f *ConfigFile) SelectProfile(requested string) (name string) {
+	switch {
+	case requested != "":
+		name = requested
+	case os.Getenv(PROFILE_ENV_VAR) != "":
+		name = os.Getenv(PROFILE_ENV_VAR)
+	case f.DefaultProfile != "":
+		name = f.DefaultProfile
+	default:
+		name = DEFAULT_PROFILE
+	}
+
+	return name
+}
+
+// Resolve returns the values of the named profile, merged over those of the profiles it inherits from.
+func (f *ConfigFile) Resolve(name string) (values map[string]interface{}, err error) {
+	values = make(map[string]interface{})
+
+	chain := make([]string, 0)
+
+	for current := name; current != ""; {
+		if StringInSlice(current, chain) {
+			err = errors.New(fmt.Sprintf("profile inheritance loop: %s -> %s", strings.Join(chain, " -> "), current))
+			return values, err
+		}
+
+		profile, ok := f.Profiles[current]
+		if !ok {
+			if len(chain) == 0 {
+				err = errors.New(fmt.Sprintf("no profile named %q", current))
+			} else {
+				err = errors.New(fmt.Sprintf("profile %q inherits from unknown profile %q", chain[len(chain)-1], current))
+			}
+			return values, err
+		}
+
+		chain = append(chain, current)
+
+		parent, _ := profile[PROFILE_INHERITS_KEY].(string)
+		current = parent
+	}
+
+	// apply from the root of the chain down, so the most specific profile wins.
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range f.Profiles[chain[i]] {
+			if k == PROFILE_INHERITS_KEY {
+				continue
+			}
+
+			values[k] = v
+		}
+	}
+
+	return values, err
+}
+
+// StackConfig returns the named profile (after inheritance) as a StackConfig.  If the file holds no profiles at all, an empty config is returned.
+func (f *ConfigFile) StackConfig(name string) (config *StackConfig, err error) {
+	config = &StackConfig{}
+
+	if len(f.Profiles) == 0 {
+		return config, err
+	}
+
+	values, err := f.Resolve(name)
+	if err != nil {
+		return config, err
+	}
+
+	// round trip through json so the StackConfig json tags stay the single source of truth for key names.
+	content, err := json.Marshal(values)
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling profile %s", name)
+		return config, err
+	}
+
+	err = json.Unmarshal(content, config)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to unmarshal profile %s", name)
+		return config, err
+	}
+
+	return config, err
+}
+
+// isYaml returns true if the path has a YAML extension.
+func isYaml(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// yamlToJson converts YAML content to JSON, so that a single parser, and the json struct tags, handle both formats.
+func yamlToJson(content []byte) (converted []byte, err error) {
+	var data interface{}
+
+	err = yaml.Unmarshal(content, &data)
+	if err != nil {
+		return converted, err
+	}
+
+	converted, err = json.Marshal(data)
+
+	return converted, err
+}
+
+// jsonToYaml converts JSON content to YAML.
+func jsonToYaml(content []byte) (converted []byte, err error) {
+	var data interface{}
+
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return converted, err
+	}
+
+	converted, err = yaml.Marshal(data)
+
+	return converted, err
+}
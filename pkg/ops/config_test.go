@@ -0,0 +1,145 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+const testProfilesConfig = `{
+  "default_profile": "dev",
+  "profiles": {
+    "base": {
+      "user_name": "ops",
+      "dns_domain": "example.com",
+      "instance_type": "m5.xlarge"
+    },
+    "dev": {
+      "inherits": "base",
+      "dns_domain": "dev.example.com"
+    },
+    "demo": {
+      "inherits": "dev",
+      "instance_type": "m5.2xlarge"
+    },
+    "loop1": {
+      "inherits": "loop2"
+    },
+    "loop2": {
+      "inherits": "loop1"
+    },
+    "orphan": {
+      "inherits": "nope"
+    }
+  }
+}`
+
+func TestConfigFileStackConfig(t *testing.T) {
+	file := &ConfigFile{}
+	err := file.Parse([]byte(testProfilesConfig))
+	if err != nil {
+		t.Errorf("failed parsing config: %s", err)
+	}
+
+	cases := []struct {
+		profile  string
+		expected StackConfig
+		err      bool
+	}{
+		{
+			"base",
+			StackConfig{Username: "ops", DNSDomain: "example.com", InstanceType: "m5.xlarge"},
+			false,
+		},
+		{
+			"dev",
+			StackConfig{Username: "ops", DNSDomain: "dev.example.com", InstanceType: "m5.xlarge"},
+			false,
+		},
+		{
+			"demo",
+			StackConfig{Username: "ops", DNSDomain: "dev.example.com", InstanceType: "m5.2xlarge"},
+			false,
+		},
+		{"loop1", StackConfig{}, true},
+		{"orphan", StackConfig{}, true},
+		{"missing", StackConfig{}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.profile, func(t *testing.T) {
+			config, err := file.StackConfig(tc.profile)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, *config, "profile doesn't meet expectations")
+		})
+	}
+}
+
+func TestConfigFileFlat(t *testing.T) {
+	file := &ConfigFile{}
+	err := file.Parse([]byte(CONFIG_FILE_TEMPLATE))
+	if err != nil {
+		t.Errorf("failed parsing flat config: %s", err)
+	}
+
+	assert.Equal(t, []string{DEFAULT_PROFILE}, file.ProfileNames(), "flat config not read as default profile")
+
+	config, err := file.StackConfig(file.SelectProfile(""))
+	if err != nil {
+		t.Errorf("failed loading default profile: %s", err)
+	}
+
+	assert.Equal(t, DEFAULT_INSTANCE_TYPE, config.InstanceType, "flat config values not loaded")
+}
+
+func TestConfigFileSelectProfile(t *testing.T) {
+	file := &ConfigFile{DefaultProfile: "dev"}
+
+	_ = os.Unsetenv(PROFILE_ENV_VAR)
+	assert.Equal(t, "dev", file.SelectProfile(""), "default profile not selected")
+
+	_ = os.Setenv(PROFILE_ENV_VAR, "qa")
+	defer os.Unsetenv(PROFILE_ENV_VAR)
+	assert.Equal(t, "qa", file.SelectProfile(""), "env profile not selected")
+	assert.Equal(t, "demo", file.SelectProfile("demo"), "requested profile not selected")
+
+	_ = os.Unsetenv(PROFILE_ENV_VAR)
+	assert.Equal(t, DEFAULT_PROFILE, (&ConfigFile{}).SelectProfile(""), "fallback profile not selected")
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer clearConfigEnv()()
+
+	path := fmt.Sprintf("%s/profiles.json", tmpDir)
+
+	file := &ConfigFile{}
+	err := file.Parse([]byte(testProfilesConfig))
+	if err != nil {
+		t.Errorf("failed parsing config: %s", err)
+	}
+
+	err = file.Write(path)
+	if err != nil {
+		t.Errorf("failed writing config: %s", err)
+	}
+
+	config, err := LoadConfig(path, "")
+	if err != nil {
+		t.Errorf("failed loading config: %s", err)
+	}
+
+	assert.Equal(t, "dev.example.com", config.DNSDomain, "default profile not loaded")
+
+	config, err = LoadConfig(fmt.Sprintf("%s/does-not-exist.json", tmpDir), "")
+	if err != nil {
+		t.Errorf("missing config file should not be an error: %s", err)
+	}
+
+	assert.Equal(t, StackConfig{InstanceType: DEFAULT_INSTANCE_TYPE, NetworkMode: DEFAULT_NETWORK_MODE, SubnetStrategy: DEFAULT_SUBNET_STRATEGY}, *config, "missing config file should yield the defaults")
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 	"text/tabwriter"
 	"time"
 )
@@ -21,9 +22,26 @@ var TESTING bool
 
 // Create Instantiates an instance of the Orion PTT System in AWS via CloudFormation
 func (s *Stack) Create(stageOnly bool) (err error) {
-	exists := s.Exists()
-	if exists {
-		err = errors.New(fmt.Sprintf("Stack %s already exists.", s.Config.StackName))
+	// check everything that would make creation fail part way, before creating anything.
+	results := s.Preflight()
+	if !ChecksPassed(results) {
+		fmt.Printf("\nPreflight:\n")
+		PrintCheckResults(results)
+		err = errors.New(fmt.Sprintf("Preflight checks failed for stack %s.  See 'ops preflight'", s.Config.StackName))
+		return err
+	}
+
+	if ChecksWarned(results) {
+		fmt.Printf("\nPreflight:\n")
+		PrintCheckResults(results)
+	}
+
+	// make sure the template still matches what ops sends and reads, before creating anything.
+	results = s.CheckTemplate()
+	if !ChecksPassed(results) {
+		fmt.Printf("\nTemplate Compatibility:\n")
+		PrintCheckResults(results)
+		err = errors.New("CloudFormation template is not compatible with this version of ops.  See 'ops template check'")
 		return err
 	}
 
@@ -32,6 +50,14 @@ func (s *Stack) Create(stageOnly bool) (err error) {
 	// Initialize the CF stack
 	_, err = s.Init()
 	if err != nil {
+		// only a VPC made for this attempt can safely go.  One found by tag might belong to a live stack of the same name.
+		if vpcID := s.CreatedVpcID(); vpcID != "" {
+			e := s.DeleteVpc(vpcID)
+			if e != nil {
+				log.Printf("failed removing VPC %s created for %s: %s\nYou may have to do it manually.\n", vpcID, s.Config.StackName, e)
+			}
+		}
+
 		err = errors.Wrapf(err, "Failed creating stack %q", s.Config.StackName)
 		return err
 	}
@@ -77,21 +103,19 @@ func (s *Stack) Create(stageOnly bool) (err error) {
 
 			fmt.Printf("Checking Status\n")
 
-			dur, err := RetryUntil(func() (err error) {
-				status, err := s.Status()
-				if err != nil {
-					fmt.Printf("  DELETE_COMPLETE\n")
-					return nil
-				} else {
-					err = errors.New(status)
-				}
-				return err
-			}, 15)
+			dur, err := s.WaitForDeletion()
 			if err != nil {
-
+				err = errors.Wrapf(err, "failed removing rolled back stack.  Its VPC, if it has one, was left alone")
+				return err
 			}
+
 			fmt.Printf("Stack Deletion took %f minutes.\n", dur.Minutes())
 
+			err = s.DeleteStackVpc()
+			if err != nil {
+				log.Printf("failed removing VPC created for %s: %s\nYou may have to do it manually.\n", s.Config.StackName, err)
+			}
+
 			os.Exit(0)
 		}
 	}
@@ -120,21 +144,21 @@ func (s *Stack) Create(stageOnly bool) (err error) {
 
 	for _, o := range outputs {
 		switch *o.OutputKey {
-		case "Address":
+		case OUTPUT_ADDRESS:
 			address = *o.OutputValue
-		case "Datastore":
+		case OUTPUT_DATASTORE:
 			datastore = *o.OutputValue
-		case "EventStream":
+		case OUTPUT_EVENTSTREAM:
 			eventstream = *o.OutputValue
-		case "Media":
+		case OUTPUT_MEDIA:
 			media = *o.OutputValue
-		case "Login":
+		case OUTPUT_LOGIN:
 			login = *o.OutputValue
-		case "Api":
+		case OUTPUT_API:
 			api = *o.OutputValue
-		case "CDN":
+		case OUTPUT_CDN:
 			cdn = *o.OutputValue
-		case "CA":
+		case OUTPUT_CA:
 			caHost = *o.OutputValue
 		}
 	}
@@ -314,14 +338,24 @@ func (s *Stack) PollKotsadm(sshClient *SshProgClient) (err error) {
 	return err
 }
 
+// KotsInstallScript wraps the kots install command so the shared password comes in on stdin, not on the ssh command line.  It's written to a temporary file, mode 0600, that's removed when the install finishes, however it finishes, and handed to kots' --shared-password from there.  kots can't read the password from a file itself, so it's in the kots process' own arguments on the instance while the install runs.
+func KotsInstallScript(kotsCmd string) (script string) {
+	script = fmt.Sprintf(`f=$(mktemp) && trap "rm -f $f" EXIT && chmod 600 "$f" && head -n 1 > "$f" && %s --shared-password "$(cat "$f")"`, kotsCmd)
+
+	return script
+}
+
 func (s *Stack) KotsInstall(sshClient *SshProgClient) (err error) {
 	start := time.Now()
 
-	cmd := fmt.Sprintf("sudo -i kubectl kots install orion-ptt-system --license-file /home/%s/license.yaml --namespace default --config-values /home/%s/config.yaml --shared-password %q", s.Config.Username, s.Config.Username, s.Config.KotsadmPassword)
+	kotsCmd := fmt.Sprintf("kubectl kots install %s --license-file /home/%s/license.yaml --namespace default --config-values /home/%s/config.yaml", KOTS_APP_SLUG, s.Config.Username, s.Config.Username)
+	cmd := fmt.Sprintf("sudo -i sh -c '%s'", KotsInstallScript(kotsCmd))
+
+	fmt.Printf("Installing Kots app with the following command:\n\n  %s\n\nThis will take a couple minutes.\n\n", kotsCmd)
 
-	fmt.Printf("Installing Kots app with the following command:\n\n  %s\n\nThis will take a couple minutes.\n\n", cmd)
+	stdin := strings.NewReader(fmt.Sprintf("%s\n", s.Config.KotsadmPassword))
 
-	err = sshClient.RpcCall([]byte(cmd), os.Stdout, os.Stderr)
+	err = sshClient.RpcCallWithStdin([]byte(cmd), stdin, NewRedactingWriter(os.Stdout), NewRedactingWriter(os.Stderr))
 	if err != nil {
 		err = errors.Wrapf(err, "error running kots install")
 		return err
@@ -361,6 +395,17 @@ func (s *Stack) StageLicense(sshClient *SshProgClient) (err error) {
 		return err
 	}
 
+	license, err := ParseLicense(licenseContentBytes)
+	if err != nil {
+		err = errors.Wrapf(err, "invalid license file %s", s.Config.LicenseFile)
+		return err
+	}
+
+	err = license.Validate(KOTS_APP_SLUG, time.Now())
+	if err != nil {
+		return err
+	}
+
 	licenseContent := string(licenseContentBytes)
 
 	_, err = RetryUntil(func() (err error) {
@@ -409,7 +454,7 @@ func (s *Stack) TrustCA(host string) (err error) {
 					log.Fatalf("'sudo' tool not found: %s", err)
 				}
 
-				cmd := exec.Command(sudo, "security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", "/Library/Keychains/System.keychain", fileName)
+				cmd := exec.Command(sudo, SudoArgs("security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", "/Library/Keychains/System.keychain", fileName)...)
 
 				cmd.Stdout = os.Stdout
 				cmd.Stderr = os.Stderr
@@ -0,0 +1,45 @@
+package ops
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestKotsInstallScript(t *testing.T) {
+	// stand in for kots: show the password file's mode and path, then echo the arguments kots would get.
+	script := KotsInstallScript(`ls -l "$f" | cut -c1-10 && echo "$f"`)
+
+	assert.NotContains(t, script, "'", "script has to fit in single quotes")
+
+	stdout := &bytes.Buffer{}
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Stdin = strings.NewReader("hunter22\n")
+	cmd.Stdout = stdout
+
+	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("failed running script: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if !assert.Equal(t, 2, len(lines), "output doesn't meet expectations") {
+		return
+	}
+
+	assert.Equal(t, "-rw-------", lines[0], "password file mode doesn't meet expectations")
+
+	fields := strings.Fields(lines[1])
+	if !assert.Equal(t, 3, len(fields), "arguments don't meet expectations") {
+		return
+	}
+
+	assert.Equal(t, []string{"--shared-password", "hunter22"}, fields[1:], "arguments don't meet expectations")
+
+	_, err = os.Stat(fields[0])
+	assert.True(t, os.IsNotExist(err), "password file should be removed")
+}
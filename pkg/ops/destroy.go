@@ -2,13 +2,21 @@ package ops
 
 import (
 	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/pkg/errors"
 	"log"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
+	"time"
 )
 
+// STACK_DELETE_TIMEOUT_MINUTES How long to wait for CloudFormation to delete a stack.
+const STACK_DELETE_TIMEOUT_MINUTES = 15
+
+// Destroy deletes the stack, waits for it to go, and removes the VPC ops created for it, if any.  On a mac, the trust in the stack's CA is removed too, even if deleting the stack or its VPC failed.  Any such failure is returned.
 func (s *Stack) Destroy() (err error) {
 	outputs, err := s.Outputs()
 	if err != nil {
@@ -19,7 +27,7 @@ func (s *Stack) Destroy() (err error) {
 	var caHost string
 
 	for _, o := range outputs {
-		if *o.OutputKey == "CA" {
+		if *o.OutputKey == OUTPUT_CA {
 			caHost = *o.OutputValue
 		}
 	}
@@ -32,32 +40,36 @@ func (s *Stack) Destroy() (err error) {
 	}
 
 	fmt.Printf("Checking Status\n")
-	dur, err := RetryUntil(func() (err error) {
-		status, err := s.Status()
-		if err != nil {
-			fmt.Printf("  DELETE_COMPLETE\n")
-			return nil
-		} else {
-			err = errors.New(status)
-		}
-		return err
-	}, 15)
-	fmt.Printf("Stack Deletion took %f minutes.\n", dur.Minutes())
 
-	sudo, err := exec.LookPath("sudo")
+	// whatever becomes of the stack, the trust in its CA is removed below, so failures here are reported once that's done.
+	dur, err := s.WaitForDeletion()
 	if err != nil {
-		err = errors.Wrapf(err, "'sudo' tool not found")
-		return err
+		log.Printf("%s\n", err)
+	} else {
+		fmt.Printf("Stack Deletion took %f minutes.\n", dur.Minutes())
+
+		// a dedicated VPC can only go once the stack's instance has left it.
+		err = s.DeleteStackVpc()
+		if err != nil {
+			err = errors.Wrapf(err, "failed removing VPC created for %s", s.Config.StackName)
+			log.Printf("%s\n", err)
+		}
 	}
 
 	if runtime.GOOS == "darwin" {
-		shellCmd := exec.Command(sudo, "security", "delete-certificate", "-c", caHost, "/Library/Keychains/System.keychain")
+		sudo, e := exec.LookPath("sudo")
+		if e != nil {
+			log.Printf("'sudo' tool not found: %s\nYou may have to remove the trust for %s manually.\n", e, caHost)
+			return err
+		}
+
+		shellCmd := exec.Command(sudo, SudoArgs("security", "delete-certificate", "-c", caHost, "/Library/Keychains/System.keychain")...)
 
 		shellCmd.Stdout = os.Stdout
 		shellCmd.Stderr = os.Stderr
 		shellCmd.Stdin = os.Stdin
 
-		e := shellCmd.Run()
+		e = shellCmd.Run()
 		if e != nil {
 			log.Printf("error deleting trust for cert: %s\nYou may have to do it manually.\n", caHost)
 		} else {
@@ -67,3 +79,50 @@ func (s *Stack) Destroy() (err error) {
 
 	return err
 }
+
+// WaitForDeletion waits for CloudFormation to finish deleting the stack.  Fails if the deletion fails, or takes longer than STACK_DELETE_TIMEOUT_MINUTES, in which case the stack, and whatever is in it, is still there.
+func (s *Stack) WaitForDeletion() (elapsed time.Duration, err error) {
+	failed := false
+
+	elapsed, err = RetryUntil(func() (err error) {
+		status, err := s.Status()
+		if err != nil {
+			if StackGone(err) {
+				fmt.Printf("  DELETE_COMPLETE\n")
+				return nil
+			}
+
+			return err
+		}
+
+		if status == cloudformation.StackStatusDeleteFailed {
+			failed = true
+			return nil
+		}
+
+		err = errors.New(status)
+
+		return err
+	}, STACK_DELETE_TIMEOUT_MINUTES)
+	if err != nil {
+		err = errors.Wrapf(err, "stack %s wasn't deleted", s.Config.StackName)
+		return elapsed, err
+	}
+
+	if failed {
+		err = errors.New(fmt.Sprintf("deleting stack %s failed: %s", s.Config.StackName, cloudformation.StackStatusDeleteFailed))
+		return elapsed, err
+	}
+
+	return elapsed, err
+}
+
+// StackGone returns true if err says the stack doesn't exist.  CloudFormation reports that as a ValidationError.  Any other error, e.g. throttling, says nothing about whether the stack is there.
+func StackGone(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code() == "ValidationError" && strings.Contains(aerr.Message(), "does not exist")
+	}
+
+	return false
+}
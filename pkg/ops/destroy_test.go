@@ -0,0 +1,43 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStackGone(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		gone bool
+	}{
+		{
+			"gone",
+			errors.Wrapf(awserr.New("ValidationError", "Stack with id demo does not exist", nil), "error getting stack demo"),
+			true,
+		},
+		{
+			"other validation error",
+			awserr.New("ValidationError", "1 validation error detected", nil),
+			false,
+		},
+		{
+			"throttled",
+			errors.Wrapf(awserr.New("Throttling", "Rate exceeded", nil), "error getting stack demo"),
+			false,
+		},
+		{
+			"not from aws",
+			errors.New("connection refused"),
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.gone, StackGone(tc.err), "result doesn't meet expectations")
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NonInteractive  When true, nothing prompts.  Missing parameters are reported as a MissingParamsError instead of asked for.
+var NonInteractive bool
+
+// EXIT_CODE_MISSING_PARAMS Exit code used when required parameters are missing and can't be prompted for.
+const EXIT_CODE_MISSING_PARAMS = 3
+
+// MissingParamsError  Reports every required parameter that was missing in non-interactive mode, all at once.
+type MissingParamsError struct {
+	Params []string
+}
+
+func (e *MissingParamsError) Error() string {
+	return fmt.Sprintf("missing required parameters: %s", strings.Join(e.Params, ", "))
+}
+
+// StdinIsTerminal returns true if stdin is attached to a terminal, i.e. someone could answer a prompt.
+func StdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// SudoArgs prepends sudo's '-n' flag to args in non-interactive mode, so sudo fails rather than prompting for a password.
+func SudoArgs(args ...string) []string {
+	if NonInteractive {
+		return append([]string{"-n"}, args...)
+	}
+
+	return args
+}
@@ -0,0 +1,82 @@
+package ops
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAskForMissingParamsNonInteractive(t *testing.T) {
+	NonInteractive = true
+	defer func() { NonInteractive = false }()
+
+	complete := StackConfig{
+		StackName:       "opstest",
+		KeyName:         "opstest",
+		DNSDomain:       "example.com",
+		Username:        "ops",
+		LicenseFile:     "license.yaml",
+		ConfigTemplate:  "config.tmpl",
+		KotsadmPassword: "hunter22",
+		AMIName:         "orion-base*",
+		NetworkMode:     NETWORK_MODE_CREATE,
+	}
+
+	noPassword := complete
+	noPassword.KotsadmPassword = ""
+
+	cases := []struct {
+		name    string
+		config  StackConfig
+		keys    []string
+		missing []string
+	}{
+		{
+			"all missing",
+			StackConfig{},
+			nil,
+			[]string{"stack_name", "key_name", "dns_domain", "user_name", "license_file", "config_template", "kotsadm_password", "ami_name", "subnet_ids"},
+		},
+		{
+			"password missing",
+			noPassword,
+			nil,
+			[]string{"kotsadm_password"},
+		},
+		{
+			"key not needed",
+			StackConfig{StackName: "opstest"},
+			[]string{"stack_name", "dns_domain", "ami_name"},
+			[]string{"dns_domain", "ami_name"},
+		},
+		{
+			"nothing missing",
+			StackConfig{StackName: "opstest", DNSDomain: "example.com", AMIName: "orion-base*"},
+			[]string{"stack_name", "dns_domain", "ami_name"},
+			nil,
+		},
+		{
+			"complete",
+			complete,
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.AskForMissingParams(tc.keys...)
+			assert.Equal(t, DEFAULT_INSTANCE_TYPE, tc.config.InstanceType, "default instance type not applied")
+
+			if tc.missing == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var missing *MissingParamsError
+			if assert.True(t, errors.As(err, &missing), "expected a MissingParamsError") {
+				assert.Equal(t, tc.missing, missing.Params, "missing params don't meet expectations")
+			}
+		})
+	}
+}
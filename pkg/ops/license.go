@@ -0,0 +1,214 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// LICENSE_KIND Kind of a kots license document.
+const LICENSE_KIND = "License"
+
+// LICENSE_EXPIRATION_ENTITLEMENT Entitlement holding the license expiration date.  Empty means the license never expires.
+const LICENSE_EXPIRATION_ENTITLEMENT = "expires_at"
+
+// License  A kots license file, as issued by Orion.
+type License struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec LicenseSpec `yaml:"spec"`
+}
+
+// LicenseSpec  The body of a kots license.
+type LicenseSpec struct {
+	LicenseID         string                        `yaml:"licenseID"`
+	LicenseType       string                        `yaml:"licenseType"`
+	CustomerName      string                        `yaml:"customerName"`
+	AppSlug           string                        `yaml:"appSlug"`
+	ChannelID         string                        `yaml:"channelID"`
+	ChannelName       string                        `yaml:"channelName"`
+	Endpoint          string                        `yaml:"endpoint"`
+	IsAirgapSupported bool                          `yaml:"isAirgapSupported"`
+	Entitlements      map[string]LicenseEntitlement `yaml:"entitlements"`
+	Signature         string                        `yaml:"signature"`
+}
+
+// LicenseEntitlement  A single entitlement granted by a license.
+type LicenseEntitlement struct {
+	Title       string      `yaml:"title"`
+	Description string      `yaml:"description"`
+	Value       interface{} `yaml:"value"`
+	ValueType   string      `yaml:"valueType"`
+	IsHidden    bool        `yaml:"isHidden"`
+}
+
+// LoadLicense reads and parses a license file from the filesystem.
+func LoadLicense(path string) (license *License, err error) {
+	if path == "" {
+		err = errors.New("no license file configured")
+		return license, err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read file %s", path)
+		return license, err
+	}
+
+	license, err = ParseLicense(content)
+	if err != nil {
+		err = errors.Wrapf(err, "invalid license file %s", path)
+		return license, err
+	}
+
+	return license, err
+}
+
+// RegisterSecrets registers the sensitive parts of the license for redaction, one by one, so they're masked wherever they're quoted: the license ID, the signature, and the values of hidden entitlements, which can hold keys.
+func (l *License) RegisterSecrets() {
+	RegisterConfiguredSecret(l.Spec.LicenseID)
+	RegisterConfiguredSecret(l.Spec.Signature)
+
+	for _, e := range l.Spec.Entitlements {
+		if !e.IsHidden {
+			continue
+		}
+
+		value, ok := e.Value.(string)
+		if ok {
+			RegisterSecret(value)
+		}
+	}
+}
+
+// ParseLicense parses license yaml, and checks that it's shaped like a kots license.
+func ParseLicense(content []byte) (license *License, err error) {
+	license = &License{}
+
+	err = yaml.Unmarshal(content, license)
+	if err != nil {
+		err = errors.Wrapf(err, "failed unmarshalling license yaml")
+		return license, err
+	}
+
+	if license.Kind != LICENSE_KIND {
+		err = errors.New(fmt.Sprintf("expected kind %q, got %q", LICENSE_KIND, license.Kind))
+		return license, err
+	}
+
+	license.RegisterSecrets()
+
+	if license.Spec.LicenseID == "" {
+		err = errors.New("license has no licenseID")
+		return license, err
+	}
+
+	if license.Spec.AppSlug == "" {
+		err = errors.New("license has no appSlug")
+		return license, err
+	}
+
+	return license, err
+}
+
+// Expires returns the expiration time of the license.  Returns nil if the license doesn't expire.
+func (l *License) Expires() (expires *time.Time, err error) {
+	entitlement, ok := l.Spec.Entitlements[LICENSE_EXPIRATION_ENTITLEMENT]
+	if !ok || entitlement.Value == nil {
+		return expires, err
+	}
+
+	value := fmt.Sprintf("%v", entitlement.Value)
+	if value == "" {
+		return expires, err
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing license expiration %q", value)
+		return expires, err
+	}
+
+	expires = &t
+
+	return expires, err
+}
+
+// Validate checks that the license is for the given app, and has not expired as of the given time.
+func (l *License) Validate(appSlug string, now time.Time) (err error) {
+	if l.Spec.AppSlug != appSlug {
+		err = errors.New(fmt.Sprintf("license is for app %q, not %q", l.Spec.AppSlug, appSlug))
+		return err
+	}
+
+	expires, err := l.Expires()
+	if err != nil {
+		return err
+	}
+
+	if expires != nil && expires.Before(now) {
+		err = errors.New(fmt.Sprintf("license %s expired at %s", l.Spec.LicenseID, expires.Format(time.RFC3339)))
+		return err
+	}
+
+	return err
+}
+
+// ValidateLicense loads the configured license file and checks that it can be used to install this stack.
+func (s *Stack) ValidateLicense() (err error) {
+	license, err := LoadLicense(s.Config.LicenseFile)
+	if err != nil {
+		return err
+	}
+
+	err = license.Validate(KOTS_APP_SLUG, time.Now())
+
+	return err
+}
+
+// PrintLicense prints the interesting fields of a license.
+func PrintLicense(license *License) {
+	expiry := "never"
+	expires, err := license.Expires()
+	if err != nil {
+		expiry = fmt.Sprintf("invalid (%s)", err)
+	} else if expires != nil {
+		expiry = expires.Format(time.RFC3339)
+		if expires.Before(time.Now()) {
+			expiry = fmt.Sprintf("%s (EXPIRED)", expiry)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	_, _ = fmt.Fprintf(w, "License ID: \t %s\n", license.Spec.LicenseID)
+	_, _ = fmt.Fprintf(w, "Customer: \t %s\n", license.Spec.CustomerName)
+	_, _ = fmt.Fprintf(w, "License Type: \t %s\n", license.Spec.LicenseType)
+	_, _ = fmt.Fprintf(w, "App: \t %s\n", license.Spec.AppSlug)
+	_, _ = fmt.Fprintf(w, "Channel: \t %s\n", license.Spec.ChannelName)
+	_, _ = fmt.Fprintf(w, "Expires: \t %s\n", expiry)
+	_ = w.Flush()
+
+	names := make([]string, 0)
+	for k := range license.Spec.Entitlements {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	fmt.Printf("Entitlements:\n")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	for _, k := range names {
+		e := license.Spec.Entitlements[k]
+		_, _ = fmt.Fprintf(w, "  %s: \t %v \t %s\n", k, e.Value, e.Title)
+	}
+
+	_ = w.Flush()
+}
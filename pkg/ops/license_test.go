@@ -0,0 +1,136 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testLicense(appSlug string, expires string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: kots.io/v1beta1
+kind: License
+metadata:
+  name: opstest
+spec:
+  licenseID: 1abcdefghijklmnop
+  licenseType: dev
+  customerName: Ops Test
+  appSlug: %s
+  channelName: Stable
+  entitlements:
+    expires_at:
+      title: Expiration
+      value: %q
+      valueType: String
+    seats:
+      title: Seats
+      value: 10
+      valueType: Integer
+    signing_key:
+      title: Signing Key
+      value: a2V5LW1hdGVyaWFs
+      valueType: String
+      isHidden: true
+  signature: c2lnbmF0dXJl
+`, appSlug, expires))
+}
+
+func TestLicenseValidate(t *testing.T) {
+	clearSecrets(t)
+
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		content []byte
+		err     bool
+	}{
+		{
+			"valid",
+			testLicense(KOTS_APP_SLUG, "2022-01-01T00:00:00Z"),
+			false,
+		},
+		{
+			"no expiry",
+			testLicense(KOTS_APP_SLUG, ""),
+			false,
+		},
+		{
+			"expired",
+			testLicense(KOTS_APP_SLUG, "2021-01-01T00:00:00Z"),
+			true,
+		},
+		{
+			"wrong app",
+			testLicense("some-other-app", "2022-01-01T00:00:00Z"),
+			true,
+		},
+		{
+			"malformed expiry",
+			testLicense(KOTS_APP_SLUG, "next tuesday"),
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			license, err := ParseLicense(tc.content)
+			if err != nil {
+				t.Errorf("failed parsing license: %s", err)
+			}
+
+			err = license.Validate(KOTS_APP_SLUG, now)
+			if tc.err {
+				assert.Error(t, err, "expected validation to fail")
+			} else {
+				assert.NoError(t, err, "expected validation to pass")
+			}
+		})
+	}
+}
+
+func TestParseLicense(t *testing.T) {
+	clearSecrets(t)
+
+	license, err := ParseLicense(testLicense(KOTS_APP_SLUG, ""))
+	if err != nil {
+		t.Errorf("failed parsing license: %s", err)
+	}
+
+	assert.Equal(t, "1abcdefghijklmnop", license.Spec.LicenseID, "license ID doesn't meet expectations")
+	assert.Equal(t, "Stable", license.Spec.ChannelName, "channel doesn't meet expectations")
+	assert.Equal(t, 10, license.Spec.Entitlements["seats"].Value, "entitlement doesn't meet expectations")
+
+	_, err = ParseLicense([]byte("kind: ConfigValues\n"))
+	assert.Error(t, err, "expected non-license yaml to fail")
+
+	_, err = ParseLicense([]byte("{{{"))
+	assert.Error(t, err, "expected malformed yaml to fail")
+}
+
+func TestLicenseRegisterSecrets(t *testing.T) {
+	clearSecrets(t)
+
+	_, err := ParseLicense(testLicense(KOTS_APP_SLUG, ""))
+	if err != nil {
+		t.Fatalf("failed parsing license: %s", err)
+	}
+
+	cases := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{"license id", "license 1abcdefghijklmnop expired", fmt.Sprintf("license %s expired", REDACTED_MASK)},
+		{"signature", "signature: c2lnbmF0dXJl", fmt.Sprintf("signature: %s", REDACTED_MASK)},
+		{"hidden entitlement", "value: a2V5LW1hdGVyaWFs", fmt.Sprintf("value: %s", REDACTED_MASK)},
+		{"visible entitlement", "channelName: Stable", "channelName: Stable"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, Redact(tc.input), "redacted output doesn't meet expectations")
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CONFIG_ENV_PREFIX Prefix of the environment variables that set StackConfig fields.  e.g. ORION_DNS_DOMAIN sets dns_domain.
+const CONFIG_ENV_PREFIX = "ORION_"
+
+// SOURCE_DEFAULT Source of values that come from built in defaults.
+const SOURCE_DEFAULT = "default"
+
+// SOURCE_UNSET Source reported for values that nothing set.
+const SOURCE_UNSET = "unset"
+
+// ConfigField  Describes a single StackConfig field, as derived from its struct tags.
+type ConfigField struct {
+	Name   string // config file key
+	Flag   string // CLI flag name, without the leading '--'.  Secret fields have no flag.
+	Env    string // environment variable name
+	Usage  string
+	Secret bool
+	Type   reflect.Type
+}
+
+// ConfigLoader  Loads a StackConfig in layers.  In order of increasing precedence: defaults, the config file (JSON or YAML), ORION_* environment variables, and CLI flags.  Secret fields can't be set by flag.
+type ConfigLoader struct {
+	Path    string
+	Profile string
+	Flags   map[string]string // raw values of explicitly set flags, keyed by flag name
+}
+
+// ConfigFields returns a description of every StackConfig field.
+func ConfigFields() (fields []ConfigField) {
+	fields = make([]ConfigField, 0)
+
+	t := reflect.TypeOf(StackConfig{})
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		flag := sf.Tag.Get("flag")
+		if flag == "" {
+			flag = strings.ReplaceAll(name, "_", "-")
+		}
+
+		fields = append(fields, ConfigField{
+			Name:   name,
+			Flag:   flag,
+			Env:    fmt.Sprintf("%s%s", CONFIG_ENV_PREFIX, strings.ToUpper(name)),
+			Usage:  sf.Tag.Get("usage"),
+			Secret: sf.Tag.Get("secret") == "true",
+			Type:   sf.Type,
+		})
+	}
+
+	return fields
+}
+
+// ConfigDefaults returns the built in default values, keyed by config file key.
+func ConfigDefaults() (values map[string]interface{}) {
+	values = map[string]interface{}{
+		"instance_type":   DEFAULT_INSTANCE_TYPE,
+		"network_mode":    DEFAULT_NETWORK_MODE,
+		"subnet_strategy": DEFAULT_SUBNET_STRATEGY,
+	}
+
+	return values
+}
+
+// ParseValue converts a raw string from the environment or the command line to the type of the field.  Lists are comma separated.
+func (f ConfigField) ParseValue(raw string) (value interface{}, err error) {
+	switch f.Type.Kind() {
+	case reflect.Bool:
+		value, err = strconv.ParseBool(raw)
+		if err != nil {
+			err = errors.Wrapf(err, "%s expects true or false, got %q", f.Name, raw)
+			return value, err
+		}
+
+	case reflect.Int:
+		value, err = strconv.Atoi(raw)
+		if err != nil {
+			err = errors.Wrapf(err, "%s expects a number, got %q", f.Name, raw)
+			return value, err
+		}
+
+	case reflect.Slice:
+		list := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+
+		value = list
+
+	case reflect.Map:
+		pairs := make(map[string]string)
+		for _, item := range strings.Split(raw, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+				err = errors.New(fmt.Sprintf("%s expects Key=Value pairs, got %q", f.Name, item))
+				return value, err
+			}
+
+			pairs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+
+		value = pairs
+
+	default:
+		value = raw
+	}
+
+	return value, err
+}
+
+// Load loads the config, returning it together with the source of every field.
+func (l *ConfigLoader) Load() (config *StackConfig, sources map[string]string, err error) {
+	config = &StackConfig{}
+	sources = make(map[string]string)
+	values := make(map[string]interface{})
+
+	fields := ConfigFields()
+
+	for _, f := range fields {
+		sources[f.Name] = SOURCE_UNSET
+	}
+
+	// defaults
+	for k, v := range ConfigDefaults() {
+		values[k] = v
+		sources[k] = SOURCE_DEFAULT
+	}
+
+	// config file
+	path, err := ConfigFilePath(l.Path)
+	if err != nil {
+		return config, sources, err
+	}
+
+	file, err := ReadConfigFile(path)
+	if err != nil {
+		return config, sources, err
+	}
+
+	if len(file.Profiles) > 0 {
+		profile := file.SelectProfile(l.Profile)
+
+		fileValues, err := file.Resolve(profile)
+		if err != nil {
+			err = errors.Wrapf(err, "failed loading profile from %s", path)
+			return config, sources, err
+		}
+
+		for k, v := range fileValues {
+			values[k] = v
+			sources[k] = fmt.Sprintf("file %s (profile %s)", path, profile)
+		}
+	}
+
+	// environment
+	for _, f := range fields {
+		raw, ok := os.LookupEnv(f.Env)
+		if !ok {
+			continue
+		}
+
+		v, err := f.ParseValue(raw)
+		if err != nil {
+			err = errors.Wrapf(err, "bad value in %s", f.Env)
+			return config, sources, err
+		}
+
+		values[f.Name] = v
+		sources[f.Name] = fmt.Sprintf("env %s", f.Env)
+	}
+
+	// flags.  Secrets are never taken from flags, which anyone can read in the process list.
+	for _, f := range fields {
+		raw, ok := l.Flags[f.Flag]
+		if !ok || f.Secret {
+			continue
+		}
+
+		v, err := f.ParseValue(raw)
+		if err != nil {
+			err = errors.Wrapf(err, "bad value for --%s", f.Flag)
+			return config, sources, err
+		}
+
+		values[f.Name] = v
+		sources[f.Name] = fmt.Sprintf("flag --%s", f.Flag)
+	}
+
+	// round trip through json so the StackConfig json tags stay the single source of truth for key names.
+	content, err := json.Marshal(values)
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling config values")
+		return config, sources, err
+	}
+
+	err = json.Unmarshal(content, config)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to unmarshal config values")
+		return config, sources, err
+	}
+
+	// secret references are resolved in the account and region the stack is in, as NewStack does.
+	var secretSession *session.Session
+
+	if config.AWSAccount != "" {
+		account, err := file.Account(config.AWSAccount)
+		if err != nil {
+			return config, sources, err
+		}
+
+		config.Account = &account
+
+		base, err := DefaultSession()
+		if err != nil {
+			return config, sources, err
+		}
+
+		secretSession = AccountSession(base, account)
+	}
+
+	resolver := NewSecretResolver(secretSession)
+	resolver.Region = config.Region
+
+	err = config.ResolveSecrets(resolver)
+	if err != nil {
+		err = errors.Wrapf(err, "failed resolving secret references")
+		return config, sources, err
+	}
+
+	config.RegisterSecrets()
+
+	return config, sources, err
+}
+
+// ConfigSetting  A single resolved config value, and where it came from.
+type ConfigSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// EffectiveSettings lists every field of the config with its value and source, sorted by name.  Secret fields are masked.
+func (c *StackConfig) EffectiveSettings(sources map[string]string) (settings []ConfigSetting) {
+	settings = make([]ConfigSetting, 0)
+
+	v := reflect.ValueOf(c.Redacted()).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		value := fmt.Sprintf("%v", v.Field(i).Interface())
+		if v.Field(i).Kind() == reflect.Slice {
+			items := make([]string, 0)
+			for j := 0; j < v.Field(i).Len(); j++ {
+				items = append(items, fmt.Sprintf("%v", v.Field(i).Index(j).Interface()))
+			}
+
+			value = strings.Join(items, ",")
+		}
+
+		if v.Field(i).Kind() == reflect.Map {
+			items := make([]string, 0)
+			iter := v.Field(i).MapRange()
+			for iter.Next() {
+				items = append(items, fmt.Sprintf("%v=%v", iter.Key().Interface(), iter.Value().Interface()))
+			}
+
+			sort.Strings(items)
+			value = strings.Join(items, ",")
+		}
+
+		source, ok := sources[name]
+		if !ok {
+			source = SOURCE_UNSET
+		}
+
+		settings = append(settings, ConfigSetting{
+			Name:   name,
+			Value:  Redact(value),
+			Source: source,
+		})
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Name < settings[j].Name
+	})
+
+	return settings
+}
@@ -0,0 +1,102 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testYamlConfig = `profiles:
+  default:
+    dns_domain: file.example.com
+    user_name: fileuser
+    key_name: filekey
+    subnet_ids:
+      - subnet-1
+`
+
+// clearConfigEnv unsets any ORION_* config variables in the test environment, returning a function that restores them.
+func clearConfigEnv() (restore func()) {
+	saved := make(map[string]string)
+
+	for _, f := range ConfigFields() {
+		if v, ok := os.LookupEnv(f.Env); ok {
+			saved[f.Env] = v
+			_ = os.Unsetenv(f.Env)
+		}
+	}
+
+	restore = func() {
+		for k, v := range saved {
+			_ = os.Setenv(k, v)
+		}
+	}
+
+	return restore
+}
+
+func TestConfigLoaderLoad(t *testing.T) {
+	clearSecrets(t)
+
+	defer clearConfigEnv()()
+
+	path := fmt.Sprintf("%s/layered.yaml", tmpDir)
+
+	err := ioutil.WriteFile(path, []byte(testYamlConfig), 0600)
+	if err != nil {
+		t.Errorf("failed writing config: %s", err)
+	}
+
+	_ = os.Setenv("ORION_USER_NAME", "envuser")
+	_ = os.Setenv("ORION_KEY_NAME", "envkey")
+	defer os.Unsetenv("ORION_USER_NAME")
+	defer os.Unsetenv("ORION_KEY_NAME")
+
+	loader := ConfigLoader{
+		Path: path,
+		Flags: map[string]string{
+			"keyname":             "flagkey",
+			"subnet-ids":          "subnet-2, subnet-3",
+			"template":            "https://example.com/orion-ptt-system.yaml",
+			"parameter-overrides": "VolumeSize=100, InstanceName=demo",
+			"kotsadm-password":    "hunter2",
+		},
+	}
+
+	config, sources, err := loader.Load()
+	if err != nil {
+		t.Errorf("failed loading config: %s", err)
+	}
+
+	assert.Equal(t, DEFAULT_INSTANCE_TYPE, config.InstanceType, "default not applied")
+	assert.Equal(t, "file.example.com", config.DNSDomain, "file value not applied")
+	assert.Equal(t, "envuser", config.Username, "env value not applied")
+	assert.Equal(t, "flagkey", config.KeyName, "flag value not applied")
+	assert.Equal(t, []string{"subnet-2", "subnet-3"}, config.SubnetIDs, "flag list not applied")
+	assert.Equal(t, "https://example.com/orion-ptt-system.yaml", config.TemplateURL, "renamed flag not applied")
+	assert.Equal(t, map[string]string{"VolumeSize": "100", "InstanceName": "demo"}, config.ParameterOverrides, "flag map not applied")
+	assert.Equal(t, "", config.KotsadmPassword, "secret taken from a flag")
+
+	assert.Equal(t, SOURCE_DEFAULT, sources["instance_type"], "default source doesn't meet expectations")
+	assert.Equal(t, fmt.Sprintf("file %s (profile %s)", path, DEFAULT_PROFILE), sources["dns_domain"], "file source doesn't meet expectations")
+	assert.Equal(t, "env ORION_USER_NAME", sources["user_name"], "env source doesn't meet expectations")
+	assert.Equal(t, "flag --keyname", sources["key_name"], "flag source doesn't meet expectations")
+	assert.Equal(t, SOURCE_UNSET, sources["license_file"], "unset source doesn't meet expectations")
+	assert.Equal(t, SOURCE_UNSET, sources["kotsadm_password"], "secret source doesn't meet expectations")
+}
+
+func TestConfigLoaderBadValue(t *testing.T) {
+	clearSecrets(t)
+
+	loader := ConfigLoader{
+		Path: fmt.Sprintf("%s/does-not-exist.json", tmpDir),
+		Flags: map[string]string{
+			"parameter-overrides": "VolumeSize",
+		},
+	}
+
+	_, _, err := loader.Load()
+	assert.Error(t, err, "expected a bad map to fail")
+}
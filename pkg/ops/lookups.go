@@ -3,110 +3,244 @@ package ops
 import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/pkg/errors"
 	"sort"
 	"strings"
-	"time"
 )
 
+// LookupZoneID returns the ID of the hosted zone serving dns_domain: zone_id if it's set, otherwise the best match of every zone in the account.  See SelectZone.
 func (s *Stack) LookupZoneID() (id string, err error) {
-	client := route53.New(s.AwsSession)
+	var zone HostedZone
 
-	input := route53.ListHostedZonesInput{}
+	if s.Config.ZoneID != "" {
+		zone, err = s.DescribeHostedZone(s.Config.ZoneID)
+		if err != nil {
+			return id, err
+		}
+
+		if !zone.Contains(s.Config.DNSDomain) {
+			err = errors.New(fmt.Sprintf("zone %s (%s) can't serve %s", zone.ID, zone.Name, s.Config.DNSDomain))
+			return id, err
+		}
+
+		id = zone.ID
 
-	output, err := client.ListHostedZones(&input)
+		return id, err
+	}
+
+	zones, err := s.DescribeHostedZones()
 	if err != nil {
-		err = errors.Wrapf(err, "failed to list hosted zones")
 		return id, err
 	}
 
-	for _, z := range output.HostedZones {
-		if *z.Name == fmt.Sprintf("%s.", s.Config.DNSDomain) {
-			id = strings.TrimPrefix(*z.Id, "/hostedzone/")
-			return id, err
-		}
+	zone, err = SelectZone(zones, s.Config.DNSDomain)
+	if err != nil {
+		return id, err
+	}
+
+	if zone.Private {
+		fmt.Printf("Using private zone %s (%s) for %s.  Its records won't resolve outside the VPCs it's associated with.\n", zone.Name, zone.ID, s.Config.DNSDomain)
 	}
 
-	err = errors.New("No Zone found")
+	id = zone.ID
 
 	return id, err
 }
 
+// LookupAmiID returns the base AMI for the stack.  See LocalAmiID.  If the image isn't in the stack's region, and ami_source_region is set, it's copied from there.
 func (s *Stack) LookupAmiID() (id string, err error) {
-	svc := ec2.New(s.AwsSession)
+	id, err = s.LocalAmiID()
+	if err != nil || id != "" {
+		return id, err
+	}
+
+	if s.Config.AMISourceRegion != "" {
+		fmt.Printf("Base AMI not found in this region.  Looking in %s.\n", s.Config.AMISourceRegion)
+		id, err = s.CopyAmi()
+		return id, err
+	}
+
+	err = errors.New("no ami found")
+
+	return id, err
+}
+
+// LocalAmiID returns the base AMI for the stack in its own region: ami_id if it's pinned, otherwise the newest image matching ami_name whose architecture suits the instance type.  Returns an empty id, and no error, if there's no such image in the region.
+func (s *Stack) LocalAmiID() (id string, err error) {
+	if s.Config.AMIID != "" {
+		image, err := s.DescribeAmi(s.Config.AMIID)
+		if err != nil {
+			var aerr awserr.Error
+			if errors.As(err, &aerr) && aerr.Code() == "InvalidAMIID.NotFound" {
+				err = nil
+			}
+
+			return id, err
+		}
 
-	fmt.Printf("Looking for AMI's owned by %s named %s\n", orionAccount, s.Config.AMIName)
+		err = CheckImageArchitecture(image, s.Config.InstanceType)
+		if err != nil {
+			return id, err
+		}
+
+		fmt.Printf("Using pinned AMI %s (%s)\n", s.Config.AMIID, aws.StringValue(image.Name))
 
-	descImagesInput := &ec2.DescribeImagesInput{
-		Owners: []*string{
-			aws.String(orionAccount),
-		},
+		id = s.Config.AMIID
 
-		Filters: []*ec2.Filter{
-			{
-				Name: aws.String("name"),
-				Values: []*string{
-					aws.String(s.Config.AMIName),
-				},
-			},
-		},
+		return id, err
 	}
 
-	iOutput, err := svc.DescribeImages(descImagesInput)
+	arch := Architecture(s.Config.InstanceType)
+
+	fmt.Printf("Looking for %s AMI's owned by %s named %s\n", arch, orionAccount, s.Config.AMIName)
+
+	images, err := s.DescribeAmis(s.Config.AMIName, arch)
 	if err != nil {
-		err = errors.Wrapf(err, "failed describing images")
 		return id, err
 	}
 
-	layout := "2006-01-02T15:04:05.000Z"
+	if len(images) > 0 {
+		id = aws.StringValue(images[0].ImageId)
+	}
 
-	if len(iOutput.Images) > 0 {
-		sort.Slice(iOutput.Images, func(i, j int) bool {
+	return id, err
+}
 
-			t1, _ := time.Parse(layout, *iOutput.Images[i].CreationDate)
-			t2, _ := time.Parse(layout, *iOutput.Images[j].CreationDate)
+// LookupNetwork chooses the subnet the stack is created in, and returns it with its VPC.  See SelectSubnet.
+func (s *Stack) LookupNetwork() (vpcID string, subnetID string, err error) {
+	subnets, err := s.DescribeSubnets()
+	if err != nil {
+		return vpcID, subnetID, err
+	}
 
-			return t2.Before(t1)
-		})
+	stacksPerAZ := make(map[string]int)
 
-		id = *iOutput.Images[0].ImageId
+	if s.Config.SubnetID == "" && s.Config.SubnetStrategy == SUBNET_STRATEGY_ROUND_ROBIN {
+		stacksPerAZ, err = s.StacksPerAZ(subnets)
+		if err != nil {
+			return vpcID, subnetID, err
+		}
+	}
 
-		return id, err
+	selection, err := s.Config.SelectSubnet(subnets, stacksPerAZ)
+	if err != nil {
+		return vpcID, subnetID, err
 	}
 
-	err = errors.New("no ami found")
+	fmt.Printf("Using subnet %s in %s (%s): %s\n", selection.Subnet.ID, selection.Subnet.AZ, selection.Subnet.VpcID, selection.Reason)
 
-	return id, err
+	vpcID = selection.Subnet.VpcID
+	subnetID = selection.Subnet.ID
+
+	return vpcID, subnetID, err
 }
 
-// LookupNetwork looks up VPC and subnetID based on allowable subnets supplied by config file.  Returns first match.  Basically a crude means of detecting which VPC we're running in.
-func (s *Stack) LookupNetwork() (vpcID string, subnetID string, err error) {
+// Choice  A value offered in a menu, with a human readable label.
+type Choice struct {
+	Value string
+	Label string
+}
+
+// ListKeyPairs lists the EC2 key pairs in the stack's region.
+func (s *Stack) ListKeyPairs() (choices []Choice, err error) {
+	choices = make([]Choice, 0)
+
 	client := ec2.New(s.AwsSession)
 
-	input := ec2.DescribeSubnetsInput{}
+	output, err := client.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing key pairs")
+		return choices, err
+	}
+
+	for _, k := range output.KeyPairs {
+		choices = append(choices, Choice{
+			Value: aws.StringValue(k.KeyName),
+			Label: aws.StringValue(k.KeyName),
+		})
+	}
+
+	sort.Slice(choices, func(i, j int) bool { return choices[i].Value < choices[j].Value })
 
-	output, err := client.DescribeSubnets(&input)
+	return choices, err
+}
+
+// ListHostedZones lists every Route53 hosted zone in the account.  The values are domain names, without the trailing dot.
+func (s *Stack) ListHostedZones() (choices []Choice, err error) {
+	choices = make([]Choice, 0)
+
+	zones, err := s.DescribeHostedZones()
 	if err != nil {
-		err = errors.Wrapf(err, "unable to describe subnets")
-		return vpcID, subnetID, err
+		return choices, err
+	}
 
+	for _, z := range zones {
+		visibility := "public"
+		if z.Private {
+			visibility = "private"
+		}
+
+		choices = append(choices, Choice{
+			Value: z.Name,
+			Label: fmt.Sprintf("%s (%s, %s)", z.Name, visibility, z.ID),
+		})
 	}
 
-	possibleNetworks := s.Config.SubnetIDs
+	sort.Slice(choices, func(i, j int) bool { return choices[i].Label < choices[j].Label })
 
-	// loop over the subnets we see, return VPC and subnetID of first match.
-	for _, sn := range output.Subnets {
-		if StringInSlice(*sn.SubnetId, possibleNetworks) {
-			vpcID = *sn.VpcId
-			subnetID = *sn.SubnetId
+	return choices, err
+}
 
-			return vpcID, subnetID, err
+// ListSubnets lists the subnets in the stack's region, labelled with their VPC, availability zone, and tags.
+func (s *Stack) ListSubnets() (choices []Choice, err error) {
+	choices = make([]Choice, 0)
+
+	client := ec2.New(s.AwsSession)
+
+	err = client.DescribeSubnetsPages(&ec2.DescribeSubnetsInput{}, func(page *ec2.DescribeSubnetsOutput, lastPage bool) bool {
+		for _, sn := range page.Subnets {
+			tags := make([]string, 0)
+			for _, t := range sn.Tags {
+				tags = append(tags, fmt.Sprintf("%s=%s", aws.StringValue(t.Key), aws.StringValue(t.Value)))
+			}
+
+			sort.Strings(tags)
+
+			choices = append(choices, Choice{
+				Value: aws.StringValue(sn.SubnetId),
+				Label: fmt.Sprintf("%s  %s  %s  %s", aws.StringValue(sn.SubnetId), aws.StringValue(sn.VpcId), aws.StringValue(sn.AvailabilityZone), strings.Join(tags, ",")),
+			})
 		}
+
+		return true
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "unable to describe subnets")
+		return choices, err
 	}
 
-	err = errors.New("No VPC or Subnets matching Config found.")
+	sort.Slice(choices, func(i, j int) bool { return choices[i].Value < choices[j].Value })
 
-	return vpcID, subnetID, err
+	return choices, err
+}
+
+// ListAmis lists the AMI's owned by the Orion account whose names match pattern, newest first.
+func (s *Stack) ListAmis(pattern string) (choices []Choice, err error) {
+	choices = make([]Choice, 0)
+
+	images, err := s.DescribeAmis(pattern, "")
+	if err != nil {
+		return choices, err
+	}
+
+	for _, i := range images {
+		choices = append(choices, Choice{
+			Value: aws.StringValue(i.Name),
+			Label: fmt.Sprintf("%s (%s, %s, created %s)", aws.StringValue(i.Name), aws.StringValue(i.ImageId), aws.StringValue(i.Architecture), aws.StringValue(i.CreationDate)),
+		})
+	}
+
+	return choices, err
 }
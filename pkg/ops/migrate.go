@@ -0,0 +1,194 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+)
+
+// CONFIG_VERSION Current version of the config file format.  Files without a version are version 1.
+const CONFIG_VERSION = 3
+
+// CONFIG_VERSION_KEY Top level config file key holding the format version.
+const CONFIG_VERSION_KEY = "version"
+
+// ConfigMigration  Rewrites raw config file content from one version to the next.
+type ConfigMigration struct {
+	From        int
+	Description string
+	Migrate     func(raw map[string]interface{}) (migrated map[string]interface{}, err error)
+}
+
+// configMigrations  Every migration, in order.  Add one here, and bump CONFIG_VERSION, whenever the config file format changes.
+var configMigrations = []ConfigMigration{
+	{
+		From:        1,
+		Description: "moved top level settings into the 'default' profile, and inlined 'shared_config' subnet ids",
+		Migrate:     migrateV1,
+	},
+	{
+		From:        2,
+		Description: "replaced 'beta' with 'template_url'",
+		Migrate:     migrateV2,
+	},
+}
+
+// ConfigVersion returns the format version of raw config file content.
+func ConfigVersion(raw map[string]interface{}) (version int, err error) {
+	v, ok := raw[CONFIG_VERSION_KEY]
+	if !ok {
+		version = 1
+		return version, err
+	}
+
+	f, ok := v.(float64)
+	if !ok || f != float64(int(f)) || f < 1 {
+		err = errors.New(fmt.Sprintf("config version must be a whole number, got %v", v))
+		return version, err
+	}
+
+	version = int(f)
+
+	return version, err
+}
+
+// MigrateConfig brings raw config file content up to CONFIG_VERSION.  Returns the migrated content and a description of each migration applied.
+func MigrateConfig(raw map[string]interface{}) (migrated map[string]interface{}, applied []string, err error) {
+	migrated = raw
+	applied = make([]string, 0)
+
+	version, err := ConfigVersion(raw)
+	if err != nil {
+		return migrated, applied, err
+	}
+
+	if version > CONFIG_VERSION {
+		err = errors.New(fmt.Sprintf("config version %d is newer than this version of ops understands (%d).  Upgrade ops.", version, CONFIG_VERSION))
+		return migrated, applied, err
+	}
+
+	for _, m := range configMigrations {
+		if m.From < version {
+			continue
+		}
+
+		migrated, err = m.Migrate(migrated)
+		if err != nil {
+			err = errors.Wrapf(err, "failed migrating config from version %d", m.From)
+			return migrated, applied, err
+		}
+
+		migrated[CONFIG_VERSION_KEY] = m.From + 1
+		applied = append(applied, fmt.Sprintf("v%d -> v%d: %s", m.From, m.From+1, m.Description))
+	}
+
+	return migrated, applied, err
+}
+
+// migrateV1 wraps flat files into a 'default' profile, and replaces 'shared_config' file references with the subnet ids they contain.
+func migrateV1(raw map[string]interface{}) (migrated map[string]interface{}, err error) {
+	migrated = raw
+
+	if _, ok := raw["profiles"]; !ok {
+		migrated = map[string]interface{}{
+			"profiles": map[string]interface{}{
+				DEFAULT_PROFILE: raw,
+			},
+		}
+	}
+
+	profiles, ok := migrated["profiles"].(map[string]interface{})
+	if !ok {
+		err = errors.New("'profiles' must be a map of profile names to settings")
+		return migrated, err
+	}
+
+	for name, p := range profiles {
+		profile, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		sharedPath, ok := profile["shared_config"].(string)
+		if !ok {
+			continue
+		}
+
+		delete(profile, "shared_config")
+
+		if sharedPath == "" {
+			continue
+		}
+
+		if _, ok := profile["subnet_ids"]; ok {
+			continue
+		}
+
+		path, err := homedir.Expand(sharedPath)
+		if err != nil {
+			err = errors.Wrapf(err, "failed expanding %s", sharedPath)
+			return migrated, err
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			err = errors.Wrapf(err, "profile %s: failed reading shared config %s.  Move its subnet_ids into the profile, and remove shared_config", name, path)
+			return migrated, err
+		}
+
+		shared := make(map[string]interface{})
+		err = json.Unmarshal(content, &shared)
+		if err != nil {
+			err = errors.Wrapf(err, "profile %s: failed parsing shared config %s", name, path)
+			return migrated, err
+		}
+
+		if subnets, ok := shared["subnet_ids"]; ok {
+			profile["subnet_ids"] = subnets
+		}
+	}
+
+	return migrated, err
+}
+
+// migrateV2 replaces the 'beta' flag with the beta template's url.  The key is matched regardless of case: before it had a json tag, it was written as 'Beta'.
+func migrateV2(raw map[string]interface{}) (migrated map[string]interface{}, err error) {
+	migrated = raw
+
+	profiles, ok := migrated["profiles"].(map[string]interface{})
+	if !ok {
+		return migrated, err
+	}
+
+	for _, p := range profiles {
+		profile, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		enabled := false
+
+		for k, v := range profile {
+			if !strings.EqualFold(k, "beta") {
+				continue
+			}
+
+			delete(profile, k)
+
+			if b, _ := v.(bool); b {
+				enabled = true
+			}
+		}
+
+		if enabled {
+			if _, ok := profile["template_url"]; !ok {
+				profile["template_url"] = BETA_TEMPLATE_URL
+			}
+		}
+	}
+
+	return migrated, err
+}
@@ -0,0 +1,151 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	sharedPath := fmt.Sprintf("%s/migrate-shared.json", tmpDir)
+
+	err := ioutil.WriteFile(sharedPath, []byte(`{"subnet_ids": ["subnet-1", "subnet-2"]}`), 0600)
+	if err != nil {
+		t.Errorf("failed writing shared config: %s", err)
+	}
+
+	cases := []struct {
+		name     string
+		content  string
+		expected string
+		applied  int
+		err      bool
+	}{
+		{
+			"flat with shared config",
+			fmt.Sprintf(`{"dns_domain": "example.com", "shared_config": %q}`, sharedPath),
+			`{"profiles": {"default": {"dns_domain": "example.com", "subnet_ids": ["subnet-1", "subnet-2"]}}, "version": 3}`,
+			2,
+			false,
+		},
+		{
+			"v1 profiles keep their own subnets",
+			fmt.Sprintf(`{"profiles": {"dev": {"subnet_ids": ["subnet-9"], "shared_config": %q}}}`, sharedPath),
+			`{"profiles": {"dev": {"subnet_ids": ["subnet-9"]}}, "version": 3}`,
+			2,
+			false,
+		},
+		{
+			"beta becomes template_url",
+			`{"profiles": {"dev": {"beta": true}, "qa": {"beta": false}}, "version": 2}`,
+			fmt.Sprintf(`{"profiles": {"dev": {"template_url": %q}, "qa": {}}, "version": 3}`, BETA_TEMPLATE_URL),
+			1,
+			false,
+		},
+		{
+			"Beta, as written before it had a json tag",
+			`{"stack_name": "demo", "Beta": true, "subnet_ids": ["subnet-1"]}`,
+			fmt.Sprintf(`{"profiles": {"default": {"stack_name": "demo", "subnet_ids": ["subnet-1"], "template_url": %q}}, "version": 3}`, BETA_TEMPLATE_URL),
+			2,
+			false,
+		},
+		{
+			"current",
+			`{"profiles": {}, "version": 3}`,
+			`{"profiles": {}, "version": 3}`,
+			0,
+			false,
+		},
+		{
+			"missing shared config",
+			`{"shared_config": "/nonexistent/shared.json"}`,
+			"",
+			0,
+			true,
+		},
+		{
+			"from the future",
+			`{"profiles": {}, "version": 99}`,
+			"",
+			0,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := make(map[string]interface{})
+			err := json.Unmarshal([]byte(tc.content), &raw)
+			if err != nil {
+				t.Errorf("bad test content: %s", err)
+			}
+
+			migrated, applied, err := MigrateConfig(raw)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.applied, len(applied), "number of migrations doesn't meet expectations")
+
+			actual, err := json.Marshal(migrated)
+			if err != nil {
+				t.Errorf("failed marshalling migrated config: %s", err)
+			}
+
+			assert.JSONEq(t, tc.expected, string(actual), "migrated config doesn't meet expectations")
+		})
+	}
+}
+
+func TestReadBaselineConfigFile(t *testing.T) {
+	// as written by 'ops config' before config files were versioned.
+	baseline := `{
+  "stack_name": "demo",
+  "key_name": "nik",
+  "dns_domain": "example.com",
+  "instance_type": "m5.2xlarge",
+  "user_name": "nik",
+  "license_file": "/tmp/orion.license.yaml",
+  "config_template": "https://orion-ptt-system-templates.s3.us-east-1.amazonaws.com/orion-ptt-system.tmpl",
+  "kotsadm_password": "hunter2",
+  "ami_name": "orion-base*",
+  "Beta": %t,
+  "subnet_ids": [
+    "subnet-1"
+  ]
+}`
+
+	cases := []struct {
+		name     string
+		beta     bool
+		template interface{}
+	}{
+		{"beta", true, BETA_TEMPLATE_URL},
+		{"not beta", false, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := fmt.Sprintf("%s/baseline-%t.json", tmpDir, tc.beta)
+
+			err := ioutil.WriteFile(path, []byte(fmt.Sprintf(baseline, tc.beta)), 0600)
+			if err != nil {
+				t.Fatalf("failed writing config: %s", err)
+			}
+
+			file, err := ReadConfigFile(path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			profile := file.Profiles[DEFAULT_PROFILE]
+			assert.Equal(t, "demo", profile["stack_name"], "stack name doesn't meet expectations")
+			assert.Equal(t, tc.template, profile["template_url"], "template url doesn't meet expectations")
+			assert.NotContains(t, profile, "Beta", "Beta wasn't migrated")
+		})
+	}
+}
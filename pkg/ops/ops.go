@@ -18,19 +18,13 @@ package ops
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
-	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
-	"gopkg.in/yaml.v3"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -77,14 +71,10 @@ const CONFIG_FILE_TEMPLATE = `{
   "license_file": "",
   "instance_type": "m5.2xlarge",
   "ami_name": "orion-base*",
-  "config_template": "https://orion-ptt-system-templates.s3.us-east-1.amazonaws.com/orion-ptt-system.tmpl",
+  "config_template": "https://orion-ptt-system-templates.s3.us-east-1.amazonaws.com/orion-ptt-system.tmpl"
 }
 `
 
-type SimpleCFTemplate struct {
-	Description string `yaml:"Description"`
-}
-
 type OnpremConfig struct {
 	Keystore  string
 	StackName string
@@ -96,21 +86,35 @@ type Stack struct {
 	Config       *StackConfig
 	AwsSession   *session.Session
 	AutoRollback bool
+	createdVpcID string // the VPC this Stack created, if any.  See CreatedVpcID.
 }
 
-// StackConfig  Config information for an Orion PTT System CloudFormation stack.
+// StackConfig  Config information for an Orion PTT System CloudFormation stack.  The struct tags drive the config file keys, CLI flags, and ORION_* environment variables alike.  See ConfigFields().
 type StackConfig struct {
-	StackName       string `json:"stack_name"`
-	KeyName         string `json:"key_name"`
-	DNSDomain       string `json:"dns_domain"`
-	InstanceType    string `json:"instance_type"`
-	Username        string `json:"user_name"`
-	LicenseFile     string `json:"license_file"`
-	ConfigTemplate  string `json:"config_template"`
-	KotsadmPassword string `json:"kotsadm_password"`
-	AMIName         string `json:"ami_name"`
-	Beta            bool
-	SubnetIDs       []string `json:"subnet_ids"`
+	StackName          string            `json:"stack_name" flag:"name" usage:"environment name"`
+	AWSAccount         string            `json:"aws_account" flag:"account" usage:"alias of an account in the config file's accounts section, whose role is assumed.  Defaults to the account of the AWS SDK credentials"`
+	Region             string            `json:"region" usage:"AWS region.  Defaults to $AWS_REGION, or the AWS SDK config.  Commands acting on an existing stack look for it in every region if this isn't set"`
+	KeyName            string            `json:"key_name" flag:"keyname" usage:"ssh key name"`
+	DNSDomain          string            `json:"dns_domain" usage:"DNS domain, served by a Route53 hosted zone in the account"`
+	ZoneID             string            `json:"zone_id" usage:"Route53 hosted zone id, instead of looking up the zone serving dns_domain"`
+	InstanceType       string            `json:"instance_type" usage:"EC2 instance type"`
+	Username           string            `json:"user_name" usage:"user name for ssh access to the instance"`
+	LicenseFile        string            `json:"license_file" usage:"path to the Orion PTT System license file"`
+	ConfigTemplate     string            `json:"config_template" usage:"path, S3 or git url of the kots config template"`
+	KotsadmPassword    string            `json:"kotsadm_password" secret:"true" usage:"kotsadm console password"`
+	AMIName            string            `json:"ami_name" usage:"name pattern of the base AMI.  The latest match is used"`
+	AMIID              string            `json:"ami_id" flag:"ami" usage:"base AMI id, pinning the image instead of using the latest match of ami_name"`
+	AMISourceRegion    string            `json:"ami_source_region" usage:"region the base AMI is copied from, if it isn't published in the stack's region"`
+	TemplateURL        string            `json:"template_url" flag:"template" usage:"CloudFormation template: an https url, s3://bucket/key?versionId=..., or a local file"`
+	TemplateBucket     string            `json:"template_bucket" usage:"S3 bucket local templates too big to send directly are staged in"`
+	NetworkMode        string            `json:"network_mode" usage:"existing: create the stack in one of the account's subnets.  create: create a dedicated VPC for it, removed when it's destroyed"`
+	SubnetIDs          []string          `json:"subnet_ids" usage:"comma separated list of subnet ids the stack may be created in"`
+	SubnetTags         map[string]string `json:"subnet_tags" usage:"tags selecting subnets the stack may be created in, as comma separated Key=Value pairs, e.g. orion:use=true"`
+	SubnetID           string            `json:"subnet_id" flag:"subnet" usage:"subnet to create the stack in, overriding subnet_ids, subnet_tags and subnet_strategy"`
+	SubnetStrategy     string            `json:"subnet_strategy" usage:"how the subnet is chosen from the candidates: az-order, most-free-ips or round-robin"`
+	PreferredAZs       []string          `json:"preferred_azs" usage:"comma separated list of availability zones, most preferred first"`
+	ParameterOverrides map[string]string `json:"parameter_overrides" usage:"CloudFormation template parameters to set, as comma separated Key=Value pairs, e.g. VolumeSize=100"`
+	Account            *Account          `json:"-"` // the aws_account, as defined in the config file.  Set by the ConfigLoader.
 }
 
 // NewStack  Creates a new programmatic representation of a Stack.  Creates the object/interface.  Doesn't actually create it in AWS until you call Init().
@@ -124,6 +128,16 @@ func NewStack(config *StackConfig, awsSession *session.Session, autorollback boo
 		awsSession = sess
 	}
 
+	if config.Account != nil {
+		awsSession = AccountSession(awsSession, *config.Account)
+	}
+
+	if config.Region != "" {
+		awsSession = awsSession.Copy(&aws.Config{Region: aws.String(config.Region)})
+	}
+
+	config.RegisterSecrets()
+
 	s := Stack{
 		Config:       config,
 		AwsSession:   awsSession,
@@ -135,83 +149,99 @@ func NewStack(config *StackConfig, awsSession *session.Session, autorollback boo
 	return stack, err
 }
 
-// LoadConfig Loads a config file from the filesystem.
-func LoadConfig(configPath string) (config *StackConfig, err error) {
-	config = &StackConfig{}
-
-	if configPath == "" || configPath == "~/.orion-ptt-system.json" {
-		hd, err := homedir.Dir()
-		if err != nil {
-			err = errors.Wrapf(err, "failed to read home directory")
-			return config, err
-		}
-
-		configPath = fmt.Sprintf("%s/%s", hd, DEFAULT_CONFIG_FILE)
+// LoadConfig Loads a profile from the config file on the filesystem, layered over the defaults and under any ORION_* environment variables.  If profile is empty, $ORION_PROFILE or the file's default profile is used.  Secret references such as 'ssm:/orion/kotsadm-password' are resolved on load.  Use a ConfigLoader to apply CLI flags as well.
+func LoadConfig(configPath string, profile string) (config *StackConfig, err error) {
+	loader := ConfigLoader{
+		Path:    configPath,
+		Profile: profile,
 	}
 
-	// only load the file if it exists
-	if _, e := os.Stat(configPath); e == nil {
-		c, err := ioutil.ReadFile(configPath)
-		if err != nil {
-			err = errors.Wrapf(err, "failed to read config file %s", configPath)
-			return config, err
-		}
-
-		err = json.Unmarshal(c, &config)
-		if err != nil {
-			err = errors.Wrapf(err, "failed to unmarshal json in %s", configPath)
-			return config, err
-		}
-	}
+	config, _, err = loader.Load()
 
 	return config, err
 }
 
-// AskForValue  Asks the user for any value not found in the config file.
-func AskForValue(parameter string) (value string) {
+// AskForValue  Asks the user for any value not found in the config file.  Fails in non-interactive mode, or if stdin is closed.
+func AskForValue(parameter string) (value string, err error) {
+	if NonInteractive {
+		err = &MissingParamsError{Params: []string{parameter}}
+		return value, err
+	}
+
 	fmt.Printf("\nPlease enter a value for %s:\n", parameter)
 	fmt.Println()
 
 	reader := bufio.NewReader(os.Stdin)
 	input, err := reader.ReadString('\n')
 	if err != nil {
-		log.Fatal("failed to read response")
+		err = errors.Wrapf(err, "failed to read value for %s", parameter)
+		return value, err
 	}
 
 	value = strings.TrimRight(input, "\n")
 
-	return value
+	return value, err
 }
 
-// AskForMissingParams Examines the config object and calls AskForValue() on any misisng value.
-func (c *StackConfig) AskForMissingParams(keyNeeded bool) (err error) {
-	if c.StackName == "" {
-		c.StackName = AskForValue("Stack Name")
+// AskForMissingParams Examines the config object and calls AskForValue() on any misisng value.  Which values are required comes from MissingFields(): all of them to create a stack, or only the config keys given, for commands that need fewer.  Required values there's no prompt for, e.g. kotsadm_password, are reported rather than asked for.  In non-interactive mode nothing is asked, and every missing value is reported in a single MissingParamsError, by config key.
+func (c *StackConfig) AskForMissingParams(keys ...string) (err error) {
+	if c.InstanceType == "" {
+		c.InstanceType = DEFAULT_INSTANCE_TYPE
+	}
+
+	prompts := map[string]struct {
+		prompt string
+		value  *string
+	}{
+		"stack_name": {"Stack Name", &c.StackName},
+		"key_name":   {"SSH Key Name", &c.KeyName},
+		"dns_domain": {"DNS Domain", &c.DNSDomain},
+		"ami_name":   {"AMI Name (orionbase-*)", &c.AMIName},
 	}
 
-	if keyNeeded {
-		if c.KeyName == "" {
-			c.KeyName = AskForValue("SSH Key Name")
+	missing := make([]string, 0)
+	unpromptable := make([]string, 0)
+
+	for _, key := range c.MissingFields() {
+		if len(keys) > 0 && !StringInSlice(key, keys) {
+			continue
+		}
+
+		missing = append(missing, key)
+
+		if _, ok := prompts[key]; !ok {
+			unpromptable = append(unpromptable, key)
 		}
 	}
 
-	if c.DNSDomain == "" {
-		c.DNSDomain = AskForValue("DNS Domain")
+	if len(missing) == 0 {
+		return err
 	}
 
-	if c.AMIName == "" {
-		c.AMIName = AskForValue("AMI Name (orionbase-*)")
+	if NonInteractive {
+		err = &MissingParamsError{Params: missing}
+		return err
 	}
 
-	if c.InstanceType == "" {
-		c.InstanceType = DEFAULT_INSTANCE_TYPE
+	if len(unpromptable) > 0 {
+		err = &MissingParamsError{Params: unpromptable}
+		return err
+	}
+
+	for _, key := range missing {
+		p := prompts[key]
+
+		*p.value, err = AskForValue(p.prompt)
+		if err != nil {
+			return err
+		}
 	}
 
 	return err
 }
 
 func (s *Stack) CreateCFStackInput() (input cloudformation.CreateStackInput, err error) {
-	vpcID, subnetID, err := s.LookupNetwork()
+	vpcID, subnetID, err := s.Network()
 	if err != nil {
 		err = errors.Wrapf(err, "failed to select network")
 		return input, err
@@ -229,12 +259,55 @@ func (s *Stack) CreateCFStackInput() (input cloudformation.CreateStackInput, err
 		return input, err
 	}
 
-	var templateUrl string
-	if s.Config.Beta {
-		fmt.Printf("----- Using Beta Template -----\n")
-		templateUrl = BETA_TEMPLATE_URL
-	} else {
-		templateUrl = DEFAULT_TEMPLATE_URL
+	if s.Config.TemplateURL != "" {
+		fmt.Printf("----- Using Template %s -----\n", s.Config.TemplateURL)
+	}
+
+	params, err := s.Config.StackParameters([]*cloudformation.Parameter{
+		{
+			ParameterKey:   aws.String("ExistingVpcID"),
+			ParameterValue: aws.String(vpcID),
+		},
+		{
+			ParameterKey:   aws.String("ExistingPublicSubnet"),
+			ParameterValue: aws.String(subnetID),
+		},
+		{
+			ParameterKey:   aws.String("KeyName"),
+			ParameterValue: aws.String(s.Config.KeyName),
+		},
+		{
+			ParameterKey:   aws.String("AmiId"),
+			ParameterValue: aws.String(amiID),
+		},
+		{
+			ParameterKey:   aws.String("InstanceType"),
+			ParameterValue: aws.String(s.Config.InstanceType),
+		},
+		{
+			ParameterKey:   aws.String("VolumeSize"),
+			ParameterValue: aws.String(defaultParameters["VolumeSize"]),
+		},
+		{
+			ParameterKey:   aws.String("InstanceName"),
+			ParameterValue: aws.String(defaultParameters["InstanceName"]),
+		},
+		{
+			ParameterKey:   aws.String("CreateDNS"),
+			ParameterValue: aws.String(defaultParameters["CreateDNS"]),
+		},
+		{
+			ParameterKey:   aws.String("CreateDNSZoneID"),
+			ParameterValue: aws.String(zoneID),
+		},
+		{
+			ParameterKey:   aws.String("CreateDNSDomain"),
+			ParameterValue: aws.String(s.Config.DNSDomain),
+		},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "bad parameter_overrides")
+		return input, err
 	}
 
 	input = cloudformation.CreateStackInput{
@@ -242,50 +315,24 @@ func (s *Stack) CreateCFStackInput() (input cloudformation.CreateStackInput, err
 			aws.String("CAPABILITY_NAMED_IAM"),
 			//aws.String("CAPABILITY_IAM"),
 		},
-		Parameters: []*cloudformation.Parameter{
+		Parameters: params,
+		StackName:  aws.String(s.Config.StackName),
+		Tags: []*cloudformation.Tag{
 			{
-				ParameterKey:   aws.String("ExistingVpcID"),
-				ParameterValue: aws.String(vpcID),
+				Key:   aws.String(TAG_MANAGED_BY),
+				Value: aws.String(MANAGED_BY_OPS),
 			},
 			{
-				ParameterKey:   aws.String("ExistingPublicSubnet"),
-				ParameterValue: aws.String(subnetID),
-			},
-			{
-				ParameterKey:   aws.String("KeyName"),
-				ParameterValue: aws.String(s.Config.KeyName),
-			},
-			{
-				ParameterKey:   aws.String("AmiId"),
-				ParameterValue: aws.String(amiID),
-			},
-			{
-				ParameterKey:   aws.String("InstanceType"),
-				ParameterValue: aws.String(s.Config.InstanceType),
-			},
-			{
-				ParameterKey:   aws.String("VolumeSize"),
-				ParameterValue: aws.String(strconv.Itoa(50)),
-			},
-			{
-				ParameterKey:   aws.String("InstanceName"),
-				ParameterValue: aws.String("orion-ptt-system"),
-			},
-			{
-				ParameterKey:   aws.String("CreateDNS"),
-				ParameterValue: aws.String("true"),
-			},
-			{
-				ParameterKey:   aws.String("CreateDNSZoneID"),
-				ParameterValue: aws.String(zoneID),
-			},
-			{
-				ParameterKey:   aws.String("CreateDNSDomain"),
-				ParameterValue: aws.String(s.Config.DNSDomain),
+				Key:   aws.String(TAG_AMI),
+				Value: aws.String(amiID),
 			},
 		},
-		StackName:   aws.String(s.Config.StackName),
-		TemplateURL: aws.String(templateUrl),
+	}
+
+	err = s.ApplyTemplate(&input)
+	if err != nil {
+		err = errors.Wrapf(err, "failed setting CF template")
+		return input, err
 	}
 
 	return input, err
@@ -301,6 +348,25 @@ func (s *Stack) Init() (id string, err error) {
 		return id, err
 	}
 
+	defer func() {
+		rmErr := s.RemoveStagedTemplate(&input)
+		if rmErr != nil {
+			log.Printf("%s", rmErr)
+		}
+	}()
+
+	template, err := s.FetchTemplate()
+	if err != nil {
+		err = errors.Wrapf(err, "failed fetching CF template")
+		return id, err
+	}
+
+	err = template.ValidateParameters(input.Parameters)
+	if err != nil {
+		err = errors.Wrapf(err, "stack parameters don't match the CF template")
+		return id, err
+	}
+
 	output, err := client.CreateStack(&input)
 	if err != nil {
 		err = errors.Wrapf(err, "Failed to create stack %s", s.Config.StackName)
@@ -340,6 +406,25 @@ func (s *Stack) Outputs() (outputs []*cloudformation.Output, err error) {
 	return outputs, err
 }
 
+// Output Fetches the value of a single stack output from AWS.
+func (s *Stack) Output(key string) (value string, err error) {
+	outputs, err := s.Outputs()
+	if err != nil {
+		return value, err
+	}
+
+	for _, o := range outputs {
+		if *o.OutputKey == key {
+			value = *o.OutputValue
+			return value, err
+		}
+	}
+
+	err = errors.New(fmt.Sprintf("no output %q found for stack %s", key, s.Config.StackName))
+
+	return value, err
+}
+
 // Params Fetches stack parameters from AWS.
 func (s *Stack) Params() (parameters []*cloudformation.Parameter, err error) {
 	client := cloudformation.New(s.AwsSession)
@@ -470,54 +555,40 @@ func DefaultSession() (awssession *session.Session, err error) {
 	return awssession, err
 }
 
-// ListStacks Queries the CF Yaml, and AWS, returning a list of stacks with a description that matches the description in the yaml template.
+// ListStacks Pages through every stack in the region, returning those ops created.  See IsOpsStack.  Only if some stack lacks the ops tag is the template description needed, and if it can't be had, untagged stacks are left out rather than failing.
 func (s *Stack) ListStacks() (stacks []*cloudformation.Stack, err error) {
 	stacks = make([]*cloudformation.Stack, 0)
-	var templateUrl string
-	if s.Config.Beta {
-		templateUrl = BETA_TEMPLATE_URL
-	} else {
-		templateUrl = DEFAULT_TEMPLATE_URL
-	}
 
-	resp, err := http.Get(templateUrl)
+	client := cloudformation.New(s.AwsSession)
+
+	all := make([]*cloudformation.Stack, 0)
+
+	err = client.DescribeStacksPages(&cloudformation.DescribeStacksInput{}, func(page *cloudformation.DescribeStacksOutput, lastPage bool) bool {
+		all = append(all, page.Stacks...)
+		return true
+	})
 	if err != nil {
-		err = errors.Wrapf(err, "error getting %s", templateUrl)
+		err = errors.Wrapf(err, "failed describing stacks")
 		return stacks, err
 	}
 
-	if resp.StatusCode == 200 {
-		defer resp.Body.Close()
-
-		yamlBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			err = errors.Wrapf(err, "failed reading response body")
-			return stacks, err
-		}
-
-		var cfTemplate SimpleCFTemplate
+	description := ""
+	fetched := false
 
-		err = yaml.Unmarshal(yamlBytes, &cfTemplate)
-		if err != nil {
-			err = errors.Wrapf(err, "failed unmarshalling CF yaml.")
-			return stacks, err
-		}
-
-		client := cloudformation.New(s.AwsSession)
+	for _, stack := range all {
+		if !IsOpsStack(stack, "") && !fetched {
+			fetched = true
 
-		input := cloudformation.DescribeStacksInput{}
+			d, e := s.TemplateDescription()
+			if e != nil {
+				log.Printf("Only listing stacks tagged %s=%s: %s\n", TAG_MANAGED_BY, MANAGED_BY_OPS, e)
+			}
 
-		output, err := client.DescribeStacks(&input)
-		if err != nil {
-			return stacks, err
+			description = d
 		}
 
-		for _, s := range output.Stacks {
-			if s.Description != nil {
-				if *s.Description == cfTemplate.Description {
-					stacks = append(stacks, s)
-				}
-			}
+		if IsOpsStack(stack, description) {
+			stacks = append(stacks, stack)
 		}
 	}
 
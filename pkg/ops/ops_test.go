@@ -373,7 +373,80 @@ func TestCreateCFStackInput(t *testing.T) {
 						ParameterValue: aws.String(dnsDomain),
 					},
 				},
-				StackName:   aws.String(stackName),
+				StackName: aws.String(stackName),
+				Tags: []*cloudformation.Tag{
+					{Key: aws.String(TAG_MANAGED_BY), Value: aws.String(MANAGED_BY_OPS)},
+					{Key: aws.String(TAG_AMI), Value: aws.String(ami)},
+				},
+				TemplateURL: aws.String("https://orion-ptt-system.s3.amazonaws.com/orion-ptt-system.yaml"),
+			},
+		},
+		{
+			"parameter overrides",
+			StackConfig{
+				StackName:      stackName,
+				KeyName:        "Nik",
+				DNSDomain:      dnsDomain,
+				InstanceType:   instanceType,
+				Username:       orionuser,
+				LicenseFile:    licensefile,
+				ConfigTemplate: templatefile,
+				AMIName:        amiName,
+				SubnetIDs:      subnetIds,
+				ParameterOverrides: map[string]string{
+					"VolumeSize":   "100",
+					"InstanceName": "demo",
+				},
+			},
+			cloudformation.CreateStackInput{
+				Capabilities: []*string{aws.String("CAPABILITY_NAMED_IAM")},
+				Parameters: []*cloudformation.Parameter{
+					{
+						ParameterKey:   aws.String("ExistingVpcID"),
+						ParameterValue: aws.String(vpc),
+					},
+					{
+						ParameterKey:   aws.String("ExistingPublicSubnet"),
+						ParameterValue: aws.String(network),
+					},
+					{
+						ParameterKey:   aws.String("KeyName"),
+						ParameterValue: aws.String("Nik"),
+					},
+					{
+						ParameterKey:   aws.String("AmiId"),
+						ParameterValue: aws.String(ami),
+					},
+					{
+						ParameterKey:   aws.String("InstanceType"),
+						ParameterValue: aws.String("m5.2xlarge"),
+					},
+					{
+						ParameterKey:   aws.String("VolumeSize"),
+						ParameterValue: aws.String("100"),
+					},
+					{
+						ParameterKey:   aws.String("InstanceName"),
+						ParameterValue: aws.String("demo"),
+					},
+					{
+						ParameterKey:   aws.String("CreateDNS"),
+						ParameterValue: aws.String("true"),
+					},
+					{
+						ParameterKey:   aws.String("CreateDNSZoneID"),
+						ParameterValue: aws.String(zoneID),
+					},
+					{
+						ParameterKey:   aws.String("CreateDNSDomain"),
+						ParameterValue: aws.String(dnsDomain),
+					},
+				},
+				StackName: aws.String(stackName),
+				Tags: []*cloudformation.Tag{
+					{Key: aws.String(TAG_MANAGED_BY), Value: aws.String(MANAGED_BY_OPS)},
+					{Key: aws.String(TAG_AMI), Value: aws.String(ami)},
+				},
 				TemplateURL: aws.String("https://orion-ptt-system.s3.amazonaws.com/orion-ptt-system.yaml"),
 			},
 		},
@@ -434,7 +507,11 @@ func TestCreateCFStackInput(t *testing.T) {
 						ParameterValue: aws.String(dnsDomain),
 					},
 				},
-				StackName:   aws.String(stackName),
+				StackName: aws.String(stackName),
+				Tags: []*cloudformation.Tag{
+					{Key: aws.String(TAG_MANAGED_BY), Value: aws.String(MANAGED_BY_OPS)},
+					{Key: aws.String(TAG_AMI), Value: aws.String(ami)},
+				},
 				TemplateURL: aws.String("https://orion-ptt-system.s3.amazonaws.com/orion-ptt-system.yaml"),
 			},
 		},
@@ -495,7 +572,11 @@ func TestCreateCFStackInput(t *testing.T) {
 						ParameterValue: aws.String(dnsDomain),
 					},
 				},
-				StackName:   aws.String(stackName),
+				StackName: aws.String(stackName),
+				Tags: []*cloudformation.Tag{
+					{Key: aws.String(TAG_MANAGED_BY), Value: aws.String(MANAGED_BY_OPS)},
+					{Key: aws.String(TAG_AMI), Value: aws.String(ami)},
+				},
 				TemplateURL: aws.String("https://orion-ptt-system.s3.amazonaws.com/orion-ptt-system.yaml"),
 			},
 		},
@@ -0,0 +1,447 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// QUOTA_CODE_STANDARD_VCPUS Service quota code for running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instance vCPUs.
+const QUOTA_CODE_STANDARD_VCPUS = "L-1216C47A"
+
+// QUOTA_CODE_G_VCPUS Service quota code for running On-Demand G and VT instance vCPUs.
+const QUOTA_CODE_G_VCPUS = "L-DB2E81BA"
+
+// QUOTA_CODE_P_VCPUS Service quota code for running On-Demand P instance vCPUs.
+const QUOTA_CODE_P_VCPUS = "L-417A185B"
+
+// QUOTA_CODE_X_VCPUS Service quota code for running On-Demand X instance vCPUs.
+const QUOTA_CODE_X_VCPUS = "L-7295265B"
+
+// QUOTA_CODE_F_VCPUS Service quota code for running On-Demand F instance vCPUs.
+const QUOTA_CODE_F_VCPUS = "L-74FC7D96"
+
+// QUOTA_CODE_INF_VCPUS Service quota code for running On-Demand Inf instance vCPUs.
+const QUOTA_CODE_INF_VCPUS = "L-1945791B"
+
+// QUOTA_CODE_EIPS Service quota code for VPC Elastic IP addresses.
+const QUOTA_CODE_EIPS = "L-0263D0A3"
+
+// STACK_EIPS Elastic IPs a stack allocates.
+const STACK_EIPS = 1
+
+// stackNamePattern  What CloudFormation accepts as a stack name.
+var stackNamePattern = regexp.MustCompile(`^[a-zA-Z][-a-zA-Z0-9]*$`)
+
+// requiredActions  IAM actions the caller needs to create, manage, and destroy a stack.
+var requiredActions = []string{
+	"cloudformation:CreateStack",
+	"cloudformation:DeleteStack",
+	"cloudformation:DescribeStacks",
+	"ec2:RunInstances",
+	"ec2:DescribeImages",
+	"ec2:DescribeSubnets",
+	"ec2:DescribeKeyPairs",
+	"ec2:AllocateAddress",
+	"route53:ChangeResourceRecordSets",
+	"route53:ListHostedZones",
+	"iam:CreateRole",
+	"iam:PassRole",
+	"s3:GetObject",
+}
+
+// ValidateStackName checks that name is usable both as a CloudFormation stack name, and as the DNS label the stack's hostnames are built on.
+func ValidateStackName(name string) (err error) {
+	if name == "" {
+		err = errors.New("stack name is empty")
+		return err
+	}
+
+	if !stackNamePattern.MatchString(name) {
+		err = errors.New(fmt.Sprintf("stack name %q must start with a letter, and contain only letters, digits and hyphens", name))
+		return err
+	}
+
+	if len(name) > 63 {
+		err = errors.New(fmt.Sprintf("stack name %q is %d characters.  DNS labels can be at most 63", name, len(name)))
+		return err
+	}
+
+	if strings.HasSuffix(name, "-") {
+		err = errors.New(fmt.Sprintf("stack name %q can't end with a hyphen", name))
+		return err
+	}
+
+	return err
+}
+
+// VCPUQuotaCode returns the code of the service quota limiting running vCPUs of the instance type's family.
+func VCPUQuotaCode(instanceType string) (code string) {
+	family := strings.ToLower(strings.SplitN(instanceType, ".", 2)[0])
+
+	switch {
+	case strings.HasPrefix(family, "inf"):
+		code = QUOTA_CODE_INF_VCPUS
+	case strings.HasPrefix(family, "vt"), strings.HasPrefix(family, "g"):
+		code = QUOTA_CODE_G_VCPUS
+	case strings.HasPrefix(family, "p"):
+		code = QUOTA_CODE_P_VCPUS
+	case strings.HasPrefix(family, "x"):
+		code = QUOTA_CODE_X_VCPUS
+	case strings.HasPrefix(family, "f"):
+		code = QUOTA_CODE_F_VCPUS
+	default:
+		code = QUOTA_CODE_STANDARD_VCPUS
+	}
+
+	return code
+}
+
+// CheckHeadroom checks that using need more of a quota, on top of used, stays within limit.
+func CheckHeadroom(limit float64, used int, need int) (detail string, err error) {
+	detail = fmt.Sprintf("%d used, %d needed, limit %d", used, need, int(math.Floor(limit)))
+
+	if float64(used+need) > limit {
+		err = errors.New(fmt.Sprintf("not enough quota: %s", detail))
+		return detail, err
+	}
+
+	return detail, err
+}
+
+// ConflictingRecords returns the names of any records at name, or under it.
+func ConflictingRecords(records []*route53.ResourceRecordSet, name string) (conflicts []string) {
+	conflicts = make([]string, 0)
+
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	for _, r := range records {
+		recordName := strings.ToLower(strings.TrimSuffix(aws.StringValue(r.Name), "."))
+		if recordName == name || strings.HasSuffix(recordName, fmt.Sprintf(".%s", name)) {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s)", recordName, aws.StringValue(r.Type)))
+		}
+	}
+
+	return conflicts
+}
+
+// PrincipalArn converts a caller identity ARN to the ARN of the IAM principal whose policies apply.  Assumed role sessions map to their role.
+func PrincipalArn(callerArn string) (principal string, err error) {
+	parts := strings.SplitN(callerArn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		err = errors.New(fmt.Sprintf("malformed arn %q", callerArn))
+		return principal, err
+	}
+
+	resource := parts[5]
+
+	switch {
+	case resource == "root":
+		err = errors.New("the account root user can't be simulated")
+		return principal, err
+
+	case parts[2] == "sts" && strings.HasPrefix(resource, "assumed-role/"):
+		role := strings.Split(strings.TrimPrefix(resource, "assumed-role/"), "/")[0]
+		principal = fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], role)
+
+	case parts[2] == "iam":
+		principal = callerArn
+
+	default:
+		err = errors.New(fmt.Sprintf("can't simulate policies for %s", callerArn))
+		return principal, err
+	}
+
+	return principal, err
+}
+
+// Preflight checks, before anything is created, that the stack can be created: the name is valid and unused, the account has quota for it, its DNS names are free, the key pair exists, and the caller has the permissions it needs.  Every check runs, so all problems are reported at once.
+func (s *Stack) Preflight() (results []CheckResult) {
+	checks := []Check{
+		{
+			Name: "stack name",
+			Run: func() (detail string, err error) {
+				err = ValidateStackName(s.Config.StackName)
+				detail = s.Config.StackName
+				return detail, err
+			},
+		},
+		{
+			Name: "name available",
+			Run: func() (detail string, err error) {
+				if s.Exists() {
+					err = errors.New(fmt.Sprintf("stack %s already exists", s.Config.StackName))
+					return detail, err
+				}
+
+				detail = "no stack by that name"
+				return detail, err
+			},
+		},
+		{
+			Name: "vcpu quota",
+			Run:  s.CheckVCPUQuota,
+		},
+		{
+			Name: "eip quota",
+			Run:  s.CheckEIPQuota,
+		},
+		{
+			Name: "dns records",
+			Run:  s.CheckDNSRecords,
+		},
+		{
+			Name: "key pair",
+			Run: func() (detail string, err error) {
+				err = s.CheckKeyPair()
+				detail = s.Config.KeyName
+				return detail, err
+			},
+		},
+		{
+			Name: "permissions",
+			Run:  s.CheckPermissions,
+		},
+	}
+
+	results = RunChecks(checks)
+
+	return results
+}
+
+// ServiceQuota returns the value of an EC2 service quota, falling back to the AWS default if the account has no applied value.
+func (s *Stack) ServiceQuota(code string) (limit float64, err error) {
+	client := servicequotas.New(s.AwsSession)
+
+	output, err := client.GetServiceQuota(&servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String("ec2"),
+		QuotaCode:   aws.String(code),
+	})
+	if err == nil {
+		limit = aws.Float64Value(output.Quota.Value)
+		return limit, err
+	}
+
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != servicequotas.ErrCodeNoSuchResourceException {
+		err = errors.Wrapf(err, "failed getting quota %s", code)
+		return limit, err
+	}
+
+	defaultOutput, err := client.GetAWSDefaultServiceQuota(&servicequotas.GetAWSDefaultServiceQuotaInput{
+		ServiceCode: aws.String("ec2"),
+		QuotaCode:   aws.String(code),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting default quota %s", code)
+		return limit, err
+	}
+
+	limit = aws.Float64Value(defaultOutput.Quota.Value)
+
+	return limit, err
+}
+
+// CheckVCPUQuota checks the account can run another instance of the configured type without exceeding its vCPU quota.  Failing to look anything up is only a warning: create doesn't need the permissions to.
+func (s *Stack) CheckVCPUQuota() (detail string, err error) {
+	client := ec2.New(s.AwsSession)
+
+	types, err := client.DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []*string{aws.String(s.Config.InstanceType)},
+	})
+	if err != nil {
+		err = &CheckWarning{Detail: fmt.Sprintf("can't check vCPU quota: failed describing instance type %s: %s", s.Config.InstanceType, err)}
+		return detail, err
+	}
+
+	if len(types.InstanceTypes) == 0 {
+		err = errors.New(fmt.Sprintf("unknown instance type %s", s.Config.InstanceType))
+		return detail, err
+	}
+
+	need := int(aws.Int64Value(types.InstanceTypes[0].VCpuInfo.DefaultVCpus))
+	code := VCPUQuotaCode(s.Config.InstanceType)
+
+	used := 0
+
+	err = client.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{"pending", "running"}),
+			},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			for _, i := range r.Instances {
+				if VCPUQuotaCode(aws.StringValue(i.InstanceType)) != code || i.CpuOptions == nil {
+					continue
+				}
+
+				used += int(aws.Int64Value(i.CpuOptions.CoreCount) * aws.Int64Value(i.CpuOptions.ThreadsPerCore))
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		err = &CheckWarning{Detail: fmt.Sprintf("can't check vCPU quota: failed describing instances: %s", err)}
+		return detail, err
+	}
+
+	limit, err := s.ServiceQuota(code)
+	if err != nil {
+		err = &CheckWarning{Detail: fmt.Sprintf("can't check vCPU quota: %s", err)}
+		return detail, err
+	}
+
+	detail, err = CheckHeadroom(limit, used, need)
+
+	return detail, err
+}
+
+// CheckEIPQuota checks the account can allocate the Elastic IPs the stack needs.
+func (s *Stack) CheckEIPQuota() (detail string, err error) {
+	client := ec2.New(s.AwsSession)
+
+	output, err := client.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("domain"),
+				Values: []*string{aws.String("vpc")},
+			},
+		},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing addresses")
+		return detail, err
+	}
+
+	limit, err := s.ServiceQuota(QUOTA_CODE_EIPS)
+	if err != nil {
+		err = &CheckWarning{Detail: fmt.Sprintf("can't check Elastic IP quota: %s", err)}
+		return detail, err
+	}
+
+	detail, err = CheckHeadroom(limit, len(output.Addresses), STACK_EIPS)
+
+	return detail, err
+}
+
+// CheckDNSRecords checks that nothing already exists at, or under, <stack>.<domain> in the stack's hosted zone.
+func (s *Stack) CheckDNSRecords() (detail string, err error) {
+	name := fmt.Sprintf("%s.%s", s.Config.StackName, s.Config.DNSDomain)
+	detail = name
+
+	zoneID, err := s.LookupZoneID()
+	if err != nil {
+		err = errors.Wrapf(err, "failed finding zone for %s", s.Config.DNSDomain)
+		return detail, err
+	}
+
+	client := route53.New(s.AwsSession)
+
+	conflicts := make([]string, 0)
+
+	// record sets are returned in order of their reversed labels, so everything at or under name comes in one run, starting at name.
+	err = client.ListResourceRecordSetsPages(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(fmt.Sprintf("%s.", name)),
+	}, func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+		found := ConflictingRecords(page.ResourceRecordSets, name)
+		conflicts = append(conflicts, found...)
+
+		return len(found) == len(page.ResourceRecordSets)
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed listing records in zone %s", zoneID)
+		return detail, err
+	}
+
+	if len(conflicts) > 0 {
+		err = errors.New(fmt.Sprintf("records already exist: %s", strings.Join(conflicts, ", ")))
+		return detail, err
+	}
+
+	return detail, err
+}
+
+// PermissionDenials sorts the actions a policy simulation didn't allow into those a policy explicitly denies, and those merely not allowed.
+func PermissionDenials(results []*iam.EvaluationResult) (explicit []string, implicit []string) {
+	explicit = make([]string, 0)
+	implicit = make([]string, 0)
+
+	for _, r := range results {
+		switch aws.StringValue(r.EvalDecision) {
+		case iam.PolicyEvaluationDecisionTypeAllowed:
+			continue
+		case iam.PolicyEvaluationDecisionTypeExplicitDeny:
+			explicit = append(explicit, aws.StringValue(r.EvalActionName))
+		default:
+			implicit = append(implicit, aws.StringValue(r.EvalActionName))
+		}
+	}
+
+	sort.Strings(explicit)
+	sort.Strings(implicit)
+
+	return explicit, implicit
+}
+
+// CheckPermissions simulates the caller's IAM policies against the actions creating a stack needs.  Only explicit denies fail.  The simulation is against every resource, so an action a least privilege policy allows only on specific resources, e.g. iam:PassRole on one role, comes back not allowed: that's a warning.  If the simulation itself isn't possible, it warns too.
+func (s *Stack) CheckPermissions() (detail string, err error) {
+	identity, err := sts.New(s.AwsSession).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting caller identity")
+		return detail, err
+	}
+
+	detail = aws.StringValue(identity.Arn)
+
+	principal, err := PrincipalArn(aws.StringValue(identity.Arn))
+	if err != nil {
+		err = &CheckWarning{Detail: fmt.Sprintf("can't check permissions: %s", err)}
+		return detail, err
+	}
+
+	results := make([]*iam.EvaluationResult, 0)
+
+	err = iam.New(s.AwsSession).SimulatePrincipalPolicyPages(&iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principal),
+		ActionNames:     aws.StringSlice(requiredActions),
+	}, func(page *iam.SimulatePolicyResponse, lastPage bool) bool {
+		results = append(results, page.EvaluationResults...)
+
+		return true
+	})
+	if err != nil {
+		err = &CheckWarning{Detail: fmt.Sprintf("can't check permissions of %s: %s", principal, err)}
+		return detail, err
+	}
+
+	explicit, implicit := PermissionDenials(results)
+
+	if len(explicit) > 0 {
+		err = errors.New(fmt.Sprintf("%s is denied %s", principal, strings.Join(explicit, ", ")))
+		return detail, err
+	}
+
+	if len(implicit) > 0 {
+		err = &CheckWarning{Detail: fmt.Sprintf("%s is not allowed %s on every resource.  Fine if its policies allow them on the stack's own resources", principal, strings.Join(implicit, ", "))}
+		return detail, err
+	}
+
+	detail = fmt.Sprintf("%s allowed %d actions", principal, len(requiredActions))
+
+	return detail, err
+}
@@ -0,0 +1,130 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestValidateStackName(t *testing.T) {
+	cases := []struct {
+		name  string
+		stack string
+		err   string
+	}{
+		{"valid", "demo-1", ""},
+		{"empty", "", "stack name is empty"},
+		{"leading digit", "1demo", "must start with a letter"},
+		{"underscore", "demo_1", "contain only letters, digits and hyphens"},
+		{"dot", "demo.1", "contain only letters, digits and hyphens"},
+		{"trailing hyphen", "demo-", "can't end with a hyphen"},
+		{"too long for dns", strings.Repeat("a", 64), "DNS labels can be at most 63"},
+		{"longest dns label", strings.Repeat("a", 63), ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateStackName(tc.stack)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err, "expected an error") {
+				assert.Contains(t, err.Error(), tc.err, "error doesn't meet expectations")
+			}
+		})
+	}
+}
+
+func TestVCPUQuotaCode(t *testing.T) {
+	cases := []struct {
+		instanceType string
+		code         string
+	}{
+		{"m5.2xlarge", QUOTA_CODE_STANDARD_VCPUS},
+		{"t3.micro", QUOTA_CODE_STANDARD_VCPUS},
+		{"c6g.large", QUOTA_CODE_STANDARD_VCPUS},
+		{"g4dn.xlarge", QUOTA_CODE_G_VCPUS},
+		{"vt1.3xlarge", QUOTA_CODE_G_VCPUS},
+		{"p3.2xlarge", QUOTA_CODE_P_VCPUS},
+		{"x1e.xlarge", QUOTA_CODE_X_VCPUS},
+		{"f1.2xlarge", QUOTA_CODE_F_VCPUS},
+		{"inf1.xlarge", QUOTA_CODE_INF_VCPUS},
+		{"i3.large", QUOTA_CODE_STANDARD_VCPUS},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.instanceType, func(t *testing.T) {
+			assert.Equal(t, tc.code, VCPUQuotaCode(tc.instanceType), "quota code doesn't meet expectations")
+		})
+	}
+}
+
+func TestCheckHeadroom(t *testing.T) {
+	detail, err := CheckHeadroom(32, 24, 8)
+	assert.NoError(t, err, "exactly at the limit is fine")
+	assert.Equal(t, "24 used, 8 needed, limit 32", detail, "detail doesn't meet expectations")
+
+	_, err = CheckHeadroom(32, 28, 8)
+	if assert.Error(t, err, "over the limit") {
+		assert.Equal(t, "not enough quota: 28 used, 8 needed, limit 32", err.Error(), "error doesn't meet expectations")
+	}
+}
+
+func TestConflictingRecords(t *testing.T) {
+	records := []*route53.ResourceRecordSet{
+		{Name: aws.String("demo.example.com."), Type: aws.String("A")},
+		{Name: aws.String("api.demo.example.com."), Type: aws.String("CNAME")},
+		{Name: aws.String("demo2.example.com."), Type: aws.String("A")},
+		{Name: aws.String("xdemo.example.com."), Type: aws.String("A")},
+	}
+
+	assert.Equal(t, []string{"demo.example.com (A)", "api.demo.example.com (CNAME)"}, ConflictingRecords(records, "demo.example.com"), "conflicts don't meet expectations")
+	assert.Equal(t, []string{}, ConflictingRecords(records, "other.example.com"), "nothing should conflict")
+}
+
+func TestPrincipalArn(t *testing.T) {
+	cases := []struct {
+		name      string
+		caller    string
+		principal string
+		err       bool
+	}{
+		{"user", "arn:aws:iam::123456789012:user/nik", "arn:aws:iam::123456789012:user/nik", false},
+		{"assumed role", "arn:aws:sts::123456789012:assumed-role/Admin/session", "arn:aws:iam::123456789012:role/Admin", false},
+		{"govcloud", "arn:aws-us-gov:sts::123456789012:assumed-role/Admin/session", "arn:aws-us-gov:iam::123456789012:role/Admin", false},
+		{"root", "arn:aws:iam::123456789012:root", "", true},
+		{"federated", "arn:aws:sts::123456789012:federated-user/nik", "", true},
+		{"malformed", "nik", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			principal, err := PrincipalArn(tc.caller)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.principal, principal, "principal doesn't meet expectations")
+		})
+	}
+}
+
+func TestPermissionDenials(t *testing.T) {
+	results := []*iam.EvaluationResult{
+		{EvalActionName: aws.String("s3:GetObject"), EvalDecision: aws.String(iam.PolicyEvaluationDecisionTypeImplicitDeny)},
+		{EvalActionName: aws.String("ec2:RunInstances"), EvalDecision: aws.String(iam.PolicyEvaluationDecisionTypeAllowed)},
+		{EvalActionName: aws.String("iam:PassRole"), EvalDecision: aws.String(iam.PolicyEvaluationDecisionTypeImplicitDeny)},
+		{EvalActionName: aws.String("iam:CreateRole"), EvalDecision: aws.String(iam.PolicyEvaluationDecisionTypeExplicitDeny)},
+	}
+
+	explicit, implicit := PermissionDenials(results)
+	assert.Equal(t, []string{"iam:CreateRole"}, explicit, "explicit denials don't meet expectations")
+	assert.Equal(t, []string{"iam:PassRole", "s3:GetObject"}, implicit, "implicit denials don't meet expectations")
+}
@@ -0,0 +1,233 @@
+package ops
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// PRICING_FILE Optional pricing table in the user's home directory.  Its entries override the bundled table, so prices can be updated without a new release.
+const PRICING_FILE = ".orion-ptt-system-pricing.json"
+
+// HOURS_PER_MONTH Hours in an average month, as AWS counts them.
+const HOURS_PER_MONTH = 730
+
+//go:embed pricing.json
+var bundledPricing []byte
+
+// PricingTable  On demand prices, per region.  Estimates only: no discounts, data transfer, or anything but the instance and its volume.
+type PricingTable struct {
+	Updated  string                   `json:"updated"`
+	Currency string                   `json:"currency"`
+	Regions  map[string]RegionPricing `json:"regions"`
+}
+
+// RegionPricing  Prices in a single region.
+type RegionPricing struct {
+	InstanceHourly map[string]float64 `json:"instance_hourly"`
+	VolumeGBMonth  float64            `json:"volume_gb_month"`
+}
+
+// CostEstimate  The estimated cost of running a stack.
+type CostEstimate struct {
+	Region       string
+	InstanceType string
+	VolumeSize   int
+	Hourly       float64
+	Monthly      float64
+	Currency     string
+}
+
+// LoadPricing loads the bundled pricing table, with any entries in PRICING_FILE layered over it.
+func LoadPricing() (table *PricingTable, err error) {
+	table, err = ParsePricing(bundledPricing)
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing bundled pricing")
+		return table, err
+	}
+
+	path, err := homedir.Expand(fmt.Sprintf("~/%s", PRICING_FILE))
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read home directory")
+		return table, err
+	}
+
+	if _, e := os.Stat(path); os.IsNotExist(e) {
+		return table, err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed reading %s", path)
+		return table, err
+	}
+
+	override, err := ParsePricing(content)
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing %s", path)
+		return table, err
+	}
+
+	table.Merge(override)
+
+	return table, err
+}
+
+// ParsePricing parses a pricing table.
+func ParsePricing(content []byte) (table *PricingTable, err error) {
+	table = &PricingTable{}
+
+	err = json.Unmarshal(content, table)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to unmarshal pricing json")
+		return table, err
+	}
+
+	if table.Regions == nil {
+		table.Regions = make(map[string]RegionPricing)
+	}
+
+	return table, err
+}
+
+// Merge layers the entries of other over the table.
+func (p *PricingTable) Merge(other *PricingTable) {
+	if other.Updated != "" {
+		p.Updated = other.Updated
+	}
+
+	for region, prices := range other.Regions {
+		existing, ok := p.Regions[region]
+		if !ok {
+			existing = RegionPricing{InstanceHourly: make(map[string]float64)}
+		}
+
+		for instanceType, price := range prices.InstanceHourly {
+			existing.InstanceHourly[instanceType] = price
+		}
+
+		if prices.VolumeGBMonth != 0 {
+			existing.VolumeGBMonth = prices.VolumeGBMonth
+		}
+
+		p.Regions[region] = existing
+	}
+}
+
+// Estimate estimates the hourly and monthly cost of an instance and its volume.
+func (p *PricingTable) Estimate(region string, instanceType string, volumeSize int) (estimate CostEstimate, err error) {
+	estimate = CostEstimate{
+		Region:       region,
+		InstanceType: instanceType,
+		VolumeSize:   volumeSize,
+		Currency:     p.Currency,
+	}
+
+	prices, ok := p.Regions[region]
+	if !ok {
+		err = errors.New(fmt.Sprintf("no prices for region %s.  Add them to ~/%s", region, PRICING_FILE))
+		return estimate, err
+	}
+
+	hourly, ok := prices.InstanceHourly[instanceType]
+	if !ok {
+		err = errors.New(fmt.Sprintf("no price for %s in %s.  Add it to ~/%s", instanceType, region, PRICING_FILE))
+		return estimate, err
+	}
+
+	estimate.Hourly = hourly + prices.VolumeGBMonth*float64(volumeSize)/HOURS_PER_MONTH
+	estimate.Monthly = estimate.Hourly * HOURS_PER_MONTH
+
+	return estimate, err
+}
+
+// String describes the estimate.
+func (e CostEstimate) String() string {
+	return fmt.Sprintf("%s with %dGB in %s: ~%.2f %s/hour, ~%.2f %s/month", e.InstanceType, e.VolumeSize, e.Region, e.Hourly, e.Currency, e.Monthly, e.Currency)
+}
+
+// VolumeSize returns the size of the stack's root volume in GB: the VolumeSize parameter override if set, and DEFAULT_VOLUME_SIZE otherwise.
+func (c *StackConfig) VolumeSize() (size int, err error) {
+	raw, ok := c.ParameterOverrides["VolumeSize"]
+	if !ok {
+		size = DEFAULT_VOLUME_SIZE
+		return size, err
+	}
+
+	size, err = strconv.Atoi(raw)
+	if err != nil {
+		err = errors.Wrapf(err, "VolumeSize override %q is not a number", raw)
+		return size, err
+	}
+
+	return size, err
+}
+
+// EstimateCost estimates what the stack will cost to run.
+func (s *Stack) EstimateCost() (estimate CostEstimate, err error) {
+	table, err := LoadPricing()
+	if err != nil {
+		return estimate, err
+	}
+
+	size, err := s.Config.VolumeSize()
+	if err != nil {
+		return estimate, err
+	}
+
+	estimate, err = table.Estimate(aws.StringValue(s.AwsSession.Config.Region), s.Config.InstanceType, size)
+
+	return estimate, err
+}
+
+// RunningCost  What an existing stack has cost so far.
+type RunningCost struct {
+	StackName string
+	Created   time.Time
+	Hours     float64
+	Estimate  CostEstimate
+	SoFar     float64
+	Err       error // set if the stack's cost couldn't be estimated
+}
+
+// StackRunningCost estimates what a running stack has cost since it was created, from the instance type and volume size it was created with.
+func (p *PricingTable) StackRunningCost(stack *cloudformation.Stack, region string, now time.Time) (cost RunningCost) {
+	cost = RunningCost{
+		StackName: aws.StringValue(stack.StackName),
+		Created:   aws.TimeValue(stack.CreationTime),
+	}
+
+	cost.Hours = now.Sub(cost.Created).Hours()
+
+	instanceType := ""
+	size := DEFAULT_VOLUME_SIZE
+
+	for _, param := range stack.Parameters {
+		switch aws.StringValue(param.ParameterKey) {
+		case "InstanceType":
+			instanceType = aws.StringValue(param.ParameterValue)
+		case "VolumeSize":
+			n, err := strconv.Atoi(aws.StringValue(param.ParameterValue))
+			if err == nil {
+				size = n
+			}
+		}
+	}
+
+	cost.Estimate, cost.Err = p.Estimate(region, instanceType, size)
+	if cost.Err != nil {
+		return cost
+	}
+
+	cost.SoFar = cost.Hours * cost.Estimate.Hourly
+
+	return cost
+}
@@ -0,0 +1,97 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBundledPricing(t *testing.T) {
+	table, err := ParsePricing(bundledPricing)
+	if err != nil {
+		t.Errorf("failed parsing bundled pricing: %s", err)
+	}
+
+	estimate, err := table.Estimate("us-east-1", DEFAULT_INSTANCE_TYPE, DEFAULT_VOLUME_SIZE)
+	assert.NoError(t, err, "default instance type should be priced")
+	assert.Greater(t, estimate.Hourly, 0.0, "hourly estimate should be positive")
+	assert.InDelta(t, estimate.Hourly*HOURS_PER_MONTH, estimate.Monthly, 0.001, "monthly estimate doesn't meet expectations")
+}
+
+func TestPricingEstimate(t *testing.T) {
+	table, err := ParsePricing([]byte(`{
+  "currency": "USD",
+  "regions": {
+    "us-east-1": {
+      "instance_hourly": {"m5.2xlarge": 0.4},
+      "volume_gb_month": 0.1
+    }
+  }
+}`))
+	if err != nil {
+		t.Errorf("failed parsing pricing: %s", err)
+	}
+
+	override, err := ParsePricing([]byte(`{"regions": {"us-east-1": {"instance_hourly": {"m5.4xlarge": 0.8}}, "eu-west-1": {"instance_hourly": {"m5.2xlarge": 0.5}, "volume_gb_month": 0.2}}}`))
+	if err != nil {
+		t.Errorf("failed parsing override: %s", err)
+	}
+
+	table.Merge(override)
+
+	cases := []struct {
+		name         string
+		region       string
+		instanceType string
+		hourly       float64
+		err          bool
+	}{
+		{"bundled", "us-east-1", "m5.2xlarge", 0.4 + 0.1*73/HOURS_PER_MONTH, false},
+		{"added type", "us-east-1", "m5.4xlarge", 0.8 + 0.1*73/HOURS_PER_MONTH, false},
+		{"added region", "eu-west-1", "m5.2xlarge", 0.5 + 0.2*73/HOURS_PER_MONTH, false},
+		{"unknown type", "us-east-1", "x1.32xlarge", 0, true},
+		{"unknown region", "mars-1", "m5.2xlarge", 0, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			estimate, err := table.Estimate(tc.region, tc.instanceType, 73)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.hourly, estimate.Hourly, 0.0001, "hourly estimate doesn't meet expectations")
+		})
+	}
+
+	created := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	stack := &cloudformation.Stack{
+		StackName:    aws.String("opstest"),
+		CreationTime: aws.Time(created),
+		Parameters: []*cloudformation.Parameter{
+			{ParameterKey: aws.String("InstanceType"), ParameterValue: aws.String("m5.2xlarge")},
+			{ParameterKey: aws.String("VolumeSize"), ParameterValue: aws.String("73")},
+		},
+	}
+
+	cost := table.StackRunningCost(stack, "us-east-1", created.Add(10*time.Hour))
+	assert.NoError(t, cost.Err)
+	assert.InDelta(t, 10*(0.4+0.1*73/HOURS_PER_MONTH), cost.SoFar, 0.0001, "running cost doesn't meet expectations")
+}
+
+func TestConfigVolumeSize(t *testing.T) {
+	size, err := (&StackConfig{}).VolumeSize()
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_VOLUME_SIZE, size, "default volume size not used")
+
+	size, err = (&StackConfig{ParameterOverrides: map[string]string{"VolumeSize": "200"}}).VolumeSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 200, size, "volume size override not used")
+
+	_, err = (&StackConfig{ParameterOverrides: map[string]string{"VolumeSize": "big"}}).VolumeSize()
+	assert.Error(t, err, "expected a bad volume size to fail")
+}
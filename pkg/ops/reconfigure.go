@@ -0,0 +1,207 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// KOTS_APP_SLUG The kots application slug of the Orion PTT System.
+const KOTS_APP_SLUG = "orion-ptt-system"
+
+// KEYSTORE_CONFIG_KEY Kots config item holding the JWK keystore.
+const KEYSTORE_CONFIG_KEY = "session_keystore"
+
+// ConfigChange A single difference between two rendered kots configs.
+type ConfigChange struct {
+	Key string
+	Old string
+	New string
+}
+
+// Reconfigure re-renders the kots config for a running stack, diffs it against the config staged on the instance, and if apply is true, stages the new config and redeploys it with 'kubectl kots set config'.  The keystore from the staged config is reused so that existing tokens remain valid.
+func (s *Stack) Reconfigure(apply bool) (changes []ConfigChange, err error) {
+	address, err := s.Output(OUTPUT_ADDRESS)
+	if err != nil {
+		err = errors.Wrapf(err, "failed looking up address of stack %s", s.Config.StackName)
+		return changes, err
+	}
+
+	sshClient, err := SshClient(address, 22, s.Config.Username)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create client")
+		return changes, err
+	}
+
+	current, err := s.FetchConfig(sshClient)
+	if err != nil {
+		err = errors.Wrapf(err, "failed fetching current config")
+		return changes, err
+	}
+
+	keystore, err := ConfigKeystore(current)
+	if err != nil {
+		err = errors.Wrapf(err, "failed reading keystore from current config")
+		return changes, err
+	}
+
+	RegisterSecret(keystore)
+
+	rendered, err := s.RenderConfig(keystore)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating config from template")
+		return changes, err
+	}
+
+	changes, err = DiffConfigValues(current, rendered)
+	if err != nil {
+		err = errors.Wrapf(err, "failed comparing configs")
+		return changes, err
+	}
+
+	PrintConfigChanges(changes)
+
+	if !apply || len(changes) == 0 {
+		return changes, err
+	}
+
+	backup := fmt.Sprintf("cp /home/%s/config.yaml /home/%s/config.yaml.bak", s.Config.Username, s.Config.Username)
+	err = sshClient.RpcCall([]byte(backup), os.Stdout, os.Stderr)
+	if err != nil {
+		err = errors.Wrapf(err, "failed backing up current config")
+		return changes, err
+	}
+
+	err = sshClient.SCPFile(rendered, "config.yaml")
+	if err != nil {
+		err = errors.Wrapf(err, "Error staging config file")
+		return changes, err
+	}
+
+	fmt.Printf("Config staged to /home/%s/config.yaml.  Previous config saved to /home/%s/config.yaml.bak\n", s.Config.Username, s.Config.Username)
+
+	cmd := fmt.Sprintf("sudo -i kubectl kots set config %s --namespace default --config-file /home/%s/config.yaml --merge --deploy", KOTS_APP_SLUG, s.Config.Username)
+
+	fmt.Printf("Applying config with the following command:\n\n  %s\n\n", cmd)
+
+	err = sshClient.RpcCall([]byte(cmd), os.Stdout, os.Stderr)
+	if err != nil {
+		err = errors.Wrapf(err, "error running kots set config")
+		return changes, err
+	}
+
+	return changes, err
+}
+
+// FetchConfig reads the kots config currently staged on the instance.
+func (s *Stack) FetchConfig(sshClient *SshProgClient) (content string, err error) {
+	var stdout bytes.Buffer
+
+	cmd := fmt.Sprintf("cat /home/%s/config.yaml", s.Config.Username)
+
+	err = sshClient.RpcCall([]byte(cmd), &stdout, os.Stderr)
+	if err != nil {
+		err = errors.Wrapf(err, "failed reading /home/%s/config.yaml", s.Config.Username)
+		return content, err
+	}
+
+	content = stdout.String()
+
+	return content, err
+}
+
+// ConfigKeystore extracts the JWK keystore from a rendered kots config.
+func ConfigKeystore(content string) (keystore string, err error) {
+	values, err := configValues(content)
+	if err != nil {
+		return keystore, err
+	}
+
+	keystore = values[fmt.Sprintf("%s.value", KEYSTORE_CONFIG_KEY)]
+	if keystore == "" {
+		err = errors.New(fmt.Sprintf("no %s found in config.  Refusing to generate a new one, as it would invalidate existing tokens", KEYSTORE_CONFIG_KEY))
+		return keystore, err
+	}
+
+	return keystore, err
+}
+
+// DiffConfigValues compares the spec.values of two kots configs, returning the changes sorted by key.
+func DiffConfigValues(oldContent string, newContent string) (changes []ConfigChange, err error) {
+	changes = make([]ConfigChange, 0)
+
+	oldValues, err := configValues(oldContent)
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing old config")
+		return changes, err
+	}
+
+	newValues, err := configValues(newContent)
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing new config")
+		return changes, err
+	}
+
+	for k, v := range newValues {
+		if old, ok := oldValues[k]; !ok || old != v {
+			changes = append(changes, ConfigChange{Key: k, Old: old, New: v})
+		}
+	}
+
+	for k, v := range oldValues {
+		if _, ok := newValues[k]; !ok {
+			changes = append(changes, ConfigChange{Key: k, Old: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes, err
+}
+
+// PrintConfigChanges prints the output of DiffConfigValues.
+func PrintConfigChanges(changes []ConfigChange) {
+	if len(changes) == 0 {
+		fmt.Printf("No config changes.\n")
+		return
+	}
+
+	fmt.Printf("Config Changes:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	for _, c := range changes {
+		_, _ = fmt.Fprintf(w, "  %s: \t %q \t -> %q\n", c.Key, c.Old, c.New)
+	}
+
+	_ = w.Flush()
+}
+
+// configValues flattens spec.values of a kots config into '<item>.<field>' keys.
+func configValues(content string) (values map[string]string, err error) {
+	values = make(map[string]string)
+
+	var config struct {
+		Spec struct {
+			Values map[string]map[string]interface{} `yaml:"values"`
+		} `yaml:"spec"`
+	}
+
+	err = yaml.Unmarshal([]byte(content), &config)
+	if err != nil {
+		err = errors.Wrapf(err, "failed unmarshalling config yaml")
+		return values, err
+	}
+
+	for item, fields := range config.Spec.Values {
+		for field, value := range fields {
+			values[fmt.Sprintf("%s.%s", item, field)] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	return values, err
+}
@@ -0,0 +1,82 @@
+package ops
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testOldConfig = `apiVersion: kots.io/v1beta1
+kind: ConfigValues
+spec:
+  values:
+    atlas_hostname:
+      default: login.allorion.com
+      value: login-foo.allorion.com
+    session_keystore:
+      value: '{"keys":[]}'
+    removed_item:
+      value: gone
+`
+
+const testNewConfig = `apiVersion: kots.io/v1beta1
+kind: ConfigValues
+spec:
+  values:
+    atlas_hostname:
+      default: login.allorion.com
+      value: login-bar.allorion.com
+    session_keystore:
+      value: '{"keys":[]}'
+    added_item:
+      value: new
+`
+
+func TestConfigKeystore(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		keystore string
+		err      bool
+	}{
+		{
+			"present",
+			testOldConfig,
+			`{"keys":[]}`,
+			false,
+		},
+		{
+			"missing",
+			"spec:\n  values:\n    foo:\n      value: bar\n",
+			"",
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			keystore, err := ConfigKeystore(tc.content)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.keystore, keystore, "keystore doesn't meet expectations")
+		})
+	}
+}
+
+func TestDiffConfigValues(t *testing.T) {
+	changes, err := DiffConfigValues(testOldConfig, testNewConfig)
+	if err != nil {
+		t.Errorf("failed diffing configs: %s", err)
+	}
+
+	expected := []ConfigChange{
+		{Key: "added_item.value", Old: "", New: "new"},
+		{Key: "atlas_hostname.value", Old: "login-foo.allorion.com", New: "login-bar.allorion.com"},
+		{Key: "removed_item.value", Old: "gone", New: ""},
+	}
+
+	assert.Equal(t, expected, changes, "config changes don't meet expectations")
+}
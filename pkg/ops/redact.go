@@ -0,0 +1,117 @@
+package ops
+
+import (
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// REDACTED_MASK Replacement for secret values in output.
+const REDACTED_MASK = "********"
+
+// MIN_SECRET_LENGTH Values registered opportunistically, e.g. whatever a secret reference resolves to, are ignored if they're shorter than this, as masking them would mangle ordinary output.  Configured secrets are always registered.
+const MIN_SECRET_LENGTH = 4
+
+var secrets = make(map[string]bool)
+var secretsLock sync.RWMutex
+
+// RegisterSecret adds a value that is to be masked by Redact() wherever it appears, unless it's shorter than MIN_SECRET_LENGTH.
+func RegisterSecret(secret string) {
+	if len(strings.TrimSpace(secret)) < MIN_SECRET_LENGTH {
+		return
+	}
+
+	RegisterConfiguredSecret(secret)
+}
+
+// RegisterConfiguredSecret adds a value that is to be masked by Redact() wherever it appears, however short.  Use it for values configured as secrets, e.g. fields tagged secret:"true", which must never be shown.
+func RegisterConfiguredSecret(secret string) {
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return
+	}
+
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	secrets[secret] = true
+}
+
+// Redact masks any registered secret found in the given text.
+func Redact(text string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+
+	// replace the longest secrets first, so a secret containing another secret is masked entirely
+	known := make([]string, 0, len(secrets))
+	for s := range secrets {
+		known = append(known, s)
+	}
+
+	sort.Slice(known, func(i, j int) bool {
+		return len(known[i]) > len(known[j])
+	})
+
+	for _, s := range known {
+		text = strings.ReplaceAll(text, s, REDACTED_MASK)
+	}
+
+	return text
+}
+
+// RedactingWriter an io.Writer that masks registered secrets before passing output along.
+type RedactingWriter struct {
+	Writer io.Writer
+}
+
+// NewRedactingWriter wraps the given writer in a RedactingWriter.
+func NewRedactingWriter(w io.Writer) (writer *RedactingWriter) {
+	writer = &RedactingWriter{
+		Writer: w,
+	}
+
+	return writer
+}
+
+// Write redacts p and writes it to the underlying writer.  Reports len(p) as written, since callers know nothing of the masking.
+func (w *RedactingWriter) Write(p []byte) (n int, err error) {
+	_, err = w.Writer.Write([]byte(Redact(string(p))))
+	if err != nil {
+		return n, err
+	}
+
+	n = len(p)
+
+	return n, err
+}
+
+// RegisterSecrets registers every field of the config tagged as secret for redaction, whatever its length.
+func (c *StackConfig) RegisterSecrets() {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") == "true" && v.Field(i).Kind() == reflect.String {
+			RegisterConfiguredSecret(v.Field(i).String())
+		}
+	}
+}
+
+// Redacted returns a copy of the config with every field tagged as secret masked.  Use it for anything that dumps the config.
+func (c *StackConfig) Redacted() (redacted *StackConfig) {
+	cp := *c
+	v := reflect.ValueOf(&cp).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") == "true" && v.Field(i).Kind() == reflect.String && v.Field(i).String() != "" {
+			v.Field(i).SetString(REDACTED_MASK)
+		}
+	}
+
+	redacted = &cp
+
+	return redacted
+}
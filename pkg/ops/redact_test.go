@@ -0,0 +1,104 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// clearSecrets forgets every registered secret when the test is done, so one test's secrets don't mask another's output.
+func clearSecrets(t *testing.T) {
+	t.Cleanup(func() {
+		secretsLock.Lock()
+		defer secretsLock.Unlock()
+
+		secrets = make(map[string]bool)
+	})
+}
+
+func TestRedact(t *testing.T) {
+	clearSecrets(t)
+
+	RegisterSecret("hunter22")
+	RegisterSecret("hunter22-and-more")
+	RegisterSecret("abc")
+	RegisterConfiguredSecret("xyz")
+
+	cases := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			"password",
+			`--shared-password "hunter22"`,
+			fmt.Sprintf(`--shared-password "%s"`, REDACTED_MASK),
+		},
+		{
+			"longest first",
+			"pw: hunter22-and-more",
+			fmt.Sprintf("pw: %s", REDACTED_MASK),
+		},
+		{
+			"short secrets ignored",
+			"abc",
+			"abc",
+		},
+		{
+			"short configured secrets masked",
+			"pw: xyz",
+			fmt.Sprintf("pw: %s", REDACTED_MASK),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, Redact(tc.input), "redacted output doesn't meet expectations")
+		})
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	clearSecrets(t)
+
+	RegisterSecret("s3cr3t-value")
+
+	var buf bytes.Buffer
+	w := NewRedactingWriter(&buf)
+
+	input := []byte("error: s3cr3t-value rejected\n")
+	n, err := w.Write(input)
+	if err != nil {
+		t.Errorf("failed writing: %s", err)
+	}
+
+	assert.Equal(t, len(input), n, "reported length doesn't meet expectations")
+	assert.Equal(t, fmt.Sprintf("error: %s rejected\n", REDACTED_MASK), buf.String(), "written output doesn't meet expectations")
+}
+
+func TestStackConfigRegisterSecrets(t *testing.T) {
+	clearSecrets(t)
+
+	config := StackConfig{
+		StackName:       "opstest",
+		KotsadmPassword: "pw",
+	}
+
+	config.RegisterSecrets()
+
+	assert.Equal(t, fmt.Sprintf("password is %s", REDACTED_MASK), Redact("password is pw"), "short password not redacted")
+}
+
+func TestStackConfigRedacted(t *testing.T) {
+	config := StackConfig{
+		StackName:       "opstest",
+		KotsadmPassword: "not-for-your-eyes",
+	}
+
+	redacted := config.Redacted()
+
+	assert.Equal(t, REDACTED_MASK, redacted.KotsadmPassword, "password not redacted")
+	assert.Equal(t, "opstest", redacted.StackName, "non secret field was modified")
+	assert.Equal(t, "not-for-your-eyes", config.KotsadmPassword, "original config was modified")
+}
@@ -0,0 +1,156 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RegionStacks  The stacks found in a single region, or the error looking for them.
+type RegionStacks struct {
+	Region string
+	Stacks []*cloudformation.Stack
+	Err    error
+}
+
+// InRegion returns a copy of the stack operating in another region.  The config is shared.
+func (s *Stack) InRegion(region string) (stack *Stack) {
+	stack = &Stack{
+		Config:       s.Config,
+		AwsSession:   s.AwsSession.Copy(&aws.Config{Region: aws.String(region)}),
+		AutoRollback: s.AutoRollback,
+	}
+
+	return stack
+}
+
+// UseRegion switches the stack to another region.
+func (s *Stack) UseRegion(region string) {
+	s.Config.Region = region
+	s.AwsSession = s.AwsSession.Copy(&aws.Config{Region: aws.String(region)})
+}
+
+// Regions lists every region enabled in the account, sorted.
+func (s *Stack) Regions() (regions []string, err error) {
+	regions = make([]string, 0)
+
+	output, err := ec2.New(s.AwsSession).DescribeRegions(&ec2.DescribeRegionsInput{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing regions")
+		return regions, err
+	}
+
+	for _, r := range output.Regions {
+		regions = append(regions, aws.StringValue(r.RegionName))
+	}
+
+	sort.Strings(regions)
+
+	return regions, err
+}
+
+// forEachRegion runs f for every region concurrently, and waits for them all.
+func forEachRegion(regions []string, f func(region string)) {
+	var wg sync.WaitGroup
+
+	for _, region := range regions {
+		wg.Add(1)
+
+		go func(region string) {
+			defer wg.Done()
+			f(region)
+		}(region)
+	}
+
+	wg.Wait()
+}
+
+// ListStacksAllRegions lists the stacks ops created in every enabled region, querying the regions concurrently.  A region that can't be queried is reported in its result, rather than failing the rest.  Results are sorted by region.
+func (s *Stack) ListStacksAllRegions() (results []RegionStacks, err error) {
+	regions, err := s.Regions()
+	if err != nil {
+		return results, err
+	}
+
+	results = make([]RegionStacks, len(regions))
+
+	forEachRegion(regions, func(region string) {
+		i := sort.SearchStrings(regions, region)
+
+		stacks, err := s.InRegion(region).ListStacks()
+		results[i] = RegionStacks{Region: region, Stacks: stacks, Err: err}
+	})
+
+	return results, err
+}
+
+// LocateStack returns every enabled region holding a stack named after the stack, querying the regions concurrently.  Sorted.
+func (s *Stack) LocateStack() (found []string, err error) {
+	found = make([]string, 0)
+
+	regions, err := s.Regions()
+	if err != nil {
+		return found, err
+	}
+
+	var mutex sync.Mutex
+
+	forEachRegion(regions, func(region string) {
+		if s.InRegion(region).Exists() {
+			mutex.Lock()
+			found = append(found, region)
+			mutex.Unlock()
+		}
+	})
+
+	sort.Strings(found)
+
+	return found, err
+}
+
+// ChooseRegion picks the region to use for a stack found in the given regions.  The current region wins if the stack is there, otherwise the first region it was found in.  If the stack is in more than one region, warning says so.
+func ChooseRegion(found []string, current string) (region string, warning string) {
+	if len(found) == 0 {
+		region = current
+		return region, warning
+	}
+
+	region = found[0]
+	if StringInSlice(current, found) {
+		region = current
+	}
+
+	if len(found) > 1 {
+		warning = fmt.Sprintf("stack exists in %d regions: %s.  Using %s.  Set --region to choose", len(found), strings.Join(found, ", "), region)
+	}
+
+	return region, warning
+}
+
+// Locate finds which region the stack lives in, and switches to it, returning the region if it changed.  Does nothing if the region is set explicitly.  Returns a warning if the stack exists in more than one region.
+func (s *Stack) Locate() (switched string, warning string, err error) {
+	if s.Config.Region != "" {
+		return switched, warning, err
+	}
+
+	found, err := s.LocateStack()
+	if err != nil {
+		err = errors.Wrapf(err, "failed locating stack %s", s.Config.StackName)
+		return switched, warning, err
+	}
+
+	current := aws.StringValue(s.AwsSession.Config.Region)
+
+	region, warning := ChooseRegion(found, current)
+	if region != current {
+		s.UseRegion(region)
+		switched = region
+	}
+
+	return switched, warning, err
+}
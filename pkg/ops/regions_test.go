@@ -0,0 +1,74 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestChooseRegion(t *testing.T) {
+	cases := []struct {
+		name    string
+		found   []string
+		current string
+		region  string
+		warning string
+	}{
+		{"not found", []string{}, "us-east-1", "us-east-1", ""},
+		{"current", []string{"us-east-1"}, "us-east-1", "us-east-1", ""},
+		{"elsewhere", []string{"eu-west-1"}, "us-east-1", "eu-west-1", ""},
+		{"several including current", []string{"eu-west-1", "us-east-1"}, "us-east-1", "us-east-1", "stack exists in 2 regions: eu-west-1, us-east-1.  Using us-east-1.  Set --region to choose"},
+		{"several elsewhere", []string{"eu-west-1", "us-west-2"}, "us-east-1", "eu-west-1", "stack exists in 2 regions: eu-west-1, us-west-2.  Using eu-west-1.  Set --region to choose"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			region, warning := ChooseRegion(tc.found, tc.current)
+			assert.Equal(t, tc.region, region, "region doesn't meet expectations")
+			assert.Equal(t, tc.warning, warning, "warning doesn't meet expectations")
+		})
+	}
+}
+
+func TestForEachRegion(t *testing.T) {
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1"}
+	seen := make([]string, 0)
+
+	var mutex sync.Mutex
+
+	forEachRegion(regions, func(region string) {
+		mutex.Lock()
+		seen = append(seen, region)
+		mutex.Unlock()
+	})
+
+	sort.Strings(seen)
+
+	assert.Equal(t, []string{"eu-west-1", "us-east-1", "us-west-2"}, seen, "every region should be visited once")
+}
+
+func TestStackRegion(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	if err != nil {
+		t.Fatalf("failed creating session: %s", err)
+	}
+
+	s, err := NewStack(&StackConfig{Region: "eu-west-1"}, sess, true)
+	if err != nil {
+		t.Fatalf("failed creating stack: %s", err)
+	}
+
+	assert.Equal(t, "eu-west-1", aws.StringValue(s.AwsSession.Config.Region), "configured region should override the session")
+	assert.Equal(t, "us-east-1", aws.StringValue(sess.Config.Region), "the original session should be left alone")
+
+	other := s.InRegion("ap-southeast-2")
+	assert.Equal(t, "ap-southeast-2", aws.StringValue(other.AwsSession.Config.Region), "copy should be in the other region")
+	assert.Equal(t, "eu-west-1", aws.StringValue(s.AwsSession.Config.Region), "original should stay put")
+
+	s.UseRegion("us-west-2")
+	assert.Equal(t, "us-west-2", aws.StringValue(s.AwsSession.Config.Region), "stack should switch region")
+	assert.Equal(t, "us-west-2", s.Config.Region, "config should record the region")
+}
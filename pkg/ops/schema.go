@@ -0,0 +1,262 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CONFIG_SCHEMA_FILE Path of the published config file JSON Schema, relative to the repository root.
+const CONFIG_SCHEMA_FILE = "config.schema.json"
+
+// configFileKeys  Top level keys allowed in the config file.
+var configFileKeys = []string{CONFIG_VERSION_KEY, "default_profile", "profiles", ACCOUNTS_KEY}
+
+// ProfileKeys returns every key allowed in a config file profile.
+func ProfileKeys() (keys []string) {
+	keys = []string{PROFILE_INHERITS_KEY}
+
+	for _, f := range ConfigFields() {
+		keys = append(keys, f.Name)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CheckKeys reports every unknown key in the config file, with a suggestion where one is close to a known key.
+func (f *ConfigFile) CheckKeys() (err error) {
+	problems := make([]string, 0)
+
+	known := ProfileKeys()
+
+	for _, name := range f.ProfileNames() {
+		keys := make([]string, 0)
+		for k := range f.Profiles[name] {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if !StringInSlice(k, known) {
+				problems = append(problems, unknownKey(k, fmt.Sprintf("profile %q", name), known))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// checkFileKeys reports unknown top level keys in raw config file content.
+func checkFileKeys(raw map[string]interface{}) (err error) {
+	problems := make([]string, 0)
+
+	keys := make([]string, 0)
+	for k := range raw {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !StringInSlice(k, configFileKeys) {
+			problems = append(problems, unknownKey(k, "config file", configFileKeys))
+		}
+	}
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// unknownKey describes an unknown key, suggesting the closest known one if it's a plausible typo.
+func unknownKey(key string, where string, known []string) (problem string) {
+	problem = fmt.Sprintf("unknown key %q in %s", key, where)
+
+	suggestion := Suggest(key, known)
+	if suggestion != "" {
+		problem = fmt.Sprintf("%s (did you mean %q?)", problem, suggestion)
+	}
+
+	return problem
+}
+
+// Suggest returns the candidate closest to word, or an empty string if none is close enough to be a likely typo.
+func Suggest(word string, candidates []string) (suggestion string) {
+	best := -1
+
+	for _, c := range candidates {
+		d := levenshtein(word, c)
+
+		// allow roughly one mistake per three characters, but at least two.
+		limit := len(c) / 3
+		if limit < 2 {
+			limit = 2
+		}
+
+		if d <= limit && (best < 0 || d < best) {
+			best = d
+			suggestion = c
+		}
+	}
+
+	return suggestion
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// ConfigSchema generates a JSON Schema for the config file from the StackConfig and Account struct tags.
+func ConfigSchema() (schema map[string]interface{}) {
+	properties := map[string]interface{}{
+		PROFILE_INHERITS_KEY: map[string]interface{}{
+			"type":        "string",
+			"description": "name of a profile this profile inherits values from",
+		},
+	}
+
+	for _, f := range ConfigFields() {
+		property := schemaType(f.Type)
+		description := f.Usage
+		if f.Secret {
+			description = fmt.Sprintf("%s.  Secret: may be a reference such as ssm:/path, secretsmanager:name#key or env:VAR", description)
+		}
+
+		property["description"] = description
+		properties[f.Name] = property
+	}
+
+	accountProperties := make(map[string]interface{})
+
+	t := reflect.TypeOf(Account{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		property := schemaType(t.Field(i).Type)
+		property["description"] = t.Field(i).Tag.Get("usage")
+		accountProperties[name] = property
+	}
+
+	schema = map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "Orion PTT System ops config file",
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{CONFIG_VERSION_KEY, "profiles"},
+		"properties": map[string]interface{}{
+			CONFIG_VERSION_KEY: map[string]interface{}{
+				"type":        "integer",
+				"const":       CONFIG_VERSION,
+				"description": "config file format version.  Run 'ops config migrate' to upgrade older files.",
+			},
+			"default_profile": map[string]interface{}{
+				"type":        "string",
+				"description": "profile used when none is selected",
+			},
+			"profiles": map[string]interface{}{
+				"type":                 "object",
+				"description":          "named profiles",
+				"additionalProperties": map[string]interface{}{"$ref": "#/definitions/profile"},
+			},
+			ACCOUNTS_KEY: map[string]interface{}{
+				"type":                 "object",
+				"description":          "AWS accounts, by alias, reached by assuming a role.  Select one with --account",
+				"additionalProperties": map[string]interface{}{"$ref": "#/definitions/account"},
+			},
+		},
+		"definitions": map[string]interface{}{
+			"profile": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties":           properties,
+			},
+			"account": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"required":             []string{"role_arn"},
+				"properties":           accountProperties,
+			},
+		},
+	}
+
+	return schema
+}
+
+// ConfigSchemaJSON returns the config file JSON Schema, indented, as published in CONFIG_SCHEMA_FILE.
+func ConfigSchemaJSON() (content []byte, err error) {
+	content, err = json.MarshalIndent(ConfigSchema(), "", "  ")
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling config schema")
+		return content, err
+	}
+
+	content = append(content, '\n')
+
+	return content, err
+}
+
+// schemaType maps a StackConfig field type to a JSON Schema type.
+func schemaType(t reflect.Type) (property map[string]interface{}) {
+	switch t.Kind() {
+	case reflect.Bool:
+		property = map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		property = map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		property = map[string]interface{}{"type": "array", "items": schemaType(t.Elem())}
+	case reflect.Map:
+		property = map[string]interface{}{"type": "object", "additionalProperties": schemaType(t.Elem())}
+	default:
+		property = map[string]interface{}{"type": "string"}
+	}
+
+	return property
+}
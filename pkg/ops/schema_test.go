@@ -0,0 +1,77 @@
+package ops
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestConfigSchemaPublished(t *testing.T) {
+	published, err := ioutil.ReadFile("../../" + CONFIG_SCHEMA_FILE)
+	if err != nil {
+		t.Errorf("failed reading %s: %s", CONFIG_SCHEMA_FILE, err)
+	}
+
+	generated, err := ConfigSchemaJSON()
+	if err != nil {
+		t.Errorf("failed generating schema: %s", err)
+	}
+
+	assert.Equal(t, string(generated), string(published), "%s is stale.  Regenerate it with 'ops config schema > %s'", CONFIG_SCHEMA_FILE, CONFIG_SCHEMA_FILE)
+}
+
+func TestConfigFileUnknownKeys(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			"typo in flat file",
+			`{"dns_domian": "example.com"}`,
+			`unknown key "dns_domian" in profile "default" (did you mean "dns_domain"?)`,
+		},
+		{
+			"typo in profile",
+			`{"version": 2, "profiles": {"dev": {"inherits": "base", "keyname": "nik"}, "base": {}}}`,
+			`unknown key "keyname" in profile "dev" (did you mean "key_name"?)`,
+		},
+		{
+			"nothing close",
+			`{"version": 2, "profiles": {"dev": {"frobnicate": true}}}`,
+			`unknown key "frobnicate" in profile "dev"`,
+		},
+		{
+			"top level typo",
+			`{"version": 2, "default_profil": "dev", "profiles": {}}`,
+			`unknown key "default_profil" in config file (did you mean "default_profile"?)`,
+		},
+		{
+			"valid",
+			`{"version": 2, "profiles": {"dev": {"inherits": "base", "key_name": "nik"}, "base": {}}}`,
+			"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := (&ConfigFile{}).Parse([]byte(tc.content))
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err, "expected an error") {
+				assert.Equal(t, tc.err, err.Error(), "error doesn't meet expectations")
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	known := ProfileKeys()
+
+	assert.Equal(t, "subnet_ids", Suggest("subnets_ids", known), "suggestion doesn't meet expectations")
+	assert.Equal(t, "user_name", Suggest("username", known), "suggestion doesn't meet expectations")
+	assert.Equal(t, "", Suggest("zzz", known), "expected no suggestion")
+}
@@ -0,0 +1,223 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/pkg/errors"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// SECRET_REF_SSM Prefix for config values that reference an SSM Parameter Store parameter.  e.g. 'ssm:/orion/kotsadm-password'
+const SECRET_REF_SSM = "ssm:"
+
+// SECRET_REF_SECRETS_MANAGER Prefix for config values that reference a Secrets Manager secret, optionally with a JSON key.  e.g. 'secretsmanager:orion/pw#key'
+const SECRET_REF_SECRETS_MANAGER = "secretsmanager:"
+
+// SECRET_REF_ENV Prefix for config values that reference an environment variable.  e.g. 'env:KOTSADM_PASSWORD'
+const SECRET_REF_ENV = "env:"
+
+// SecretResolver resolves secret references in config values.  The AWS clients are created on first use, so configs without references never touch AWS.
+type SecretResolver struct {
+	SSM            ssmiface.SSMAPI
+	SecretsManager secretsmanageriface.SecretsManagerAPI
+	AwsSession     *session.Session
+	Region         string // region references are resolved in, if not the session's own.  Set it to the stack's region.
+}
+
+// NewSecretResolver creates a SecretResolver.  If awsSession is nil, DefaultSession() is used should a reference need AWS.
+func NewSecretResolver(awsSession *session.Session) (resolver *SecretResolver) {
+	resolver = &SecretResolver{
+		AwsSession: awsSession,
+	}
+
+	return resolver
+}
+
+// IsSecretReference returns true if value is a secret reference, rather than a secret.
+func IsSecretReference(value string) bool {
+	for _, prefix := range []string{SECRET_REF_SSM, SECRET_REF_SECRETS_MANAGER, SECRET_REF_ENV} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve returns the value a reference points to.  Values that aren't references are returned unchanged.  Resolved values are registered for redaction.
+func (r *SecretResolver) Resolve(value string) (resolved string, err error) {
+	switch {
+	case strings.HasPrefix(value, SECRET_REF_SSM):
+		resolved, err = r.resolveSSM(strings.TrimPrefix(value, SECRET_REF_SSM))
+	case strings.HasPrefix(value, SECRET_REF_SECRETS_MANAGER):
+		resolved, err = r.resolveSecretsManager(strings.TrimPrefix(value, SECRET_REF_SECRETS_MANAGER))
+	case strings.HasPrefix(value, SECRET_REF_ENV):
+		name := strings.TrimPrefix(value, SECRET_REF_ENV)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			err = errors.New(fmt.Sprintf("environment variable %s is not set", name))
+		}
+		resolved = v
+	default:
+		resolved = value
+		return resolved, err
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "failed resolving %q", value)
+		return resolved, err
+	}
+
+	RegisterSecret(resolved)
+
+	return resolved, err
+}
+
+// session returns the session references are resolved with, in Region if it's set.  The default session is created on first use.
+func (r *SecretResolver) session() (awsSession *session.Session, err error) {
+	if r.AwsSession == nil {
+		r.AwsSession, err = DefaultSession()
+		if err != nil {
+			err = errors.Wrapf(err, "failed creating aws session")
+			return awsSession, err
+		}
+	}
+
+	awsSession = r.AwsSession
+
+	if r.Region != "" {
+		awsSession = awsSession.Copy(&aws.Config{Region: aws.String(r.Region)})
+	}
+
+	return awsSession, err
+}
+
+func (r *SecretResolver) resolveSSM(name string) (value string, err error) {
+	if r.SSM == nil {
+		sess, err := r.session()
+		if err != nil {
+			return value, err
+		}
+
+		r.SSM = ssm.New(sess)
+	}
+
+	output, err := r.SSM.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting parameter %s", name)
+		return value, err
+	}
+
+	if output.Parameter == nil || output.Parameter.Value == nil {
+		err = errors.New(fmt.Sprintf("parameter %s has no value", name))
+		return value, err
+	}
+
+	value = *output.Parameter.Value
+
+	return value, err
+}
+
+func (r *SecretResolver) resolveSecretsManager(ref string) (value string, err error) {
+	if r.SecretsManager == nil {
+		sess, err := r.session()
+		if err != nil {
+			return value, err
+		}
+
+		r.SecretsManager = secretsmanager.New(sess)
+	}
+
+	id := ref
+	key := ""
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		id = ref[:i]
+		key = ref[i+1:]
+	}
+
+	output, err := r.SecretsManager.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting secret %s", id)
+		return value, err
+	}
+
+	if output.SecretString == nil {
+		err = errors.New(fmt.Sprintf("secret %s has no string value", id))
+		return value, err
+	}
+
+	if key == "" {
+		value = *output.SecretString
+		return value, err
+	}
+
+	fields := make(map[string]interface{})
+
+	err = json.Unmarshal([]byte(*output.SecretString), &fields)
+	if err != nil {
+		err = errors.Wrapf(err, "secret %s is not a JSON object, can't look up key %q", id, key)
+		return value, err
+	}
+
+	v, ok := fields[key]
+	if !ok {
+		err = errors.New(fmt.Sprintf("secret %s has no key %q", id, key))
+		return value, err
+	}
+
+	value = fmt.Sprintf("%v", v)
+
+	return value, err
+}
+
+// ResolveSecrets replaces every secret reference in the config's string fields with the value it points to.
+func (c *StackConfig) ResolveSecrets(r *SecretResolver) (err error) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		name := t.Field(i).Tag.Get("json")
+
+		switch field.Kind() {
+		case reflect.String:
+			resolved, err := r.Resolve(field.String())
+			if err != nil {
+				err = errors.Wrapf(err, "failed resolving %s", name)
+				return err
+			}
+
+			field.SetString(resolved)
+
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+
+			for j := 0; j < field.Len(); j++ {
+				resolved, err := r.Resolve(field.Index(j).String())
+				if err != nil {
+					err = errors.Wrapf(err, "failed resolving %s", name)
+					return err
+				}
+
+				field.Index(j).SetString(resolved)
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,150 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	params map[string]string
+}
+
+func (f *fakeSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	v, ok := f.params[*input.Name]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "not found", nil)
+	}
+
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Name: input.Name, Value: aws.String(v)}}, nil
+}
+
+type fakeSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+}
+
+func (f *fakeSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	v, ok := f.secrets[*input.SecretId]
+	if !ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(v)}, nil
+}
+
+func testSecretResolver() *SecretResolver {
+	return &SecretResolver{
+		SSM: &fakeSSM{
+			params: map[string]string{
+				"/orion/kotsadm-password": "ssm-password",
+			},
+		},
+		SecretsManager: &fakeSecretsManager{
+			secrets: map[string]string{
+				"orion/pw":    `{"key": "sm-password", "other": "nope"}`,
+				"orion/plain": "plain-password",
+			},
+		},
+	}
+}
+
+func TestSecretResolverResolve(t *testing.T) {
+	clearSecrets(t)
+
+	_ = os.Setenv("OPS_TEST_SECRET", "env-password")
+
+	cases := []struct {
+		name     string
+		value    string
+		resolved string
+		err      bool
+	}{
+		{"plain value", "just-a-value", "just-a-value", false},
+		{"ssm", "ssm:/orion/kotsadm-password", "ssm-password", false},
+		{"ssm missing", "ssm:/orion/nope", "", true},
+		{"secretsmanager key", "secretsmanager:orion/pw#key", "sm-password", false},
+		{"secretsmanager plain", "secretsmanager:orion/plain", "plain-password", false},
+		{"secretsmanager missing key", "secretsmanager:orion/pw#missing", "", true},
+		{"secretsmanager not json", "secretsmanager:orion/plain#key", "", true},
+		{"env", "env:OPS_TEST_SECRET", "env-password", false},
+		{"env missing", "env:OPS_TEST_SECRET_NOT_SET", "", true},
+	}
+
+	r := testSecretResolver()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolved, err := r.Resolve(tc.value)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.resolved, resolved, "resolved value doesn't meet expectations")
+		})
+	}
+}
+
+func TestStackConfigResolveSecrets(t *testing.T) {
+	clearSecrets(t)
+
+	config := StackConfig{
+		StackName:       "opstest",
+		KotsadmPassword: "ssm:/orion/kotsadm-password",
+		SubnetIDs:       []string{"subnet-1", "secretsmanager:orion/plain"},
+	}
+
+	err := config.ResolveSecrets(testSecretResolver())
+	if err != nil {
+		t.Errorf("failed resolving secrets: %s", err)
+	}
+
+	assert.Equal(t, "opstest", config.StackName, "plain value was modified")
+	assert.Equal(t, "ssm-password", config.KotsadmPassword, "password not resolved")
+	assert.Equal(t, []string{"subnet-1", "plain-password"}, config.SubnetIDs, "subnets not resolved")
+	assert.Equal(t, REDACTED_MASK, Redact("ssm-password"), "resolved secret not registered for redaction")
+}
+
+func TestSecretResolverRegion(t *testing.T) {
+	base, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	if err != nil {
+		t.Fatalf("failed creating session: %s", err)
+	}
+
+	cases := []struct {
+		name     string
+		region   string
+		expected string
+	}{
+		{"session's own", "", "us-east-1"},
+		{"stack's", "eu-west-1", "eu-west-1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := NewSecretResolver(base)
+			resolver.Region = tc.region
+
+			sess, err := resolver.session()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, aws.StringValue(sess.Config.Region), "region doesn't meet expectations")
+		})
+	}
+}
+
+func TestIsSecretReference(t *testing.T) {
+	assert.True(t, IsSecretReference("ssm:/orion/kotsadm-password"), "ssm reference not recognized")
+	assert.True(t, IsSecretReference("secretsmanager:orion/pw#key"), "secrets manager reference not recognized")
+	assert.True(t, IsSecretReference("env:KOTSADM_PASSWORD"), "env reference not recognized")
+	assert.False(t, IsSecretReference("hunter22"), "literal taken for a reference")
+}
@@ -1,13 +1,11 @@
 package ops
 
 import (
+	"crypto/subtle"
 	"crypto/tls"
 	"embed"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/gin-gonic/gin"
@@ -18,6 +16,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,6 +25,8 @@ var content embed.FS
 
 type OnpremDetails struct {
 	Account     string `json:"account" binding:"required"`
+	Alias       string `json:"alias"`
+	Region      string `json:"region"`
 	Kubernetes  string `json:"kubernetes" binding:"required"`
 	Kotsadm     string `json:"kotsadm" binding:"required"`
 	CFStatus    string `json:"cfstatus" binding:"required"`
@@ -42,77 +43,220 @@ type OnpremDetails struct {
 	Uptime      string `json:"uptime" binding:"required"`
 }
 
-type Account struct {
-	Number    string `json:"account_number"`
-	KeyId     string `json:"aws_access_key_id"`
-	SecretKey string `json:"aws_secret_access_key"`
-	Region    string `json:"aws_region"`
-}
-
 type OpsServer struct {
-	Address  string
-	Port     int
-	Accounts []Account
+	ConfigPath string // the server config file, watched for changes.  Empty if the config didn't come from a file.
+	Address    string // overrides the address in the config file, e.g. from --address.  Kept across reloads.
+	Port       int    // overrides the port in the config file, e.g. from --port.  Kept across reloads.
+	config     *ServerConfig
+	accounts   []Account
+	sessions   map[string]*session.Session // by account alias.  Their credentials refresh themselves.
+	instances  []OnpremDetails             // as of the last background refresh
+	refreshed  time.Time
+	mutex      sync.RWMutex
 }
 
+// ACCOUNT_ENV_VAR Environment variable that once held static, base64 encoded, credentials for the server's accounts.  No longer supported: accounts are defined by role in the server config file.
 const ACCOUNT_ENV_VAR = "AWS_ACCOUNT_CREDENTIALS"
 
 func init() {
 	log.SetFormatter(&log.JSONFormatter{})
+	log.SetOutput(NewRedactingWriter(os.Stderr))
 	log.SetLevel(log.DebugLevel)
 }
 
-func NewOpsServer(address string, port int) (server *OpsServer, err error) {
-	accounts := make([]Account, 0)
-
+// NewOpsServer creates a server from its config.  See Apply.
+func NewOpsServer(config *ServerConfig) (server *OpsServer, err error) {
 	if os.Getenv(ACCOUNT_ENV_VAR) != "" {
-		decoded, err := base64.StdEncoding.DecodeString(os.Getenv(ACCOUNT_ENV_VAR))
+		err = errors.New(fmt.Sprintf("static credentials in %s are no longer supported.  Define the server's accounts by role_arn in its config file instead", ACCOUNT_ENV_VAR))
+		return server, err
+	}
+
+	server = &OpsServer{}
+
+	err = server.Apply(config)
+
+	return server, err
+}
+
+// Config returns the config the server is running with.
+func (s *OpsServer) Config() (config *ServerConfig) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	config = s.config
+
+	return config
+}
+
+// Apply switches the server to a new config.  The role of every account is assumed from the server's own credentials, and checked, first.  If any can't be, the server keeps its current config.  Without any accounts, the server manages the account its own credentials are for.
+func (s *OpsServer) Apply(config *ServerConfig) (err error) {
+	base, err := DefaultSession()
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating aws session")
+		return err
+	}
+
+	accounts := config.AccountList()
+
+	if len(accounts) == 0 {
+		output, err := sts.New(base).GetCallerIdentity(&sts.GetCallerIdentityInput{})
 		if err != nil {
-			err = errors.Wrapf(err, "failed to decode base64 encoded creds from environment")
-			return server, err
+			err = errors.Wrapf(err, "Error getting caller identity")
+			return err
 		}
 
-		err = json.Unmarshal(decoded, &accounts)
-		if err != nil {
-			err = errors.Wrapf(err, "Failed unmarshalling json in %s", ACCOUNT_ENV_VAR)
-			return server, err
+		log.Warnf("No accounts configured.  Managing the account of the server's own credentials: %s", aws.StringValue(output.Account))
+
+		number := aws.StringValue(output.Account)
+		accounts = []Account{{Alias: number, Number: number}}
+	}
+
+	sessions := make(map[string]*session.Session)
+
+	for _, account := range accounts {
+		awsSession := AccountSession(base, account)
+
+		if account.RoleArn != "" {
+			log.Debugf("Assuming %s for account %s", account.RoleArn, account.Number)
+
+			err = VerifyAccount(awsSession, account)
+			if err != nil {
+				err = errors.Wrapf(err, "failed assuming %s for account %s", account.RoleArn, account.Number)
+				return err
+			}
 		}
 
-		log.Debugf("Using Credentials from %s", ACCOUNT_ENV_VAR)
+		// aliases, not numbers: two aliases may use different roles, or regions, in the same account.
+		sessions[account.Alias] = awsSession
+	}
 
-	} else {
-		log.Debugf("Using Default Credentials")
-		sess, err := DefaultSession()
-		if err != nil {
-			log.Fatalf("failed creating aws session: %s", err)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.config != nil {
+		for _, setting := range RestartRequired(s.config, config) {
+			log.Warnf("The %s changed.  It takes effect when the server restarts", setting)
 		}
+	}
 
-		// This is a horrible hack that just gets the account from the caller - i.e. the aws creds of whomever started the server
-		output, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	s.config = config
+	s.accounts = accounts
+	s.sessions = sessions
+
+	return err
+}
+
+// Reload re-reads the server's config file and applies it, with the server's own Address and Port, if set, in place of the file's.  If the new config is invalid, or can't be applied, the server keeps the last good one.
+func (s *OpsServer) Reload() (err error) {
+	config, err := ReadServerConfig(s.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	config.Override(s.Address, s.Port)
+
+	err = s.Apply(config)
+
+	return err
+}
+
+// Watch polls the server's config file, every reload interval, and reloads it whenever it's modified.  Runs until the server exits.
+func (s *OpsServer) Watch() {
+	var modified time.Time
+
+	info, err := os.Stat(s.ConfigPath)
+	if err == nil {
+		modified = info.ModTime()
+	}
+
+	for {
+		time.Sleep(s.Config().ReloadInterval)
+
+		info, err := os.Stat(s.ConfigPath)
 		if err != nil {
-			err = errors.Wrapf(err, "Error getting caller identity")
-			return server, err
+			log.Errorf("Failed checking %s for changes: %s", s.ConfigPath, err)
+			continue
 		}
 
-		account := Account{
-			Number: *output.Account,
+		if info.ModTime().Equal(modified) {
+			continue
 		}
 
-		accounts = append(accounts, account)
+		modified = info.ModTime()
+
+		err = s.Reload()
+		if err != nil {
+			log.Errorf("Rejected changes to %s, keeping the last good config: %s", s.ConfigPath, err)
+			continue
+		}
+
+		log.Infof("Reloaded %s", s.ConfigPath)
+
+		go s.Refresh()
 	}
+}
 
-	server = &OpsServer{
-		Address:  address,
-		Port:     port,
-		Accounts: accounts,
+// Refresh lists the stacks in every account and region, and keeps them for InstancesHandler.
+func (s *OpsServer) Refresh() {
+	instances, err := s.ListInstances()
+	if err != nil {
+		log.Errorf("Failed refreshing stacks: %s", err)
+		return
 	}
 
-	return server, err
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.instances = instances
+	s.refreshed = time.Now()
+}
+
+// RefreshLoop refreshes the stacks every refresh interval.  Runs until the server exits.
+func (s *OpsServer) RefreshLoop() {
+	for {
+		s.Refresh()
+		time.Sleep(s.Config().RefreshInterval)
+	}
+}
+
+// Authenticate requires HTTP basic auth as one of the configured users.  Without users, every request is let through.
+func (s *OpsServer) Authenticate(c *gin.Context) {
+	users := s.Config().Auth.Users
+	if len(users) == 0 {
+		c.Next()
+		return
+	}
+
+	user, password, ok := c.Request.BasicAuth()
+	if ok {
+		expected, found := users[user]
+		if found && subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1 {
+			c.Next()
+			return
+		}
+	}
+
+	c.Header("WWW-Authenticate", `Basic realm="Orion PTT System"`)
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// certificate hands the TLS listener the certificate from the current config, so a new one is used without a restart.
+func (s *OpsServer) certificate(hello *tls.ClientHelloInfo) (certificate *tls.Certificate, err error) {
+	certificate = s.Config().Certificate
+	if certificate == nil {
+		err = errors.New("no tls certificate configured")
+		return certificate, err
+	}
+
+	return certificate, err
 }
 
+// Run serves the API and web UI, refreshing the stacks in the background, and watching the config file if there is one.
 func (s *OpsServer) Run() (err error) {
 	router := gin.Default()
 
+	router.Use(s.Authenticate)
+
 	api := router.Group("/api")
 
 	{
@@ -124,13 +268,35 @@ func (s *OpsServer) Run() (err error) {
 	}
 
 	api.GET("/stacks", s.InstancesHandler)
-	api.GET("/stacks/:account/:stackName", s.SingleInstanceHandler)
-	api.GET("/stacks/:account/:stackName/ca", s.InstanceCaHandler)
-	api.DELETE("/stacks/:account/:stackName", s.InstanceDeleteHandler)
+	api.GET("/stacks/:alias/:stackName", s.SingleInstanceHandler)
+	api.GET("/stacks/:alias/:stackName/ca", s.InstanceCaHandler)
+	api.DELETE("/stacks/:alias/:stackName", s.InstanceDeleteHandler)
 
 	router.Use(s.Serve("/", content))
 
-	addr := fmt.Sprintf("%s:%d", s.Address, s.Port)
+	go s.RefreshLoop()
+
+	if s.ConfigPath != "" {
+		go s.Watch()
+	}
+
+	config := s.Config()
+	addr := config.ListenAddress()
+
+	if config.Certificate != nil {
+		fmt.Printf("Server starting on %s, with TLS.\n", addr)
+
+		server := &http.Server{
+			Addr:      addr,
+			Handler:   router,
+			TLSConfig: &tls.Config{GetCertificate: s.certificate},
+		}
+
+		err = server.ListenAndServeTLS("", "")
+
+		return err
+	}
+
 	fmt.Printf("Server starting on %s.\n", addr)
 
 	err = router.Run(addr)
@@ -174,8 +340,8 @@ func (s *OpsServer) InstancesHandler(c *gin.Context) {
 func (s *OpsServer) SingleInstanceHandler(c *gin.Context) {
 	c.Header("Content-Type", "application/json")
 
-	account := c.Param("account")
-	if account == "" {
+	alias := c.Param("alias")
+	if alias == "" {
 		c.AbortWithStatus(http.StatusNotFound)
 	}
 
@@ -184,7 +350,7 @@ func (s *OpsServer) SingleInstanceHandler(c *gin.Context) {
 		c.AbortWithStatus(http.StatusNotFound)
 	}
 
-	deets, err := s.GetDetails(account, stackName)
+	deets, err := s.GetDetails(alias, c.Query("region"), stackName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, OnpremDetails{})
 		log.Errorf("Error in single instance handler: %s", err)
@@ -196,8 +362,8 @@ func (s *OpsServer) SingleInstanceHandler(c *gin.Context) {
 
 // InstanceCaHandler fetches the CA cert for a specific instance and sends it back to the client.
 func (s *OpsServer) InstanceCaHandler(c *gin.Context) {
-	account := c.Param("account")
-	if account == "" {
+	alias := c.Param("alias")
+	if alias == "" {
 		c.AbortWithStatus(http.StatusNotFound)
 	}
 
@@ -206,7 +372,7 @@ func (s *OpsServer) InstanceCaHandler(c *gin.Context) {
 		c.AbortWithStatus(http.StatusNotFound)
 	}
 
-	stack, err := s.GetDetails(account, stackName)
+	stack, err := s.GetDetails(alias, c.Query("region"), stackName)
 	if err != nil {
 		c.AbortWithStatus(http.StatusNotFound)
 	}
@@ -229,8 +395,8 @@ func (s *OpsServer) InstanceCaHandler(c *gin.Context) {
 
 // InstanceDeleteHandler deletes a specific instance
 func (s *OpsServer) InstanceDeleteHandler(c *gin.Context) {
-	account := c.Param("account")
-	if account == "" {
+	alias := c.Param("alias")
+	if alias == "" {
 		c.AbortWithStatus(http.StatusNotFound)
 	}
 
@@ -239,7 +405,7 @@ func (s *OpsServer) InstanceDeleteHandler(c *gin.Context) {
 		c.AbortWithStatus(http.StatusNotFound)
 	}
 
-	err := s.DeleteStack(account, stackName)
+	err := s.DeleteStack(alias, c.Query("region"), stackName)
 	if err != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
 	}
@@ -247,62 +413,24 @@ func (s *OpsServer) InstanceDeleteHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-// GetStack retrieves a configured stack object for a given account and name based on credentials we have available.
-func (s *OpsServer) GetStack(accountNumber string, stackName string) (stack *Stack, err error) {
-	log.Debugf("Generating Stack object for account: %q name: %q", accountNumber, stackName)
+// GetStack retrieves a configured stack object for a given account alias, region and name based on credentials we have available.  An empty region is the account's default.
+func (s *OpsServer) GetStack(alias string, region string, stackName string) (stack *Stack, err error) {
+	log.Debugf("Generating Stack object for account: %q region: %q name: %q", alias, region, stackName)
 
-	var account *Account
+	s.mutex.RLock()
+	awsSession, ok := s.sessions[alias]
+	s.mutex.RUnlock()
 
-	for _, a := range s.Accounts {
-		log.Debugf("Checking %s against %s", a.Number, accountNumber)
-		if a.Number == accountNumber {
-			log.Debugf("Setting accoutn as %s", a.Number)
-			account = &a
-			break
-		}
-	}
-
-	if account == nil {
-		err = errors.New(fmt.Sprintf("Failed to retrieve Account Object for %q", accountNumber))
+	if !ok {
+		err = errors.New(fmt.Sprintf("Failed to retrieve Account Object for %q", alias))
 		return stack, err
 	}
 
-	log.Debugf("Account is %s", account.Number)
-
 	config := StackConfig{
 		StackName: stackName,
+		Region:    region,
 	}
 
-	var awsSession *session.Session
-
-	// If we haven't done any special account and credential provisioning, get them in the normal fashion
-	if account.KeyId == "" && account.SecretKey == "" {
-		log.Debugf("Using DefaultSession")
-		awsSession, err = DefaultSession()
-		if err != nil {
-			err = errors.Wrapf(err, "failed to get default session")
-			return stack, err
-		}
-	} else { // otherwise, use what was explicitly provisioned
-		log.Debugf("Creating Session from static creds.  ID: %s", account.KeyId)
-		awsSession, err = session.NewSession(&aws.Config{
-			Region:      aws.String(account.Region),
-			Credentials: credentials.NewStaticCredentials(account.KeyId, account.SecretKey, ""),
-		})
-		if err != nil {
-			err = errors.Wrapf(err, "failed to create session from static creds")
-			return stack, err
-		}
-	}
-
-	output, err := sts.New(awsSession).GetCallerIdentity(&sts.GetCallerIdentityInput{})
-	if err != nil {
-		err = errors.Wrapf(err, "Error getting caller identity")
-		return stack, err
-	}
-
-	log.Debugf("getting stack from account %s", *output.Account)
-
 	stack, err = NewStack(&config, awsSession, false)
 	if err != nil {
 		err = errors.Wrapf(err, "failed creating stack object")
@@ -312,56 +440,143 @@ func (s *OpsServer) GetStack(accountNumber string, stackName string) (stack *Sta
 	return stack, err
 }
 
-func (s *OpsServer) DeleteStack(accountNumber string, stackName string) (err error) {
-	stack, err := s.GetStack(accountNumber, stackName)
+// DeleteStack deletes a stack, and then, in the background, its dedicated VPC, if it has one.
+func (s *OpsServer) DeleteStack(alias string, region string, stackName string) (err error) {
+	stack, err := s.GetStack(alias, region, stackName)
 	if err != nil {
-		err = errors.Wrapf(err, "failed to generate stack for account %s name %s", accountNumber, stackName)
+		err = errors.Wrapf(err, "failed to generate stack for account %s name %s", alias, stackName)
 		return err
 	}
 
 	err = stack.Delete()
+	if err != nil {
+		return err
+	}
+
+	s.forget(alias, region, stackName)
+
+	// a dedicated VPC can only go once the stack has, which takes longer than a request should.
+	go func() {
+		_, err := stack.WaitForDeletion()
+		if err != nil {
+			log.Errorf("Not removing the VPC, if any, of stack %s: %s", stackName, err)
+			return
+		}
+
+		err = stack.DeleteStackVpc()
+		if err != nil {
+			log.Errorf("Failed removing VPC created for %s: %s", stackName, err)
+		}
+	}()
 
 	return err
 }
 
-func (s *OpsServer) GetInstances() (instances []OnpremDetails, err error) {
-	instances = make([]OnpremDetails, 0)
+// forget drops a deleted stack from the stacks kept since the last refresh, so it isn't served until the next one.
+func (s *OpsServer) forget(alias string, region string, stackName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	for _, account := range s.Accounts {
-		log.Debugf("Getting stacks for %s", account.Number)
-		stack, err := s.GetStack(account.Number, "")
-		if err != nil {
-			err = errors.Wrapf(err, "failed to generate stack for account %s", account.Number)
-			return instances, err
+	s.instances = RemoveInstance(s.instances, alias, region, stackName)
+}
+
+// RemoveInstance returns instances without the named stack.
+func RemoveInstance(instances []OnpremDetails, alias string, region string, stackName string) (remaining []OnpremDetails) {
+	remaining = make([]OnpremDetails, 0)
+
+	for _, i := range instances {
+		if i.Alias == alias && i.Region == region && i.Name == stackName {
+			continue
 		}
 
-		stacklist, err := stack.ListStacks()
-		if err != nil {
-			err = errors.Wrapf(err, "error listing stacks")
-			return instances, err
+		remaining = append(remaining, i)
+	}
+
+	return remaining
+}
+
+// accountNumber returns the number of the account with the given alias.
+func (s *OpsServer) accountNumber(alias string) (number string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, a := range s.accounts {
+		if a.Alias == alias {
+			number = a.Number
+			break
 		}
+	}
 
-		log.Debugf("%d instances for %s", len(stacklist), account.Number)
+	return number
+}
 
-		for _, stack := range stacklist {
+// GetInstances returns the stacks as of the last background refresh, or lists them if there hasn't been one yet.
+func (s *OpsServer) GetInstances() (instances []OnpremDetails, err error) {
+	s.mutex.RLock()
+	instances = s.instances
+	refreshed := s.refreshed
+	s.mutex.RUnlock()
 
-			display := OnpremDetails{
-				Name:    *stack.StackName,
-				Account: account.Number,
+	if !refreshed.IsZero() {
+		return instances, err
+	}
+
+	instances, err = s.ListInstances()
+
+	return instances, err
+}
+
+// ListInstances lists the stacks in every account, in each configured region, or the account's default region if none are.  An account or region that can't be listed is logged and skipped, rather than hiding the rest.
+func (s *OpsServer) ListInstances() (instances []OnpremDetails, err error) {
+	instances = make([]OnpremDetails, 0)
+
+	s.mutex.RLock()
+	accounts := s.accounts
+	regions := s.config.Regions
+	s.mutex.RUnlock()
+
+	if len(regions) == 0 {
+		regions = []string{""}
+	}
+
+	for _, account := range accounts {
+		for _, region := range regions {
+			log.Debugf("Getting stacks for %s %s", account.Alias, region)
+			stack, err := s.GetStack(account.Alias, region, "")
+			if err != nil {
+				log.Errorf("failed to generate stack for account %s: %s", account.Alias, err)
+				continue
 			}
 
-			instances = append(instances, display)
-		}
+			stacklist, err := stack.ListStacks()
+			if err != nil {
+				log.Errorf("error listing stacks in account %s %s: %s", account.Alias, region, err)
+				continue
+			}
+
+			log.Debugf("%d instances for %s %s", len(stacklist), account.Alias, region)
 
+			for _, stack := range stacklist {
+
+				display := OnpremDetails{
+					Name:    *stack.StackName,
+					Account: account.Number,
+					Alias:   account.Alias,
+					Region:  region,
+				}
+
+				instances = append(instances, display)
+			}
+		}
 	}
 
 	return instances, err
 }
 
-func (s *OpsServer) GetDetails(accountNum string, stackName string) (deets OnpremDetails, err error) {
-	stack, err := s.GetStack(accountNum, stackName)
+func (s *OpsServer) GetDetails(alias string, region string, stackName string) (deets OnpremDetails, err error) {
+	stack, err := s.GetStack(alias, region, stackName)
 	if err != nil {
-		err = errors.Wrapf(err, "failed to generate stack for account %s name %s", accountNum, stackName)
+		err = errors.Wrapf(err, "failed to generate stack for account %s name %s", alias, stackName)
 		return deets, err
 	}
 
@@ -389,10 +604,10 @@ func (s *OpsServer) GetDetails(accountNum string, stackName string) (deets Onpre
 
 	for _, o := range outputs {
 		switch *o.OutputKey {
-		case "Address":
+		case OUTPUT_ADDRESS:
 			address = *o.OutputValue
 
-		case "Login":
+		case OUTPUT_LOGIN:
 			e := PingEndpoint(*o.OutputValue)
 			if e != nil {
 				login = "Not Ready"
@@ -400,7 +615,7 @@ func (s *OpsServer) GetDetails(accountNum string, stackName string) (deets Onpre
 			}
 			login = fmt.Sprintf("https://%s", *o.OutputValue)
 
-		case "Api":
+		case OUTPUT_API:
 			e := PingEndpoint(*o.OutputValue)
 			if e != nil {
 				api = "Not Ready"
@@ -408,7 +623,7 @@ func (s *OpsServer) GetDetails(accountNum string, stackName string) (deets Onpre
 			}
 			api = fmt.Sprintf("https://%s", *o.OutputValue)
 
-		case "CA":
+		case OUTPUT_CA:
 			e := PingEndpoint(*o.OutputValue)
 			if e != nil {
 				caHost = "Not Ready"
@@ -433,7 +648,9 @@ func (s *OpsServer) GetDetails(accountNum string, stackName string) (deets Onpre
 	uptime = strings.ReplaceAll(uptime, "m", "m ")
 
 	deets = OnpremDetails{
-		Account:  accountNum,
+		Account:  s.accountNumber(alias),
+		Alias:    alias,
+		Region:   region,
 		Name:     stackName,
 		CFStatus: cfstatus,
 		Address:  address,
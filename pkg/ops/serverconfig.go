@@ -0,0 +1,294 @@
+package ops
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DEFAULT_SERVER_ADDRESS Address the server listens on, if its config doesn't say.
+const DEFAULT_SERVER_ADDRESS = "0.0.0.0"
+
+// DEFAULT_SERVER_PORT Port the server listens on, if its config doesn't say.
+const DEFAULT_SERVER_PORT = 3000
+
+// DEFAULT_REFRESH_INTERVAL How often the server refreshes its list of stacks in the background.
+const DEFAULT_REFRESH_INTERVAL = "1m"
+
+// DEFAULT_RELOAD_INTERVAL How often the server checks its config file for changes.
+const DEFAULT_RELOAD_INTERVAL = "10s"
+
+// MIN_POLL_INTERVAL Shortest refresh or reload interval allowed, so a typo can't hammer AWS.
+const MIN_POLL_INTERVAL = time.Second
+
+// regionPattern  An AWS region name, e.g. us-east-1 or us-gov-west-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// ServerConfig  Config of 'ops server', read from the file given with 'ops server --config'.  JSON or YAML.
+type ServerConfig struct {
+	Address   string             `json:"address"`
+	Port      int                `json:"port"`
+	TLS       ServerTLS          `json:"tls"`
+	Accounts  map[string]Account `json:"accounts"` // by alias, as in the ops config file
+	Regions   []string           `json:"regions"`  // regions stacks are listed in.  Defaults to each account's own.
+	Auth      ServerAuth         `json:"auth"`
+	Intervals ServerIntervals    `json:"intervals"`
+
+	RefreshInterval time.Duration    `json:"-"`
+	ReloadInterval  time.Duration    `json:"-"`
+	Certificate     *tls.Certificate `json:"-"`
+}
+
+// ServerTLS  The server's certificate and key.  Without them, the server speaks plain HTTP.
+type ServerTLS struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// ServerAuth  Users allowed to use the server, by HTTP basic auth.  Passwords may be secret references, e.g. ssm:/orion/server-password.  Without users, anyone can.
+type ServerAuth struct {
+	Users map[string]string `json:"users"`
+}
+
+// ServerIntervals  How often the server polls, as durations like '30s' or '5m'.
+type ServerIntervals struct {
+	Refresh string `json:"refresh"` // the list of stacks
+	Reload  string `json:"reload"`  // the config file
+}
+
+// DefaultServerConfig returns the server config used for anything its config file doesn't set.
+func DefaultServerConfig() (config *ServerConfig) {
+	config = &ServerConfig{
+		Address:  DEFAULT_SERVER_ADDRESS,
+		Port:     DEFAULT_SERVER_PORT,
+		Accounts: make(map[string]Account),
+		Regions:  make([]string, 0),
+		Auth: ServerAuth{
+			Users: make(map[string]string),
+		},
+		Intervals: ServerIntervals{
+			Refresh: DEFAULT_REFRESH_INTERVAL,
+			Reload:  DEFAULT_RELOAD_INTERVAL,
+		},
+	}
+
+	return config
+}
+
+// ParseServerConfig parses server config file content, as JSON, over the defaults, and validates it.  Unknown keys are an error, as are static credentials in an account.  Secret references and TLS files are left for ReadServerConfig.
+func ParseServerConfig(content []byte) (config *ServerConfig, err error) {
+	config = DefaultServerConfig()
+
+	raw := make(map[string]interface{})
+
+	err = json.Unmarshal(content, &raw)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to unmarshal json")
+		return config, err
+	}
+
+	err = checkAccountKeys(raw)
+	if err != nil {
+		return config, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(config)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse server config")
+		return config, err
+	}
+
+	err = config.Validate()
+
+	return config, err
+}
+
+// Validate checks the server config, and parses its intervals.  Every problem is reported together.
+func (c *ServerConfig) Validate() (err error) {
+	problems := make([]string, 0)
+
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %d is out of range", c.Port))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		problems = append(problems, "tls needs both cert_file and key_file")
+	}
+
+	aliases := make([]string, 0)
+	for alias := range c.Accounts {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		account := c.Accounts[alias]
+		account.Alias = alias
+
+		e := account.Validate()
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("account %q: %s", alias, e))
+			continue
+		}
+
+		c.Accounts[alias] = account
+	}
+
+	for _, region := range c.Regions {
+		if !regionPattern.MatchString(region) {
+			problems = append(problems, fmt.Sprintf("%q is not a region", region))
+		}
+	}
+
+	for user, password := range c.Auth.Users {
+		if user == "" || password == "" {
+			problems = append(problems, "auth users need a name and a password")
+			break
+		}
+	}
+
+	c.RefreshInterval, err = parseInterval("refresh", c.Intervals.Refresh)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	c.ReloadInterval, err = parseInterval("reload", c.Intervals.Reload)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	err = nil
+
+	if len(problems) > 0 {
+		err = errors.New(strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// parseInterval parses a polling interval, which may be no shorter than MIN_POLL_INTERVAL.
+func parseInterval(name string, value string) (interval time.Duration, err error) {
+	interval, err = time.ParseDuration(value)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("%s interval %q is not a duration, e.g. 30s or 5m", name, value))
+		return interval, err
+	}
+
+	if interval < MIN_POLL_INTERVAL {
+		err = errors.New(fmt.Sprintf("%s interval %s is shorter than %s", name, interval, MIN_POLL_INTERVAL))
+		return interval, err
+	}
+
+	return interval, err
+}
+
+// AccountList returns the server's accounts, sorted by alias.
+func (c *ServerConfig) AccountList() (accounts []Account) {
+	accounts = make([]Account, 0)
+
+	aliases := make([]string, 0)
+	for alias := range c.Accounts {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		accounts = append(accounts, c.Accounts[alias])
+	}
+
+	return accounts
+}
+
+// ListenAddress returns the address and port the server listens on.
+func (c *ServerConfig) ListenAddress() (address string) {
+	address = fmt.Sprintf("%s:%d", c.Address, c.Port)
+
+	return address
+}
+
+// Override sets the listen address and port, e.g. from --address and --port, in place of the file's.  Empty or zero values leave the file's alone.
+func (c *ServerConfig) Override(address string, port int) {
+	if address != "" {
+		c.Address = address
+	}
+
+	if port != 0 {
+		c.Port = port
+	}
+}
+
+// RestartRequired lists the settings that differ between two configs, but only take effect when the server restarts: the listen address, and whether it speaks TLS at all.  A new certificate doesn't need a restart.
+func RestartRequired(running *ServerConfig, loaded *ServerConfig) (settings []string) {
+	settings = make([]string, 0)
+
+	if running.ListenAddress() != loaded.ListenAddress() {
+		settings = append(settings, "listen address")
+	}
+
+	if (running.Certificate == nil) != (loaded.Certificate == nil) {
+		settings = append(settings, "tls")
+	}
+
+	return settings
+}
+
+// ReadServerConfig reads the server config file at path.  Auth passwords are resolved, should they be secret references, and the TLS certificate is loaded.
+func ReadServerConfig(path string) (config *ServerConfig, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read server config file %s", path)
+		return config, err
+	}
+
+	if isYaml(path) {
+		content, err = yamlToJson(content)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse yaml in %s", path)
+			return config, err
+		}
+	}
+
+	config, err = ParseServerConfig(content)
+	if err != nil {
+		err = errors.Wrapf(err, "invalid server config %s", path)
+		return config, err
+	}
+
+	resolver := NewSecretResolver(nil)
+
+	for user, password := range config.Auth.Users {
+		resolved, err := resolver.Resolve(password)
+		if err != nil {
+			err = errors.Wrapf(err, "failed resolving password for %s", user)
+			return config, err
+		}
+
+		RegisterConfiguredSecret(resolved)
+		config.Auth.Users[user] = resolved
+	}
+
+	if config.TLS.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			err = errors.Wrapf(err, "failed loading tls certificate %s", config.TLS.CertFile)
+			return config, err
+		}
+
+		config.Certificate = &certificate
+	}
+
+	return config, err
+}
@@ -0,0 +1,186 @@
+package ops
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseServerConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		check   func(t *testing.T, config *ServerConfig)
+		err     string
+	}{
+		{
+			"defaults",
+			`{}`,
+			func(t *testing.T, config *ServerConfig) {
+				assert.Equal(t, "0.0.0.0:3000", config.ListenAddress(), "listen address doesn't meet expectations")
+				assert.Equal(t, time.Minute, config.RefreshInterval, "refresh interval doesn't meet expectations")
+				assert.Equal(t, 10*time.Second, config.ReloadInterval, "reload interval doesn't meet expectations")
+			},
+			"",
+		},
+		{
+			"full",
+			`{"address": "127.0.0.1", "port": 8443, "accounts": {"prod": {"role_arn": "arn:aws:iam::123456789012:role/orion-ops"}}, "regions": ["us-east-1", "us-gov-west-1"], "auth": {"users": {"admin": "env:OPS_PASSWORD"}}, "intervals": {"refresh": "30s", "reload": "5s"}}`,
+			func(t *testing.T, config *ServerConfig) {
+				assert.Equal(t, "127.0.0.1:8443", config.ListenAddress(), "listen address doesn't meet expectations")
+				assert.Equal(t, 30*time.Second, config.RefreshInterval, "refresh interval doesn't meet expectations")
+				assert.Equal(t, 5*time.Second, config.ReloadInterval, "reload interval doesn't meet expectations")
+				assert.Equal(t, []Account{{Alias: "prod", Number: "123456789012", RoleArn: "arn:aws:iam::123456789012:role/orion-ops"}}, config.AccountList(), "accounts don't meet expectations")
+			},
+			"",
+		},
+		{
+			"unknown key",
+			`{"prot": 8443}`,
+			nil,
+			`failed to parse server config: json: unknown field "prot"`,
+		},
+		{
+			"static keys",
+			`{"accounts": {"prod": {"role_arn": "arn:aws:iam::123456789012:role/orion-ops", "aws_secret_access_key": "shh"}}}`,
+			nil,
+			`account "prod" has static credentials (aws_secret_access_key).  They aren't supported: give the role_arn to assume instead`,
+		},
+		{
+			"everything wrong",
+			`{"port": 70000, "tls": {"cert_file": "server.crt"}, "accounts": {"prod": {}}, "regions": ["us-east"], "intervals": {"refresh": "soon", "reload": "10ms"}}`,
+			nil,
+			`port 70000 is out of range; tls needs both cert_file and key_file; account "prod": role_arn is required; "us-east" is not a region; refresh interval "soon" is not a duration, e.g. 30s or 5m; reload interval 10ms is shorter than 1s`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := ParseServerConfig([]byte(tc.content))
+			if tc.err != "" {
+				if assert.Error(t, err, "expected an error") {
+					assert.Equal(t, tc.err, err.Error(), "error doesn't meet expectations")
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			tc.check(t, config)
+		})
+	}
+}
+
+func TestReadServerConfig(t *testing.T) {
+	clearSecrets(t)
+
+	dir, err := ioutil.TempDir("", "ops-server")
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	_ = os.Setenv("OPS_TEST_SERVER_PASSWORD", "hunter2")
+	defer os.Unsetenv("OPS_TEST_SERVER_PASSWORD")
+
+	path := filepath.Join(dir, "server.yaml")
+	content := fmt.Sprintf("port: 8443\nauth:\n  users:\n    admin: env:OPS_TEST_SERVER_PASSWORD\n")
+
+	err = ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("failed writing %s: %s", path, err)
+	}
+
+	config, err := ReadServerConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 8443, config.Port, "port doesn't meet expectations")
+	assert.Equal(t, map[string]string{"admin": "hunter2"}, config.Auth.Users, "users don't meet expectations")
+
+	_, err = ReadServerConfig(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err, "expected an error for a missing file")
+}
+
+func TestRestartRequired(t *testing.T) {
+	running := DefaultServerConfig()
+
+	cases := []struct {
+		name     string
+		loaded   func() *ServerConfig
+		settings []string
+	}{
+		{
+			"nothing",
+			func() *ServerConfig { return DefaultServerConfig() },
+			[]string{},
+		},
+		{
+			"new regions",
+			func() *ServerConfig {
+				c := DefaultServerConfig()
+				c.Regions = []string{"us-west-2"}
+				return c
+			},
+			[]string{},
+		},
+		{
+			"new port",
+			func() *ServerConfig {
+				c := DefaultServerConfig()
+				c.Port = 8443
+				return c
+			},
+			[]string{"listen address"},
+		},
+		{
+			"tls turned on",
+			func() *ServerConfig {
+				c := DefaultServerConfig()
+				c.Certificate = &tls.Certificate{}
+				return c
+			},
+			[]string{"tls"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.settings, RestartRequired(running, tc.loaded()), "settings don't meet expectations")
+		})
+	}
+}
+
+func TestServerConfigOverride(t *testing.T) {
+	running := DefaultServerConfig()
+	running.Override("127.0.0.1", 8443)
+
+	assert.Equal(t, "127.0.0.1:8443", running.ListenAddress(), "listen address doesn't meet expectations")
+
+	// a reload of the same file, with the same overrides, needs no restart.
+	reloaded := DefaultServerConfig()
+	reloaded.Override("127.0.0.1", 8443)
+
+	assert.Equal(t, []string{}, RestartRequired(running, reloaded), "settings don't meet expectations")
+
+	file := DefaultServerConfig()
+	file.Port = 9443
+	file.Override("", 0)
+
+	assert.Equal(t, "0.0.0.0:9443", file.ListenAddress(), "listen address without overrides doesn't meet expectations")
+}
+
+func TestRemoveInstance(t *testing.T) {
+	instances := []OnpremDetails{
+		{Alias: "prod", Account: "123456789012", Region: "us-east-1", Name: "demo"},
+		{Alias: "prod", Account: "123456789012", Region: "us-west-2", Name: "demo"},
+		{Alias: "prod-eu", Account: "123456789012", Region: "us-east-1", Name: "demo"},
+	}
+
+	remaining := RemoveInstance(instances, "prod", "us-east-1", "demo")
+
+	assert.Equal(t, instances[1:], remaining, "remaining instances don't meet expectations")
+}
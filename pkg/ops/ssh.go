@@ -124,6 +124,13 @@ func (c *SshProgClient) SCPFile(content string, filename string) (err error) {
 // server decides to send back on STDOUT and STDERR.  What you send it, and what you do with the
 // reply is between you and the server.
 func (c *SshProgClient) RpcCall(input []byte, stdout, stderr io.Writer) (err error) {
+	err = c.RpcCallWithStdin(input, nil, stdout, stderr)
+
+	return err
+}
+
+// RpcCallWithStdin works like RpcCall, but also feeds stdin to the remote command.  Use it to hand secrets to the remote side without putting them on a command line where they'd show up in 'ps'.
+func (c *SshProgClient) RpcCallWithStdin(input []byte, stdin io.Reader, stdout, stderr io.Writer) (err error) {
 	addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
 
 	connection, err := ssh.Dial("tcp", addr, c.Config)
@@ -138,6 +145,7 @@ func (c *SshProgClient) RpcCall(input []byte, stdout, stderr io.Writer) (err err
 		return err
 	}
 
+	session.Stdin = stdin
 	session.Stdout = stdout
 	session.Stderr = stderr
 
@@ -0,0 +1,241 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// SUBNET_STRATEGY_AZ_ORDER Choose the candidate subnet in the first of preferred_azs, falling back to availability zone name order.
+const SUBNET_STRATEGY_AZ_ORDER = "az-order"
+
+// SUBNET_STRATEGY_MOST_FREE_IPS Choose the candidate subnet with the most free IP addresses.
+const SUBNET_STRATEGY_MOST_FREE_IPS = "most-free-ips"
+
+// SUBNET_STRATEGY_ROUND_ROBIN Choose a candidate subnet in the availability zone with the fewest existing stacks, spreading stacks across zones.
+const SUBNET_STRATEGY_ROUND_ROBIN = "round-robin"
+
+// DEFAULT_SUBNET_STRATEGY Strategy used when subnet_strategy isn't set.
+const DEFAULT_SUBNET_STRATEGY = SUBNET_STRATEGY_AZ_ORDER
+
+// subnetStrategies  Every known subnet strategy.
+var subnetStrategies = []string{
+	SUBNET_STRATEGY_AZ_ORDER,
+	SUBNET_STRATEGY_MOST_FREE_IPS,
+	SUBNET_STRATEGY_ROUND_ROBIN,
+}
+
+// Subnet  The parts of an EC2 subnet that matter when choosing one.
+type Subnet struct {
+	ID      string
+	VpcID   string
+	AZ      string
+	FreeIPs int
+	Tags    map[string]string
+}
+
+// SubnetSelection  The subnet chosen for a stack, and why.
+type SubnetSelection struct {
+	Subnet Subnet
+	Reason string
+}
+
+// NewSubnet converts an EC2 subnet.
+func NewSubnet(sn *ec2.Subnet) (subnet Subnet) {
+	subnet = Subnet{
+		ID:      aws.StringValue(sn.SubnetId),
+		VpcID:   aws.StringValue(sn.VpcId),
+		AZ:      aws.StringValue(sn.AvailabilityZone),
+		FreeIPs: int(aws.Int64Value(sn.AvailableIpAddressCount)),
+		Tags:    make(map[string]string),
+	}
+
+	for _, t := range sn.Tags {
+		subnet.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	return subnet
+}
+
+// MatchesTags returns true if the subnet has every tag in selector, with the same value.  An empty selector matches nothing.
+func (sn Subnet) MatchesTags(selector map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+
+	for k, v := range selector {
+		actual, ok := sn.Tags[k]
+		if !ok || actual != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CandidateSubnets returns the subnets the stack may be created in: those listed in subnet_ids, and those matching subnet_tags.  Sorted by ID.
+func (c *StackConfig) CandidateSubnets(subnets []Subnet) (candidates []Subnet) {
+	candidates = make([]Subnet, 0)
+
+	for _, sn := range subnets {
+		if StringInSlice(sn.ID, c.SubnetIDs) || sn.MatchesTags(c.SubnetTags) {
+			candidates = append(candidates, sn)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].ID < candidates[j].ID })
+
+	return candidates
+}
+
+// SelectSubnet chooses the subnet for the stack out of subnets, the subnets visible in the region.  subnet_id, if set, wins outright.  Otherwise the configured strategy picks among the candidates, with ties broken by preferred_azs, then availability zone, then subnet ID, so the same inputs always give the same answer.  stacksPerAZ counts existing stacks by availability zone, and is only needed for round-robin.
+func (c *StackConfig) SelectSubnet(subnets []Subnet, stacksPerAZ map[string]int) (selection SubnetSelection, err error) {
+	if c.SubnetID != "" {
+		for _, sn := range subnets {
+			if sn.ID == c.SubnetID {
+				selection = SubnetSelection{Subnet: sn, Reason: "set by subnet_id"}
+				return selection, err
+			}
+		}
+
+		err = errors.New(fmt.Sprintf("subnet %s not found", c.SubnetID))
+		return selection, err
+	}
+
+	strategy := c.SubnetStrategy
+	if strategy == "" {
+		strategy = DEFAULT_SUBNET_STRATEGY
+	}
+
+	if !StringInSlice(strategy, subnetStrategies) {
+		err = errors.New(fmt.Sprintf("unknown subnet_strategy %q.  Expected one of %s", strategy, strings.Join(subnetStrategies, ", ")))
+		return selection, err
+	}
+
+	candidates := c.CandidateSubnets(subnets)
+	if len(candidates) == 0 {
+		err = errors.New("no subnets matching subnet_ids or subnet_tags found")
+		return selection, err
+	}
+
+	// the deterministic tie-break every strategy falls back on.
+	azRank := func(az string) int {
+		for i, preferred := range c.PreferredAZs {
+			if preferred == az {
+				return i
+			}
+		}
+
+		return len(c.PreferredAZs)
+	}
+
+	tieBreak := func(a Subnet, b Subnet) bool {
+		if azRank(a.AZ) != azRank(b.AZ) {
+			return azRank(a.AZ) < azRank(b.AZ)
+		}
+
+		if a.AZ != b.AZ {
+			return a.AZ < b.AZ
+		}
+
+		return a.ID < b.ID
+	}
+
+	switch strategy {
+	case SUBNET_STRATEGY_MOST_FREE_IPS:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].FreeIPs != candidates[j].FreeIPs {
+				return candidates[i].FreeIPs > candidates[j].FreeIPs
+			}
+
+			return tieBreak(candidates[i], candidates[j])
+		})
+
+	case SUBNET_STRATEGY_ROUND_ROBIN:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if stacksPerAZ[candidates[i].AZ] != stacksPerAZ[candidates[j].AZ] {
+				return stacksPerAZ[candidates[i].AZ] < stacksPerAZ[candidates[j].AZ]
+			}
+
+			return tieBreak(candidates[i], candidates[j])
+		})
+
+	default:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return tieBreak(candidates[i], candidates[j])
+		})
+	}
+
+	chosen := candidates[0]
+	selection = SubnetSelection{Subnet: chosen}
+
+	switch {
+	case len(candidates) == 1:
+		selection.Reason = "only candidate subnet"
+	case strategy == SUBNET_STRATEGY_MOST_FREE_IPS:
+		selection.Reason = fmt.Sprintf("%s: most free IPs (%d) of %d candidates", strategy, chosen.FreeIPs, len(candidates))
+	case strategy == SUBNET_STRATEGY_ROUND_ROBIN:
+		selection.Reason = fmt.Sprintf("%s: %s has the fewest stacks (%d) of %d candidates", strategy, chosen.AZ, stacksPerAZ[chosen.AZ], len(candidates))
+	case azRank(chosen.AZ) < len(c.PreferredAZs):
+		selection.Reason = fmt.Sprintf("%s: %s is the most preferred zone with a candidate, of %d candidates", strategy, chosen.AZ, len(candidates))
+	default:
+		selection.Reason = fmt.Sprintf("%s: first of %d candidates by zone and id", strategy, len(candidates))
+	}
+
+	return selection, err
+}
+
+// DescribeSubnets lists every subnet visible in the stack's region.
+func (s *Stack) DescribeSubnets() (subnets []Subnet, err error) {
+	subnets = make([]Subnet, 0)
+
+	client := ec2.New(s.AwsSession)
+
+	err = client.DescribeSubnetsPages(&ec2.DescribeSubnetsInput{}, func(page *ec2.DescribeSubnetsOutput, lastPage bool) bool {
+		for _, sn := range page.Subnets {
+			subnets = append(subnets, NewSubnet(sn))
+		}
+
+		return true
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "unable to describe subnets")
+		return subnets, err
+	}
+
+	return subnets, err
+}
+
+// StacksPerAZ counts the existing stacks in each availability zone, from the subnet each was created in.
+func (s *Stack) StacksPerAZ(subnets []Subnet) (counts map[string]int, err error) {
+	counts = make(map[string]int)
+
+	stacks, err := s.ListStacks()
+	if err != nil {
+		err = errors.Wrapf(err, "failed listing stacks")
+		return counts, err
+	}
+
+	zones := make(map[string]string)
+	for _, sn := range subnets {
+		zones[sn.ID] = sn.AZ
+	}
+
+	for _, stack := range stacks {
+		for _, param := range stack.Parameters {
+			if aws.StringValue(param.ParameterKey) != "ExistingPublicSubnet" {
+				continue
+			}
+
+			az, ok := zones[aws.StringValue(param.ParameterValue)]
+			if ok {
+				counts[az]++
+			}
+		}
+	}
+
+	return counts, err
+}
@@ -0,0 +1,143 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testSubnets = []Subnet{
+	{ID: "subnet-d", VpcID: "vpc-1", AZ: "us-east-1c", FreeIPs: 200, Tags: map[string]string{"orion:use": "true"}},
+	{ID: "subnet-b", VpcID: "vpc-1", AZ: "us-east-1a", FreeIPs: 100, Tags: map[string]string{}},
+	{ID: "subnet-a", VpcID: "vpc-1", AZ: "us-east-1a", FreeIPs: 100, Tags: map[string]string{}},
+	{ID: "subnet-c", VpcID: "vpc-1", AZ: "us-east-1b", FreeIPs: 50, Tags: map[string]string{"orion:use": "true"}},
+	{ID: "subnet-e", VpcID: "vpc-2", AZ: "us-east-1d", FreeIPs: 250, Tags: map[string]string{"orion:use": "false"}},
+}
+
+func TestNewSubnet(t *testing.T) {
+	sn := NewSubnet(&ec2.Subnet{
+		SubnetId:                aws.String("subnet-a"),
+		VpcId:                   aws.String("vpc-1"),
+		AvailabilityZone:        aws.String("us-east-1a"),
+		AvailableIpAddressCount: aws.Int64(42),
+		Tags:                    []*ec2.Tag{{Key: aws.String("orion:use"), Value: aws.String("true")}},
+	})
+
+	assert.Equal(t, Subnet{ID: "subnet-a", VpcID: "vpc-1", AZ: "us-east-1a", FreeIPs: 42, Tags: map[string]string{"orion:use": "true"}}, sn, "subnet doesn't meet expectations")
+}
+
+func TestCandidateSubnets(t *testing.T) {
+	config := StackConfig{
+		SubnetIDs:  []string{"subnet-b", "subnet-x"},
+		SubnetTags: map[string]string{"orion:use": "true"},
+	}
+
+	ids := make([]string, 0)
+	for _, sn := range config.CandidateSubnets(testSubnets) {
+		ids = append(ids, sn.ID)
+	}
+
+	assert.Equal(t, []string{"subnet-b", "subnet-c", "subnet-d"}, ids, "candidates don't meet expectations")
+}
+
+func TestSelectSubnet(t *testing.T) {
+	all := []string{"subnet-a", "subnet-b", "subnet-c", "subnet-d"}
+
+	cases := []struct {
+		name        string
+		config      StackConfig
+		stacksPerAZ map[string]int
+		subnet      string
+		reason      string
+		err         string
+	}{
+		{
+			name:   "override",
+			config: StackConfig{SubnetID: "subnet-e", SubnetIDs: all},
+			subnet: "subnet-e",
+			reason: "set by subnet_id",
+		},
+		{
+			name:   "override not found",
+			config: StackConfig{SubnetID: "subnet-x"},
+			err:    "subnet subnet-x not found",
+		},
+		{
+			name:   "only candidate",
+			config: StackConfig{SubnetIDs: []string{"subnet-c"}},
+			subnet: "subnet-c",
+			reason: "only candidate subnet",
+		},
+		{
+			name:   "default strategy, ties broken by zone then id",
+			config: StackConfig{SubnetIDs: all},
+			subnet: "subnet-a",
+			reason: "az-order: first of 4 candidates by zone and id",
+		},
+		{
+			name:   "preferred zones",
+			config: StackConfig{SubnetIDs: all, SubnetStrategy: SUBNET_STRATEGY_AZ_ORDER, PreferredAZs: []string{"us-east-1x", "us-east-1c", "us-east-1a"}},
+			subnet: "subnet-d",
+			reason: "az-order: us-east-1c is the most preferred zone with a candidate, of 4 candidates",
+		},
+		{
+			name:   "most free ips",
+			config: StackConfig{SubnetIDs: all, SubnetStrategy: SUBNET_STRATEGY_MOST_FREE_IPS},
+			subnet: "subnet-d",
+			reason: "most-free-ips: most free IPs (200) of 4 candidates",
+		},
+		{
+			name:   "most free ips tie",
+			config: StackConfig{SubnetIDs: []string{"subnet-a", "subnet-b", "subnet-c"}, SubnetStrategy: SUBNET_STRATEGY_MOST_FREE_IPS},
+			subnet: "subnet-a",
+			reason: "most-free-ips: most free IPs (100) of 3 candidates",
+		},
+		{
+			name:        "round robin",
+			config:      StackConfig{SubnetIDs: all, SubnetStrategy: SUBNET_STRATEGY_ROUND_ROBIN},
+			stacksPerAZ: map[string]int{"us-east-1a": 2, "us-east-1b": 1, "us-east-1c": 1},
+			subnet:      "subnet-c",
+			reason:      "round-robin: us-east-1b has the fewest stacks (1) of 4 candidates",
+		},
+		{
+			name:        "round robin respects preferred zones on a tie",
+			config:      StackConfig{SubnetIDs: all, SubnetStrategy: SUBNET_STRATEGY_ROUND_ROBIN, PreferredAZs: []string{"us-east-1c"}},
+			stacksPerAZ: map[string]int{"us-east-1a": 2, "us-east-1b": 1, "us-east-1c": 1},
+			subnet:      "subnet-d",
+			reason:      "round-robin: us-east-1c has the fewest stacks (1) of 4 candidates",
+		},
+		{
+			name:   "tags",
+			config: StackConfig{SubnetTags: map[string]string{"orion:use": "true"}},
+			subnet: "subnet-c",
+			reason: "az-order: first of 2 candidates by zone and id",
+		},
+		{
+			name:   "no candidates",
+			config: StackConfig{SubnetTags: map[string]string{"orion:use": "maybe"}},
+			err:    "no subnets matching subnet_ids or subnet_tags found",
+		},
+		{
+			name:   "unknown strategy",
+			config: StackConfig{SubnetIDs: all, SubnetStrategy: "random"},
+			err:    `unknown subnet_strategy "random".  Expected one of az-order, most-free-ips, round-robin`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			selection, err := tc.config.SelectSubnet(testSubnets, tc.stacksPerAZ)
+			if tc.err != "" {
+				if assert.Error(t, err, "expected an error") {
+					assert.Equal(t, tc.err, err.Error(), "error doesn't meet expectations")
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.subnet, selection.Subnet.ID, "subnet doesn't meet expectations")
+			assert.Equal(t, tc.reason, selection.Reason, "reason doesn't meet expectations")
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+)
+
+// TEMPLATE_CACHE_FILE Cache of template descriptions in the user's home directory, so listing stacks needn't fetch the template every time.
+const TEMPLATE_CACHE_FILE = ".orion-ptt-system-template-cache.json"
+
+// TEMPLATE_CACHE_TTL How long a cached template description is used before it's fetched again.
+const TEMPLATE_CACHE_TTL = 24 * time.Hour
+
+// TemplateCache  Template descriptions, keyed by template location.
+type TemplateCache struct {
+	Entries map[string]TemplateCacheEntry `json:"entries"`
+}
+
+// TemplateCacheEntry  A cached template description, and when it was fetched.
+type TemplateCacheEntry struct {
+	Description string    `json:"description"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+// TemplateCachePath returns the path of the template cache in the user's home directory.
+func TemplateCachePath() (path string, err error) {
+	path, err = homedir.Expand(fmt.Sprintf("~/%s", TEMPLATE_CACHE_FILE))
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read home directory")
+		return path, err
+	}
+
+	return path, err
+}
+
+// ReadTemplateCache reads the template cache at path.  A missing or unreadable cache is simply empty.
+func ReadTemplateCache(path string) (cache *TemplateCache) {
+	cache = &TemplateCache{Entries: make(map[string]TemplateCacheEntry)}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	err = json.Unmarshal(content, cache)
+	if err != nil || cache.Entries == nil {
+		cache.Entries = make(map[string]TemplateCacheEntry)
+	}
+
+	return cache
+}
+
+// Write writes the template cache to path.
+func (c *TemplateCache) Write(path string) (err error) {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling template cache")
+		return err
+	}
+
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		err = errors.Wrapf(err, "failed writing %s", path)
+		return err
+	}
+
+	return err
+}
+
+// Lookup returns the cached description of the template at location, if there is one, and whether it's younger than ttl.
+func (c *TemplateCache) Lookup(location string, now time.Time, ttl time.Duration) (description string, fresh bool, ok bool) {
+	entry, ok := c.Entries[location]
+	if !ok {
+		return description, fresh, ok
+	}
+
+	description = entry.Description
+	fresh = now.Sub(entry.Fetched) < ttl
+
+	return description, fresh, ok
+}
+
+// Store caches the description of the template at location.
+func (c *TemplateCache) Store(location string, description string, now time.Time) {
+	c.Entries[location] = TemplateCacheEntry{
+		Description: description,
+		Fetched:     now,
+	}
+}
+
+// templateCacheMutex  Serialises use of the template cache, which stacks in several regions may want at once.
+var templateCacheMutex sync.Mutex
+
+// TemplateDescription returns the description of the stack's template.  A cached description is used for up to TEMPLATE_CACHE_TTL.  After that the template is fetched again, but if it can't be, e.g. because S3 is unreachable, the stale description is used.
+func (s *Stack) TemplateDescription() (description string, err error) {
+	templateCacheMutex.Lock()
+	defer templateCacheMutex.Unlock()
+
+	source, err := s.TemplateSource()
+	if err != nil {
+		return description, err
+	}
+
+	path, err := TemplateCachePath()
+	if err != nil {
+		return description, err
+	}
+
+	cache := ReadTemplateCache(path)
+	now := time.Now()
+
+	cached, fresh, ok := cache.Lookup(source.Location, now, TEMPLATE_CACHE_TTL)
+	if ok && fresh {
+		description = cached
+		return description, err
+	}
+
+	template, err := s.FetchTemplate()
+	if err != nil {
+		if ok {
+			log.Printf("Failed fetching template %s, using the cached description: %s\n", source.Location, err)
+			description = cached
+			err = nil
+			return description, err
+		}
+
+		err = errors.Wrapf(err, "failed fetching CF template")
+		return description, err
+	}
+
+	description = template.Description
+
+	cache.Store(source.Location, description, now)
+
+	// the cache is only an optimisation.
+	e := cache.Write(path)
+	if e != nil {
+		log.Printf("Failed caching template description: %s\n", e)
+	}
+
+	return description, err
+}
+
+// IsOpsStack returns true if ops created the stack: it carries the orion:managed-by=ops tag.  Stacks created before the tag was added are recognised by their description instead, if description is set.
+func IsOpsStack(stack *cloudformation.Stack, description string) bool {
+	for _, t := range stack.Tags {
+		if aws.StringValue(t.Key) == TAG_MANAGED_BY && aws.StringValue(t.Value) == MANAGED_BY_OPS {
+			return true
+		}
+	}
+
+	return description != "" && aws.StringValue(stack.Description) == description
+}
@@ -0,0 +1,92 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestTemplateCache(t *testing.T) {
+	path := fmt.Sprintf("%s/template-cache.json", tmpDir)
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	cache := ReadTemplateCache(path)
+	_, _, ok := cache.Lookup(DEFAULT_TEMPLATE_URL, now, TEMPLATE_CACHE_TTL)
+	assert.False(t, ok, "missing cache should be empty")
+
+	cache.Store(DEFAULT_TEMPLATE_URL, "Orion PTT System", now)
+
+	err := cache.Write(path)
+	if err != nil {
+		t.Errorf("failed writing cache: %s", err)
+	}
+
+	cache = ReadTemplateCache(path)
+
+	description, fresh, ok := cache.Lookup(DEFAULT_TEMPLATE_URL, now.Add(time.Hour), TEMPLATE_CACHE_TTL)
+	assert.True(t, ok, "entry should be cached")
+	assert.True(t, fresh, "entry should be fresh within the ttl")
+	assert.Equal(t, "Orion PTT System", description, "description doesn't meet expectations")
+
+	description, fresh, ok = cache.Lookup(DEFAULT_TEMPLATE_URL, now.Add(TEMPLATE_CACHE_TTL), TEMPLATE_CACHE_TTL)
+	assert.True(t, ok, "stale entry should still be returned")
+	assert.False(t, fresh, "entry should be stale after the ttl")
+	assert.Equal(t, "Orion PTT System", description, "stale description doesn't meet expectations")
+
+	err = ioutil.WriteFile(path, []byte("not json"), 0644)
+	if err != nil {
+		t.Errorf("failed writing cache: %s", err)
+	}
+
+	assert.Equal(t, 0, len(ReadTemplateCache(path).Entries), "corrupt cache should be empty")
+}
+
+func TestIsOpsStack(t *testing.T) {
+	cases := []struct {
+		name        string
+		stack       cloudformation.Stack
+		description string
+		ops         bool
+	}{
+		{
+			"tagged",
+			cloudformation.Stack{Tags: []*cloudformation.Tag{{Key: aws.String(TAG_MANAGED_BY), Value: aws.String(MANAGED_BY_OPS)}}},
+			"",
+			true,
+		},
+		{
+			"tagged by something else",
+			cloudformation.Stack{Tags: []*cloudformation.Tag{{Key: aws.String(TAG_MANAGED_BY), Value: aws.String("terraform")}}},
+			"",
+			false,
+		},
+		{
+			"matching description",
+			cloudformation.Stack{Description: aws.String("Orion PTT System")},
+			"Orion PTT System",
+			true,
+		},
+		{
+			"other description",
+			cloudformation.Stack{Description: aws.String("Something else")},
+			"Orion PTT System",
+			false,
+		},
+		{
+			"no description to match",
+			cloudformation.Stack{},
+			"",
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.ops, IsOpsStack(&tc.stack, tc.description), "result doesn't meet expectations")
+		})
+	}
+}
@@ -67,78 +67,136 @@ func RetryUntil(thing func() (err error), timeoutMinutes int) (elapsed time.Dura
 
 // CreateConfig Creates an orion-ptt-system kots config file from a local template.  The template itself is not distributed with this package to avoid leaking sensitive information.  To get one, you'll have to purchase an Orion PTT System license.
 func (s *Stack) CreateConfig() (content string, err error) {
+	keystore, err := GenerateKeystore()
+	if err != nil {
+		return content, err
+	}
+
+	content, err = s.RenderConfig(keystore)
+
+	return content, err
+}
+
+// PreviewConfig renders the kots config, with a freshly generated keystore, like CreateConfig, but writes nothing to disk.  For checking the template.
+func (s *Stack) PreviewConfig() (content string, err error) {
+	keystore, err := GenerateKeystore()
+	if err != nil {
+		return content, err
+	}
+
+	tmplBytes, _, err := s.FetchConfigTemplate()
+	if err != nil {
+		return content, err
+	}
+
+	content, err = s.RenderConfigTemplate(tmplBytes, keystore)
+
+	return content, err
+}
+
+// GenerateKeystore generates a JWK keystore for a new stack, and registers it for redaction.
+func GenerateKeystore() (keystore string, err error) {
 	keyset, err := genkeyset.GenerateKeySet(3)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to generate keyset")
-		return content, err
+		return keystore, err
 	}
 
 	jsonbuf, err := json.Marshal(keyset)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to marshall JWK KeySet into json")
-		return content, err
+		return keystore, err
 	}
 
-	h, err := homedir.Dir()
+	keystore = string(jsonbuf)
+
+	RegisterSecret(keystore)
+
+	return keystore, err
+}
+
+// RenderConfig renders the kots config template with the supplied JWK keystore.  Used directly when re-rendering the config of a running stack, where the original keystore has to be preserved so existing tokens stay valid.  A template fetched from S3 or git is saved in the default location.
+func (s *Stack) RenderConfig(keystore string) (content string, err error) {
+	tmplBytes, remote, err := s.FetchConfigTemplate()
 	if err != nil {
-		err = errors.Wrapf(err, "failed to detect homedir")
 		return content, err
 	}
 
+	if remote {
+		h, err := homedir.Dir()
+		if err != nil {
+			err = errors.Wrapf(err, "failed to detect homedir")
+			return content, err
+		}
+
+		defaultPath := fmt.Sprintf("%s/%s", h, DEFAULT_TEMPLATE_FILE)
+
+		err = ioutil.WriteFile(defaultPath, tmplBytes, 0644)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to write file to %s", defaultPath)
+			return content, err
+		}
+	}
+
+	content, err = s.RenderConfigTemplate(tmplBytes, keystore)
+
+	return content, err
+}
+
+// FetchConfigTemplate reads the kots config template into memory, from S3, git, or a local file.  remote is true if it came from S3 or git.
+func (s *Stack) FetchConfigTemplate() (tmplBytes []byte, remote bool, err error) {
 	templatePath := s.Config.ConfigTemplate
-	defaultPath := fmt.Sprintf("%s/%s", h, DEFAULT_TEMPLATE_FILE)
 
 	isS3, s3Meta := S3Url(templatePath)
 
-	// Look at the templatePath.  If it's an s3 url, fetch it, and stick it in the default location
 	if isS3 {
 		fmt.Printf("Fetching config template from S3.\n")
-		err = FetchFileS3(s3Meta, defaultPath)
+		tmplBytes, err = FetchS3(s3Meta)
 		if err != nil {
 			err = errors.Wrapf(err, "failed to fetch template from %s", templatePath)
-			return content, err
+			return tmplBytes, remote, err
 		}
 
-		templatePath = defaultPath
-	} else if isGit(templatePath) {
+		remote = true
+		return tmplBytes, remote, err
+	}
+
+	if isGit(templatePath) {
 		repo, path := SplitRepoPath(templatePath)
 		fmt.Printf("pulling templates from git.  Repo: %s Path: %s\n", repo, path)
-		gitContent, err := GitContent(repo, path)
+		tmplBytes, err = GitContent(repo, path)
 		if err != nil {
 			err = errors.Wrapf(err, "error cloning %s", repo)
-			return content, err
+			return tmplBytes, remote, err
 		}
 
-		err = ioutil.WriteFile(defaultPath, gitContent, 0644)
-		if err != nil {
-			err = errors.Wrapf(err, "failed to write file to %s", defaultPath)
-			return content, err
-		}
-
-		templatePath = defaultPath
-
-	} else {
-		fmt.Printf("Using local config template file %s.\n", templatePath)
+		remote = true
+		return tmplBytes, remote, err
 	}
 
-	// read template from local file, which might have been written by us, or might have been placed there manually .  Either way we don't really care.  It's just a file at this point.
-	tmplBytes, err := ioutil.ReadFile(templatePath)
+	fmt.Printf("Using local config template file %s.\n", templatePath)
+
+	tmplBytes, err = ioutil.ReadFile(templatePath)
 	if err != nil {
 		err = errors.Wrapf(err, "failed reading template file %q", templatePath)
-		return content, err
+		return tmplBytes, remote, err
 	}
 
+	return tmplBytes, remote, err
+}
+
+// RenderConfigTemplate executes the kots config template with the stack's name, domain, and the supplied JWK keystore.
+func (s *Stack) RenderConfigTemplate(tmplBytes []byte, keystore string) (content string, err error) {
 	tmpl, err := template.New("stack config").Parse(string(tmplBytes))
 	if err != nil {
 		err = errors.Wrapf(err, "failed to create template")
+		return content, err
 	}
 
-	contentBytes := make([]byte, 0)
-
-	buf := bytes.NewBuffer(contentBytes)
+	buf := &bytes.Buffer{}
 
 	data := OnpremConfig{
-		Keystore:  string(jsonbuf),
+		Keystore:  keystore,
 		StackName: s.Config.StackName,
 		Domain:    s.Config.DNSDomain,
 	}
@@ -154,6 +212,30 @@ func (s *Stack) CreateConfig() (content string, err error) {
 	return content, err
 }
 
+// FetchS3 fetches an object from s3 into memory.
+func FetchS3(s3Meta S3Meta) (content []byte, err error) {
+	awsSession, err := DefaultSession()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create s3 session")
+		return content, err
+	}
+
+	buf := aws.NewWriteAtBuffer([]byte{})
+
+	_, err = s3manager.NewDownloader(awsSession).Download(buf, &s3.GetObjectInput{
+		Bucket: aws.String(s3Meta.Bucket),
+		Key:    aws.String(s3Meta.Key),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "download failed")
+		return content, err
+	}
+
+	content = buf.Bytes()
+
+	return content, err
+}
+
 // FetchFileS3 fetches the config template from an s3 url.
 func FetchFileS3(s3Meta S3Meta, filePath string) (err error) {
 	awsSession, err := DefaultSession()
@@ -3,6 +3,10 @@ package ops
 import (
 	"fmt"
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -34,3 +38,40 @@ func TestRetryUntil(t *testing.T) {
 		})
 	}
 }
+
+func TestPreviewConfig(t *testing.T) {
+	clearSecrets(t)
+
+	dir, err := ioutil.TempDir("", "ops-preview")
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	templatePath := filepath.Join(dir, "config.tmpl")
+
+	err = ioutil.WriteFile(templatePath, []byte("spec:\n  values:\n    atlas_hostname:\n      value: login-{{.StackName}}.{{.Domain}}\n    session_keystore:\n      value: '{{.Keystore}}'\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed writing %s: %s", templatePath, err)
+	}
+
+	s := &Stack{Config: &StackConfig{StackName: "opstest", DNSDomain: "example.com", ConfigTemplate: templatePath}}
+
+	content, err := s.PreviewConfig()
+	assert.NoError(t, err)
+	assert.Contains(t, content, "value: login-opstest.example.com", "rendered config doesn't meet expectations")
+
+	keystore, err := ConfigKeystore(content)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, keystore, "keystore not rendered")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files), "previewing shouldn't write anything")
+
+	s.Config.ConfigTemplate = filepath.Join(dir, "missing.tmpl")
+
+	_, err = s.PreviewConfig()
+	assert.Error(t, err, "expected an error for a missing template")
+}
@@ -0,0 +1,286 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CheckResult  The outcome of a single check of the config or the environment.
+type CheckResult struct {
+	Name    string
+	Passed  bool
+	Warning bool // passed, but with a problem worth knowing about
+	Detail  string
+}
+
+// Check  A named check.  Returns some detail on success, or an error describing the failure.
+type Check struct {
+	Name string
+	Run  func() (detail string, err error)
+}
+
+// CheckWarning  Returned by a check that couldn't fully verify something, but shouldn't fail because of it.
+type CheckWarning struct {
+	Detail string
+}
+
+func (w *CheckWarning) Error() string {
+	return w.Detail
+}
+
+// RunChecks runs every check, regardless of earlier failures, so that all problems are reported at once.
+func RunChecks(checks []Check) (results []CheckResult) {
+	results = make([]CheckResult, 0)
+
+	for _, c := range checks {
+		detail, err := c.Run()
+		result := CheckResult{
+			Name:   c.Name,
+			Passed: err == nil,
+			Detail: detail,
+		}
+
+		if err != nil {
+			result.Detail = err.Error()
+
+			var warning *CheckWarning
+			if errors.As(err, &warning) {
+				result.Passed = true
+				result.Warning = true
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// ChecksPassed returns true if every result passed.
+func ChecksPassed(results []CheckResult) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ChecksWarned returns true if any result passed with a warning.
+func ChecksWarned(results []CheckResult) bool {
+	for _, r := range results {
+		if r.Warning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PrintCheckResults prints a pass/fail report.
+func PrintCheckResults(results []CheckResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		status := "PASS"
+		if r.Warning {
+			status = "WARN"
+		}
+
+		if !r.Passed {
+			status = "FAIL"
+		}
+
+		_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\n", status, r.Name, Redact(r.Detail))
+	}
+
+	_ = w.Flush()
+}
+
+// ValidateConfig checks every config field against the AWS account, and the local filesystem.  Nothing is created.
+func (s *Stack) ValidateConfig() (results []CheckResult) {
+	checks := []Check{
+		{
+			Name: "required fields",
+			Run: func() (detail string, err error) {
+				missing := s.Config.MissingFields()
+				if len(missing) > 0 {
+					err = errors.New(fmt.Sprintf("missing %s", strings.Join(missing, ", ")))
+					return detail, err
+				}
+
+				detail = "all set"
+				return detail, err
+			},
+		},
+		{
+			Name: "key pair",
+			Run: func() (detail string, err error) {
+				err = s.CheckKeyPair()
+				detail = s.Config.KeyName
+				return detail, err
+			},
+		},
+		{
+			Name: "instance type",
+			Run: func() (detail string, err error) {
+				err = s.CheckInstanceType()
+				detail = s.Config.InstanceType
+				return detail, err
+			},
+		},
+		{
+			Name: "dns zone",
+			Run: func() (detail string, err error) {
+				id, err := s.LookupZoneID()
+				detail = fmt.Sprintf("%s -> %s", s.Config.DNSDomain, id)
+				return detail, err
+			},
+		},
+		{
+			Name: "ami",
+			Run:  s.CheckAmi,
+		},
+		{
+			Name: "network",
+			Run: func() (detail string, err error) {
+				err = ValidateNetworkMode(s.Config.NetworkMode)
+				if err != nil {
+					return detail, err
+				}
+
+				if s.Config.NetworkMode == NETWORK_MODE_CREATE {
+					existing, err := s.ExistingVpcCidrs()
+					if err != nil {
+						return detail, err
+					}
+
+					cidr, err := ChooseVpcCidr(existing)
+					detail = fmt.Sprintf("will create a VPC in %s", cidr)
+					return detail, err
+				}
+
+				vpcID, subnetID, err := s.LookupNetwork()
+				detail = fmt.Sprintf("%s in %s", subnetID, vpcID)
+				return detail, err
+			},
+		},
+		{
+			Name: "license",
+			Run: func() (detail string, err error) {
+				license, err := LoadLicense(s.Config.LicenseFile)
+				if err != nil {
+					return detail, err
+				}
+
+				err = license.Validate(KOTS_APP_SLUG, time.Now())
+				detail = fmt.Sprintf("%s (%s)", license.Spec.LicenseID, license.Spec.ChannelName)
+				return detail, err
+			},
+		},
+		{
+			Name: "config template",
+			Run: func() (detail string, err error) {
+				content, err := s.PreviewConfig()
+				if err != nil {
+					return detail, err
+				}
+
+				_, err = ConfigKeystore(content)
+				detail = s.Config.ConfigTemplate
+				return detail, err
+			},
+		},
+	}
+
+	results = RunChecks(checks)
+
+	return results
+}
+
+// MissingFields lists the config keys that must be set to create a stack, but aren't.
+func (c *StackConfig) MissingFields() (missing []string) {
+	missing = make([]string, 0)
+
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"stack_name", c.StackName},
+		{"key_name", c.KeyName},
+		{"dns_domain", c.DNSDomain},
+		{"instance_type", c.InstanceType},
+		{"user_name", c.Username},
+		{"license_file", c.LicenseFile},
+		{"config_template", c.ConfigTemplate},
+		{"kotsadm_password", c.KotsadmPassword},
+	}
+
+	for _, r := range required {
+		if r.value == "" {
+			missing = append(missing, r.name)
+		}
+	}
+
+	if c.AMIName == "" && c.AMIID == "" {
+		missing = append(missing, "ami_name")
+	}
+
+	// a dedicated VPC needs no subnets configured.
+	if c.NetworkMode != NETWORK_MODE_CREATE && len(c.SubnetIDs) == 0 && len(c.SubnetTags) == 0 && c.SubnetID == "" {
+		missing = append(missing, "subnet_ids")
+	}
+
+	return missing
+}
+
+// CheckKeyPair checks that the configured EC2 key pair exists in the stack's region.
+func (s *Stack) CheckKeyPair() (err error) {
+	if s.Config.KeyName == "" {
+		err = errors.New("no key name configured")
+		return err
+	}
+
+	client := ec2.New(s.AwsSession)
+
+	_, err = client.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{
+		KeyNames: []*string{aws.String(s.Config.KeyName)},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "key pair %q not found", s.Config.KeyName)
+		return err
+	}
+
+	return err
+}
+
+// CheckInstanceType checks that the configured instance type is offered in the stack's region.
+func (s *Stack) CheckInstanceType() (err error) {
+	client := ec2.New(s.AwsSession)
+
+	output, err := client.DescribeInstanceTypeOfferings(&ec2.DescribeInstanceTypeOfferingsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-type"),
+				Values: []*string{aws.String(s.Config.InstanceType)},
+			},
+		},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing instance type offerings")
+		return err
+	}
+
+	if len(output.InstanceTypeOfferings) == 0 {
+		err = errors.New(fmt.Sprintf("instance type %q is not offered in %s", s.Config.InstanceType, aws.StringValue(s.AwsSession.Config.Region)))
+		return err
+	}
+
+	return err
+}
@@ -0,0 +1,66 @@
+package ops
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRunChecks(t *testing.T) {
+	ran := 0
+
+	checks := []Check{
+		{
+			Name: "fails",
+			Run: func() (detail string, err error) {
+				ran++
+				err = errors.New("broken")
+				return detail, err
+			},
+		},
+		{
+			Name: "passes",
+			Run: func() (detail string, err error) {
+				ran++
+				detail = "fine"
+				return detail, err
+			},
+		},
+		{
+			Name: "warns",
+			Run: func() (detail string, err error) {
+				ran++
+				err = &CheckWarning{Detail: "couldn't tell"}
+				return detail, err
+			},
+		},
+	}
+
+	results := RunChecks(checks)
+
+	assert.Equal(t, 3, ran, "every check should run, even after a failure")
+	assert.Equal(t, []CheckResult{
+		{Name: "fails", Passed: false, Detail: "broken"},
+		{Name: "passes", Passed: true, Detail: "fine"},
+		{Name: "warns", Passed: true, Warning: true, Detail: "couldn't tell"},
+	}, results, "results don't meet expectations")
+	assert.False(t, ChecksPassed(results), "a failed check should fail the run")
+	assert.True(t, ChecksPassed(results[1:]), "passing checks, and warnings, should pass the run")
+	assert.True(t, ChecksWarned(results), "a warning should be reported")
+	assert.False(t, ChecksWarned(results[:2]), "no warnings, nothing to report")
+}
+
+func TestMissingFields(t *testing.T) {
+	config := StackConfig{
+		StackName:       "opstest",
+		KeyName:         "Nik",
+		DNSDomain:       "example.com",
+		InstanceType:    DEFAULT_INSTANCE_TYPE,
+		Username:        "ops",
+		ConfigTemplate:  "template.tmpl",
+		KotsadmPassword: "password",
+		AMIName:         "orion-base*",
+	}
+
+	assert.Equal(t, []string{"license_file", "subnet_ids"}, config.MissingFields(), "missing fields don't meet expectations")
+}
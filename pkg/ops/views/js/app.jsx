@@ -71,7 +71,7 @@ class LoggedIn extends React.Component {
                     <div className="container">
                         {this.state.stacks.map(function(stack, i) {
                             return <Stack
-                                key={`stack-${stack.name}`}
+                                key={`stack-${stack.alias}-${stack.region}-${stack.name}`}
                                 stack={stack}
                             />;
                         })}
@@ -86,13 +86,13 @@ class Stack extends React.Component {
     constructor(props) {
         super(props);
         this.state = {
-            stack: {name: '', created: '', address: '', account: '', cfstatus: '', kotsadm: '', login: '', api: '', ca: ''},
+            stack: {name: '', created: '', address: '', account: '', alias: '', region: '', cfstatus: '', kotsadm: '', login: '', api: '', ca: ''},
         };
     }
 
-    destroyStack = (account, name) => {
+    destroyStack = (alias, region, name) => {
         if (window.confirm("Destroy Stack " + name + "?")){
-            fetch(window.location.href + `api/stacks/${account}/${name}`, {method: 'DELETE'})
+            fetch(window.location.href + `api/stacks/${alias}/${name}?region=${region}`, {method: 'DELETE'})
         }
     }
 
@@ -103,8 +103,9 @@ class Stack extends React.Component {
 
     getStackDetails = () => {
         const { name } = this.props.stack
-        const { account } = this.props.stack
-        fetch(window.location.href + `api/stacks/${account}/${name}`
+        const { alias } = this.props.stack
+        const { region } = this.props.stack
+        fetch(window.location.href + `api/stacks/${alias}/${name}?region=${region}`
         )
         .then( res => res.json())
         .then( jsonResults => {
@@ -123,15 +124,16 @@ class Stack extends React.Component {
                         Created: {this.state.stack.created}<br/>
                         Uptime: {this.state.stack.uptime}<br/>
                         Address: {this.state.stack.address}<br/>
-                        Account: {this.state.stack.account}<br/>
+                        Account: {this.state.stack.alias} ({this.state.stack.account})<br/>
+                        Region: {this.state.stack.region}<br/>
                         CloudFormation: {this.state.stack.cfstatus}<br/>
                         Kotsadm: <a href={this.state.stack.kotsadm}>{this.state.stack.kotsadm}</a> <br/>
                         Login: <a href={this.state.stack.login}>{this.state.stack.login}</a><br/>
                         API: <a href={this.state.stack.api}>{this.state.stack.api}</a><br/>
-                        CA: <a download={`CA-${this.state.stack.name}.pem`} href={window.location.href + `api/stacks/${this.state.stack.name}/ca`}>{this.state.stack.ca}</a><br/>
+                        CA: <a download={`CA-${this.state.stack.name}.pem`} href={window.location.href + `api/stacks/${this.state.stack.alias}/${this.state.stack.name}/ca?region=${this.state.stack.region}`}>{this.state.stack.ca}</a><br/>
                     </div>
                     <div className="panel-footer">
-                        <button type="button" class="btn btn-dark" onClick={() => {this.destroyStack(this.state.stack.account, this.state.stack.name)}}> Destroy </button>
+                        <button type="button" class="btn btn-dark" onClick={() => {this.destroyStack(this.state.stack.alias, this.state.stack.region, this.state.stack.name)}}> Destroy </button>
                     </div>
                 </div>
             </div>
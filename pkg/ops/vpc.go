@@ -0,0 +1,543 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"log"
+	"net"
+)
+
+// NETWORK_MODE_EXISTING Create the stack in one of the account's existing subnets.  See SelectSubnet.
+const NETWORK_MODE_EXISTING = "existing"
+
+// NETWORK_MODE_CREATE Create a dedicated VPC for the stack, and remove it when the stack is destroyed.
+const NETWORK_MODE_CREATE = "create"
+
+// DEFAULT_NETWORK_MODE Network mode used when network_mode isn't set.
+const DEFAULT_NETWORK_MODE = NETWORK_MODE_EXISTING
+
+// TAG_STACK Tag naming the stack a resource ops created belongs to.
+const TAG_STACK = "orion:stack"
+
+// TAG_MANAGED_BY Tag marking resources ops created, and so may delete.
+const TAG_MANAGED_BY = "orion:managed-by"
+
+// MANAGED_BY_OPS Value of TAG_MANAGED_BY on resources ops created.
+const MANAGED_BY_OPS = "ops"
+
+// VPC_PREFIX_LENGTH Prefix length of dedicated VPCs.
+const VPC_PREFIX_LENGTH = 16
+
+// SUBNET_PREFIX_LENGTH Prefix length of the public subnet in a dedicated VPC.
+const SUBNET_PREFIX_LENGTH = 24
+
+// networkModes  Every known network mode.
+var networkModes = []string{NETWORK_MODE_EXISTING, NETWORK_MODE_CREATE}
+
+// VpcCidrCandidates returns every /16 a dedicated VPC may use, in order of preference: 10.0.0.0/16 to 10.255.0.0/16, then 172.16.0.0/16 to 172.31.0.0/16, then 192.168.0.0/16.
+func VpcCidrCandidates() (cidrs []string) {
+	cidrs = make([]string, 0)
+
+	for i := 0; i < 256; i++ {
+		cidrs = append(cidrs, fmt.Sprintf("10.%d.0.0/%d", i, VPC_PREFIX_LENGTH))
+	}
+
+	for i := 16; i < 32; i++ {
+		cidrs = append(cidrs, fmt.Sprintf("172.%d.0.0/%d", i, VPC_PREFIX_LENGTH))
+	}
+
+	cidrs = append(cidrs, fmt.Sprintf("192.168.0.0/%d", VPC_PREFIX_LENGTH))
+
+	return cidrs
+}
+
+// CidrsOverlap returns true if the two networks share any address.
+func CidrsOverlap(a *net.IPNet, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// ChooseVpcCidr returns the first candidate CIDR that overlaps none of existing, so a dedicated VPC can later be peered with any of the account's VPCs.
+func ChooseVpcCidr(existing []string) (cidr string, err error) {
+	networks := make([]*net.IPNet, 0)
+
+	for _, e := range existing {
+		_, network, err := net.ParseCIDR(e)
+		if err != nil {
+			err = errors.Wrapf(err, "bad CIDR %q", e)
+			return cidr, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	for _, candidate := range VpcCidrCandidates() {
+		_, network, _ := net.ParseCIDR(candidate)
+
+		free := true
+		for _, n := range networks {
+			if CidrsOverlap(network, n) {
+				free = false
+				break
+			}
+		}
+
+		if free {
+			cidr = candidate
+			return cidr, err
+		}
+	}
+
+	err = errors.New("every private /16 overlaps an existing VPC")
+
+	return cidr, err
+}
+
+// SubnetCidr returns the CIDR of the public subnet in a dedicated VPC: the first /24 of it.
+func SubnetCidr(vpcCidr string) (cidr string, err error) {
+	ip, _, err := net.ParseCIDR(vpcCidr)
+	if err != nil {
+		err = errors.Wrapf(err, "bad CIDR %q", vpcCidr)
+		return cidr, err
+	}
+
+	cidr = fmt.Sprintf("%s/%d", ip.String(), SUBNET_PREFIX_LENGTH)
+
+	return cidr, err
+}
+
+// ValidateNetworkMode checks the network mode is known.
+func ValidateNetworkMode(mode string) (err error) {
+	if mode != "" && !StringInSlice(mode, networkModes) {
+		err = errors.New(fmt.Sprintf("unknown network_mode %q.  Expected %s or %s", mode, NETWORK_MODE_EXISTING, NETWORK_MODE_CREATE))
+		return err
+	}
+
+	return err
+}
+
+// Network returns the VPC and subnet the stack is created in.  In create mode the dedicated VPC is created if it doesn't exist yet.  Otherwise an existing subnet is chosen.
+func (s *Stack) Network() (vpcID string, subnetID string, err error) {
+	err = ValidateNetworkMode(s.Config.NetworkMode)
+	if err != nil {
+		return vpcID, subnetID, err
+	}
+
+	if s.Config.NetworkMode == NETWORK_MODE_CREATE {
+		vpcID, subnetID, err = s.CreateStackVpc()
+		return vpcID, subnetID, err
+	}
+
+	vpcID, subnetID, err = s.LookupNetwork()
+
+	return vpcID, subnetID, err
+}
+
+// stackTags returns the tags put on everything ops creates for the stack.
+func (s *Stack) stackTags(resourceType string) (specs []*ec2.TagSpecification) {
+	specs = []*ec2.TagSpecification{
+		{
+			ResourceType: aws.String(resourceType),
+			Tags: []*ec2.Tag{
+				{Key: aws.String("Name"), Value: aws.String(s.Config.StackName)},
+				{Key: aws.String(TAG_STACK), Value: aws.String(s.Config.StackName)},
+				{Key: aws.String(TAG_MANAGED_BY), Value: aws.String(MANAGED_BY_OPS)},
+			},
+		},
+	}
+
+	return specs
+}
+
+// stackFilters returns filters matching resources ops created for the stack.
+func (s *Stack) stackFilters() (filters []*ec2.Filter) {
+	filters = []*ec2.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", TAG_STACK)),
+			Values: []*string{aws.String(s.Config.StackName)},
+		},
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", TAG_MANAGED_BY)),
+			Values: []*string{aws.String(MANAGED_BY_OPS)},
+		},
+	}
+
+	return filters
+}
+
+// ExistingVpcCidrs lists the CIDR blocks of every VPC in the region.
+func (s *Stack) ExistingVpcCidrs() (cidrs []string, err error) {
+	cidrs = make([]string, 0)
+
+	client := ec2.New(s.AwsSession)
+
+	err = client.DescribeVpcsPages(&ec2.DescribeVpcsInput{}, func(page *ec2.DescribeVpcsOutput, lastPage bool) bool {
+		for _, v := range page.Vpcs {
+			for _, a := range v.CidrBlockAssociationSet {
+				cidrs = append(cidrs, aws.StringValue(a.CidrBlock))
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing VPCs")
+		return cidrs, err
+	}
+
+	return cidrs, err
+}
+
+// StackVpc returns the dedicated VPC and subnet ops created for the stack, if there is one.
+func (s *Stack) StackVpc() (vpcID string, subnetID string, err error) {
+	client := ec2.New(s.AwsSession)
+
+	vpcs, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: s.stackFilters()})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing VPCs for %s", s.Config.StackName)
+		return vpcID, subnetID, err
+	}
+
+	if len(vpcs.Vpcs) == 0 {
+		return vpcID, subnetID, err
+	}
+
+	vpcID = aws.StringValue(vpcs.Vpcs[0].VpcId)
+
+	subnets, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: append(s.stackFilters(), &ec2.Filter{
+			Name:   aws.String("vpc-id"),
+			Values: []*string{aws.String(vpcID)},
+		}),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing subnets of %s", vpcID)
+		return vpcID, subnetID, err
+	}
+
+	if len(subnets.Subnets) > 0 {
+		subnetID = aws.StringValue(subnets.Subnets[0].SubnetId)
+	}
+
+	return vpcID, subnetID, err
+}
+
+// CreateStackVpc creates a dedicated VPC for the stack, with an internet gateway, and a single public subnet routed through it.  The CIDR is chosen to overlap none of the region's other VPCs.  If the stack already has a VPC, e.g. from an earlier failed attempt, it's reused.  A VPC it really created is remembered, see CreatedVpcID.
+func (s *Stack) CreateStackVpc() (vpcID string, subnetID string, err error) {
+	vpcID, subnetID, err = s.StackVpc()
+	if err != nil {
+		return vpcID, subnetID, err
+	}
+
+	if vpcID != "" && subnetID != "" {
+		fmt.Printf("Using existing VPC %s, subnet %s for stack %s.\n", vpcID, subnetID, s.Config.StackName)
+		return vpcID, subnetID, err
+	}
+
+	if vpcID != "" {
+		// left half built.  Start again.
+		err = s.DeleteStackVpc()
+		if err != nil {
+			return vpcID, subnetID, err
+		}
+	}
+
+	existing, err := s.ExistingVpcCidrs()
+	if err != nil {
+		return vpcID, subnetID, err
+	}
+
+	vpcCidr, err := ChooseVpcCidr(existing)
+	if err != nil {
+		return vpcID, subnetID, err
+	}
+
+	subnetCidr, err := SubnetCidr(vpcCidr)
+	if err != nil {
+		return vpcID, subnetID, err
+	}
+
+	fmt.Printf("Creating VPC %s for stack %s.\n", vpcCidr, s.Config.StackName)
+
+	client := ec2.New(s.AwsSession)
+
+	vpc, err := client.CreateVpc(&ec2.CreateVpcInput{
+		CidrBlock:         aws.String(vpcCidr),
+		TagSpecifications: s.stackTags(ec2.ResourceTypeVpc),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating VPC %s", vpcCidr)
+		return vpcID, subnetID, err
+	}
+
+	vpcID = aws.StringValue(vpc.Vpc.VpcId)
+
+	subnetID, err = s.buildStackVpc(client, vpcID, subnetCidr)
+	if err != nil {
+		// don't leave a half built VPC behind.
+		e := s.DeleteVpc(vpcID)
+		if e != nil {
+			log.Printf("failed removing partially created VPC %s: %s\nYou may have to do it manually.\n", vpcID, e)
+		}
+
+		return vpcID, subnetID, err
+	}
+
+	fmt.Printf("Created VPC %s, subnet %s (%s).\n", vpcID, subnetID, subnetCidr)
+
+	s.createdVpcID = vpcID
+
+	return vpcID, subnetID, err
+}
+
+// buildStackVpc fills in a newly created VPC: DNS, an internet gateway, a public subnet, and its default route.
+func (s *Stack) buildStackVpc(client *ec2.EC2, vpcID string, subnetCidr string) (subnetID string, err error) {
+	err = client.WaitUntilVpcAvailable(&ec2.DescribeVpcsInput{VpcIds: []*string{aws.String(vpcID)}})
+	if err != nil {
+		err = errors.Wrapf(err, "failed waiting for VPC %s", vpcID)
+		return subnetID, err
+	}
+
+	_, err = client.ModifyVpcAttribute(&ec2.ModifyVpcAttributeInput{
+		VpcId:              aws.String(vpcID),
+		EnableDnsHostnames: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed enabling DNS hostnames in %s", vpcID)
+		return subnetID, err
+	}
+
+	igw, err := client.CreateInternetGateway(&ec2.CreateInternetGatewayInput{
+		TagSpecifications: s.stackTags(ec2.ResourceTypeInternetGateway),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating internet gateway")
+		return subnetID, err
+	}
+
+	igwID := igw.InternetGateway.InternetGatewayId
+
+	_, err = client.AttachInternetGateway(&ec2.AttachInternetGatewayInput{
+		InternetGatewayId: igwID,
+		VpcId:             aws.String(vpcID),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed attaching internet gateway %s", aws.StringValue(igwID))
+
+		// DeleteVpc only finds gateways attached to the VPC, so this one's removed here.
+		_, e := client.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: igwID})
+		if e != nil {
+			log.Printf("failed removing internet gateway %s: %s\nYou may have to do it manually.\n", aws.StringValue(igwID), e)
+		}
+
+		return subnetID, err
+	}
+
+	subnetInput := &ec2.CreateSubnetInput{
+		VpcId:             aws.String(vpcID),
+		CidrBlock:         aws.String(subnetCidr),
+		TagSpecifications: s.stackTags(ec2.ResourceTypeSubnet),
+	}
+
+	if len(s.Config.PreferredAZs) > 0 {
+		subnetInput.AvailabilityZone = aws.String(s.Config.PreferredAZs[0])
+	}
+
+	subnet, err := client.CreateSubnet(subnetInput)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating subnet %s", subnetCidr)
+		return subnetID, err
+	}
+
+	subnetID = aws.StringValue(subnet.Subnet.SubnetId)
+
+	_, err = client.ModifySubnetAttribute(&ec2.ModifySubnetAttributeInput{
+		SubnetId:            aws.String(subnetID),
+		MapPublicIpOnLaunch: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed enabling public IPs in %s", subnetID)
+		return subnetID, err
+	}
+
+	routeTable, err := client.CreateRouteTable(&ec2.CreateRouteTableInput{
+		VpcId:             aws.String(vpcID),
+		TagSpecifications: s.stackTags(ec2.ResourceTypeRouteTable),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating route table")
+		return subnetID, err
+	}
+
+	routeTableID := routeTable.RouteTable.RouteTableId
+
+	_, err = client.CreateRoute(&ec2.CreateRouteInput{
+		RouteTableId:         routeTableID,
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		GatewayId:            igwID,
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating default route")
+		return subnetID, err
+	}
+
+	_, err = client.AssociateRouteTable(&ec2.AssociateRouteTableInput{
+		RouteTableId: routeTableID,
+		SubnetId:     aws.String(subnetID),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed associating route table with %s", subnetID)
+		return subnetID, err
+	}
+
+	return subnetID, err
+}
+
+// DeleteStackVpc removes the dedicated VPC ops created for the stack, and everything in it ops created, along with any internet gateway of the stack's that was left detached.  Does nothing if the stack has none.  Only call it once the stack itself is gone.
+func (s *Stack) DeleteStackVpc() (err error) {
+	client := ec2.New(s.AwsSession)
+
+	vpcs, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: s.stackFilters()})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing VPCs for %s", s.Config.StackName)
+		return err
+	}
+
+	for _, v := range vpcs.Vpcs {
+		err = s.DeleteVpc(aws.StringValue(v.VpcId))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.DeleteDetachedGateways()
+
+	return err
+}
+
+// DeleteDetachedGateways removes internet gateways ops created for the stack, but never got to attach, e.g. because it was interrupted.  DeleteVpc can't find them.
+func (s *Stack) DeleteDetachedGateways() (err error) {
+	client := ec2.New(s.AwsSession)
+
+	igws, err := client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{Filters: s.stackFilters()})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing internet gateways for %s", s.Config.StackName)
+		return err
+	}
+
+	for _, igw := range igws.InternetGateways {
+		if len(igw.Attachments) > 0 {
+			continue
+		}
+
+		fmt.Printf("Deleting detached internet gateway %s.\n", aws.StringValue(igw.InternetGatewayId))
+
+		_, err = client.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: igw.InternetGatewayId})
+		if err != nil {
+			err = errors.Wrapf(err, "failed deleting internet gateway %s", aws.StringValue(igw.InternetGatewayId))
+			return err
+		}
+	}
+
+	return err
+}
+
+// CreatedVpcID returns the id of the VPC CreateStackVpc created for the stack, if it created one.  A VPC it merely reused isn't included.
+func (s *Stack) CreatedVpcID() (vpcID string) {
+	vpcID = s.createdVpcID
+
+	return vpcID
+}
+
+// DeleteVpc removes a VPC ops created, and everything in it ops created.
+func (s *Stack) DeleteVpc(vpcID string) (err error) {
+	client := ec2.New(s.AwsSession)
+
+	vpcFilter := []*ec2.Filter{
+		{
+			Name:   aws.String("vpc-id"),
+			Values: []*string{aws.String(vpcID)},
+		},
+	}
+
+	fmt.Printf("Deleting VPC %s.\n", vpcID)
+
+	igws, err := client.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("attachment.vpc-id"),
+				Values: []*string{aws.String(vpcID)},
+			},
+		},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing internet gateways of %s", vpcID)
+		return err
+	}
+
+	for _, igw := range igws.InternetGateways {
+		_, err = client.DetachInternetGateway(&ec2.DetachInternetGatewayInput{
+			InternetGatewayId: igw.InternetGatewayId,
+			VpcId:             aws.String(vpcID),
+		})
+		if err != nil {
+			err = errors.Wrapf(err, "failed detaching internet gateway %s", aws.StringValue(igw.InternetGatewayId))
+			return err
+		}
+
+		_, err = client.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: igw.InternetGatewayId})
+		if err != nil {
+			err = errors.Wrapf(err, "failed deleting internet gateway %s", aws.StringValue(igw.InternetGatewayId))
+			return err
+		}
+	}
+
+	subnets, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: vpcFilter})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing subnets of %s", vpcID)
+		return err
+	}
+
+	for _, sn := range subnets.Subnets {
+		_, err = client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: sn.SubnetId})
+		if err != nil {
+			err = errors.Wrapf(err, "failed deleting subnet %s", aws.StringValue(sn.SubnetId))
+			return err
+		}
+	}
+
+	routeTables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: vpcFilter})
+	if err != nil {
+		err = errors.Wrapf(err, "failed describing route tables of %s", vpcID)
+		return err
+	}
+
+	for _, rt := range routeTables.RouteTables {
+		main := false
+		for _, a := range rt.Associations {
+			if aws.BoolValue(a.Main) {
+				main = true
+			}
+		}
+
+		// the main route table goes with the VPC.
+		if main {
+			continue
+		}
+
+		_, err = client.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: rt.RouteTableId})
+		if err != nil {
+			err = errors.Wrapf(err, "failed deleting route table %s", aws.StringValue(rt.RouteTableId))
+			return err
+		}
+	}
+
+	_, err = client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)})
+	if err != nil {
+		err = errors.Wrapf(err, "failed deleting VPC %s", vpcID)
+		return err
+	}
+
+	return err
+}
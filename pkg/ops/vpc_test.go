@@ -0,0 +1,91 @@
+package ops
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestVpcCidrCandidates(t *testing.T) {
+	cidrs := VpcCidrCandidates()
+
+	assert.Equal(t, 256+16+1, len(cidrs), "candidate count doesn't meet expectations")
+	assert.Equal(t, "10.0.0.0/16", cidrs[0], "first candidate doesn't meet expectations")
+	assert.Equal(t, "172.16.0.0/16", cidrs[256], "first 172 candidate doesn't meet expectations")
+	assert.Equal(t, "192.168.0.0/16", cidrs[len(cidrs)-1], "last candidate doesn't meet expectations")
+}
+
+func TestCidrsOverlap(t *testing.T) {
+	cases := []struct {
+		a       string
+		b       string
+		overlap bool
+	}{
+		{"10.0.0.0/16", "10.0.5.0/24", true},
+		{"10.0.5.0/24", "10.0.0.0/16", true},
+		{"10.0.0.0/8", "10.1.0.0/16", true},
+		{"10.0.0.0/16", "10.1.0.0/16", false},
+		{"172.31.0.0/16", "10.0.0.0/16", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			_, a, _ := net.ParseCIDR(tc.a)
+			_, b, _ := net.ParseCIDR(tc.b)
+			assert.Equal(t, tc.overlap, CidrsOverlap(a, b), "overlap doesn't meet expectations")
+		})
+	}
+}
+
+func TestChooseVpcCidr(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing []string
+		cidr     string
+		err      bool
+	}{
+		{"empty account", []string{}, "10.0.0.0/16", false},
+		{"default vpc", []string{"172.31.0.0/16"}, "10.0.0.0/16", false},
+		{"overlapping subnets", []string{"10.0.128.0/20", "10.1.0.0/16", "10.2.3.0/24"}, "10.3.0.0/16", false},
+		{"all of 10", []string{"10.0.0.0/8"}, "172.16.0.0/16", false},
+		{"all private space", []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}, "", true},
+		{"bad cidr", []string{"10.0.0.0"}, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cidr, err := ChooseVpcCidr(tc.existing)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.cidr, cidr, "cidr doesn't meet expectations")
+		})
+	}
+}
+
+func TestSubnetCidr(t *testing.T) {
+	cidr, err := SubnetCidr("10.3.0.0/16")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.3.0.0/24", cidr, "subnet cidr doesn't meet expectations")
+
+	_, err = SubnetCidr("nope")
+	assert.Error(t, err, "expected an error")
+}
+
+func TestValidateNetworkMode(t *testing.T) {
+	assert.NoError(t, ValidateNetworkMode(""), "unset is fine")
+	assert.NoError(t, ValidateNetworkMode(NETWORK_MODE_EXISTING))
+	assert.NoError(t, ValidateNetworkMode(NETWORK_MODE_CREATE))
+	assert.Error(t, ValidateNetworkMode("shared"), "expected an error")
+}
+
+func TestMissingFieldsNetworkMode(t *testing.T) {
+	config := StackConfig{}
+	assert.Contains(t, config.MissingFields(), "subnet_ids", "existing mode needs subnets")
+
+	config.NetworkMode = NETWORK_MODE_CREATE
+	assert.NotContains(t, config.MissingFields(), "subnet_ids", "create mode doesn't need subnets")
+}
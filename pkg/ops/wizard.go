@@ -0,0 +1,358 @@
+package ops
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DEFAULT_AMI_NAME Default AMI name pattern offered by the config wizard.
+const DEFAULT_AMI_NAME = "orion-base*"
+
+// DEFAULT_CONFIG_TEMPLATE_URL Default kots config template offered by the config wizard.
+const DEFAULT_CONFIG_TEMPLATE_URL = "https://orion-ptt-system-templates.s3.us-east-1.amazonaws.com/orion-ptt-system.tmpl"
+
+// DEFAULT_KOTSADM_PASSWORD_REF Default kotsadm password offered by the config wizard: a reference to an SSM parameter, so the password itself isn't stored in the config file.
+const DEFAULT_KOTSADM_PASSWORD_REF = "ssm:/orion/kotsadm-password"
+
+// WizardStep  A single question asked by the config wizard.
+type WizardStep struct {
+	Key      string                               // config key the answer is stored under
+	Question string                               // what we ask
+	Default  string                               // used if the answer is empty
+	Choices  func() (choices []Choice, err error) // optional menu.  If it fails, a free text answer is asked for instead.
+	Multi    bool                                 // the answer is a list
+	Validate func(answer string) (err error)      // optional.  A failed answer is asked for again.
+	Secret   bool                                 // the answer is read without echo, and registered for redaction unless it's a secret reference
+	Warning  func(answer string) (warning string) // optional.  If it returns a warning, the answer has to be confirmed, or is asked for again.
+}
+
+// Prompter  Asks questions on In, and writes to Out.
+type Prompter struct {
+	In       *bufio.Reader
+	Out      io.Writer
+	Terminal *os.File // In, if it's a terminal.  Secret answers are read from it without echo.
+}
+
+// NewPrompter creates a Prompter reading answers from in.
+func NewPrompter(in io.Reader, out io.Writer) (p *Prompter) {
+	p = &Prompter{
+		In:  bufio.NewReader(in),
+		Out: out,
+	}
+
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		p.Terminal = f
+	}
+
+	return p
+}
+
+// Ask asks a question, returning the trimmed answer, or def if the answer is empty.
+func (p *Prompter) Ask(question string, def string) (answer string, err error) {
+	if NonInteractive {
+		err = errors.New("refusing to prompt in non-interactive mode")
+		return answer, err
+	}
+
+	if def != "" {
+		_, _ = fmt.Fprintf(p.Out, "%s [%s]: ", question, def)
+	} else {
+		_, _ = fmt.Fprintf(p.Out, "%s: ", question)
+	}
+
+	input, err := p.In.ReadString('\n')
+	if err != nil && !(err == io.EOF && input != "") {
+		err = errors.Wrapf(err, "failed reading answer to %q", question)
+		return answer, err
+	}
+
+	err = nil
+
+	answer = strings.TrimSpace(input)
+	if answer == "" {
+		answer = def
+	}
+
+	return answer, err
+}
+
+// AskSecret asks a question like Ask, but reads the answer without echo when In is a terminal.
+func (p *Prompter) AskSecret(question string, def string) (answer string, err error) {
+	if p.Terminal == nil {
+		answer, err = p.Ask(question, def)
+		return answer, err
+	}
+
+	if NonInteractive {
+		err = errors.New("refusing to prompt in non-interactive mode")
+		return answer, err
+	}
+
+	if def != "" {
+		_, _ = fmt.Fprintf(p.Out, "%s [%s]: ", question, def)
+	} else {
+		_, _ = fmt.Fprintf(p.Out, "%s: ", question)
+	}
+
+	input, err := term.ReadPassword(int(p.Terminal.Fd()))
+	_, _ = fmt.Fprintf(p.Out, "\n")
+	if err != nil {
+		err = errors.Wrapf(err, "failed reading answer to %q", question)
+		return answer, err
+	}
+
+	answer = strings.TrimSpace(string(input))
+	if answer == "" {
+		answer = def
+	}
+
+	return answer, err
+}
+
+// Confirm asks a yes/no question.  Anything but an answer starting with 'y' is a no.
+func (p *Prompter) Confirm(question string) (yes bool, err error) {
+	answer, err := p.Ask(fmt.Sprintf("%s (y/N)", question), "")
+	if err != nil {
+		return yes, err
+	}
+
+	yes = strings.HasPrefix(strings.ToLower(answer), "y")
+
+	return yes, err
+}
+
+// PrintChoices prints a numbered menu of choices.
+func (p *Prompter) PrintChoices(choices []Choice) {
+	_, _ = fmt.Fprintf(p.Out, "\n")
+	for i, c := range choices {
+		_, _ = fmt.Fprintf(p.Out, "  %2d) %s\n", i+1, c.Label)
+	}
+}
+
+// ParseChoices turns an answer to a menu into values.  Each comma separated item is either a menu number, or a value typed in full.
+func ParseChoices(answer string, choices []Choice, multi bool) (values []string, err error) {
+	values = make([]string, 0)
+
+	for _, item := range strings.Split(answer, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if n, e := strconv.Atoi(item); e == nil {
+			if n < 1 || n > len(choices) {
+				err = errors.New(fmt.Sprintf("%d is not a choice between 1 and %d", n, len(choices)))
+				return values, err
+			}
+
+			item = choices[n-1].Value
+		}
+
+		values = append(values, item)
+	}
+
+	if len(values) == 0 {
+		err = errors.New("an answer is required")
+		return values, err
+	}
+
+	if !multi && len(values) > 1 {
+		err = errors.New("only one answer is allowed")
+		return values, err
+	}
+
+	return values, err
+}
+
+// Run asks every step in turn, re-asking any answer that fails validation.  Returns the answers keyed by config key, ready to be stored as a config file profile.
+func (p *Prompter) Run(steps []WizardStep) (values map[string]interface{}, err error) {
+	values = make(map[string]interface{})
+
+	for _, step := range steps {
+		var choices []Choice
+
+		if step.Choices != nil {
+			c, e := step.Choices()
+			if e != nil {
+				_, _ = fmt.Fprintf(p.Out, "\nCan't list choices for %s: %s\n", step.Key, e)
+			}
+
+			choices = c
+		}
+
+		if len(choices) > 0 {
+			p.PrintChoices(choices)
+		}
+
+		for {
+			ask := p.Ask
+			if step.Secret {
+				ask = p.AskSecret
+			}
+
+			answer, err := ask(step.Question, step.Default)
+			if err != nil {
+				// EOF, or non-interactive mode.  Asking again won't help.
+				return values, err
+			}
+
+			answers, err := ParseChoices(answer, choices, step.Multi)
+			if err == nil && step.Validate != nil {
+				for _, a := range answers {
+					err = step.Validate(a)
+					if err != nil {
+						break
+					}
+				}
+			}
+
+			if err != nil {
+				_, _ = fmt.Fprintf(p.Out, "  %s\n", Redact(err.Error()))
+				continue
+			}
+
+			// a reference isn't secret, and is worth seeing.
+			if step.Secret {
+				for _, a := range answers {
+					if !IsSecretReference(a) {
+						RegisterConfiguredSecret(a)
+					}
+				}
+			}
+
+			if step.Warning != nil {
+				warning := step.Warning(answers[0])
+				if warning != "" {
+					_, _ = fmt.Fprintf(p.Out, "  %s\n", warning)
+
+					ok, err := p.Confirm("Use it anyway?")
+					if err != nil {
+						return values, err
+					}
+
+					if !ok {
+						continue
+					}
+				}
+			}
+
+			if step.Multi {
+				values[step.Key] = answers
+			} else {
+				values[step.Key] = answers[0]
+			}
+
+			break
+		}
+	}
+
+	return values, err
+}
+
+// ConfigWizardSteps  The questions asked by 'ops config init'.  Choices are discovered from the AWS account, and answers are checked against it.
+func (s *Stack) ConfigWizardSteps() (steps []WizardStep) {
+	steps = []WizardStep{
+		{
+			Key:      "stack_name",
+			Question: "Stack name",
+		},
+		{
+			Key:      "key_name",
+			Question: "EC2 key pair for ssh access",
+			Choices:  s.ListKeyPairs,
+			Validate: func(answer string) (err error) {
+				s.Config.KeyName = answer
+				return s.CheckKeyPair()
+			},
+		},
+		{
+			Key:      "user_name",
+			Question: "User name for ssh access to the instance",
+		},
+		{
+			Key:      "dns_domain",
+			Question: "DNS domain (must be served by a Route53 hosted zone)",
+			Choices:  s.ListHostedZones,
+			Validate: func(answer string) (err error) {
+				s.Config.DNSDomain = answer
+				_, err = s.LookupZoneID()
+				return err
+			},
+		},
+		{
+			Key:      "subnet_ids",
+			Question: "Subnets the stack may be created in (comma separated)",
+			Choices:  s.ListSubnets,
+			Multi:    true,
+		},
+		{
+			Key:      "instance_type",
+			Question: "EC2 instance type",
+			Default:  DEFAULT_INSTANCE_TYPE,
+			Validate: func(answer string) (err error) {
+				s.Config.InstanceType = answer
+				return s.CheckInstanceType()
+			},
+		},
+		{
+			Key:      "ami_name",
+			Question: "Base AMI.  Pick an image, or enter a name pattern to always use the latest match",
+			Default:  DEFAULT_AMI_NAME,
+			Choices: func() (choices []Choice, err error) {
+				return s.ListAmis(DEFAULT_AMI_NAME)
+			},
+			Validate: func(answer string) (err error) {
+				s.Config.AMIName = answer
+				_, err = s.CheckAmi()
+				return err
+			},
+		},
+		{
+			Key:      "license_file",
+			Question: "Path to the Orion PTT System license file",
+			Validate: func(answer string) (err error) {
+				license, err := LoadLicense(answer)
+				if err != nil {
+					return err
+				}
+
+				return license.Validate(KOTS_APP_SLUG, time.Now())
+			},
+		},
+		{
+			Key:      "config_template",
+			Question: "Path, S3 or git url of the kots config template",
+			Default:  DEFAULT_CONFIG_TEMPLATE_URL,
+		},
+		{
+			Key:      "kotsadm_password",
+			Question: "Secret reference to the kotsadm console password, e.g. ssm:/orion/kotsadm-password or secretsmanager:orion/kotsadm.  A password entered here is stored as is",
+			Default:  DEFAULT_KOTSADM_PASSWORD_REF,
+			Secret:   true,
+			Validate: func(answer string) (err error) {
+				resolver := NewSecretResolver(s.AwsSession)
+				resolver.Region = s.Config.Region
+
+				_, err = resolver.Resolve(answer)
+				return err
+			},
+			Warning: func(answer string) (warning string) {
+				if IsSecretReference(answer) {
+					return warning
+				}
+
+				warning = "That's not a secret reference.  The password will be stored in plain text in your config file."
+				return warning
+			},
+		},
+	}
+
+	return steps
+}
@@ -0,0 +1,143 @@
+package ops
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseChoices(t *testing.T) {
+	choices := []Choice{
+		{Value: "subnet-1", Label: "subnet-1 vpc-1"},
+		{Value: "subnet-2", Label: "subnet-2 vpc-1"},
+	}
+
+	cases := []struct {
+		name     string
+		answer   string
+		multi    bool
+		expected []string
+		err      bool
+	}{
+		{"number", "2", false, []string{"subnet-2"}, false},
+		{"value", "subnet-9", false, []string{"subnet-9"}, false},
+		{"multi", "1, 2", true, []string{"subnet-1", "subnet-2"}, false},
+		{"too many", "1,2", false, nil, true},
+		{"out of range", "3", false, nil, true},
+		{"empty", " ", false, nil, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			values, err := ParseChoices(tc.answer, choices, tc.multi)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, values, "choices don't meet expectations")
+		})
+	}
+}
+
+func TestPrompterRun(t *testing.T) {
+	steps := []WizardStep{
+		{
+			Key:      "key_name",
+			Question: "Key",
+			Choices: func() (choices []Choice, err error) {
+				choices = []Choice{{Value: "nik", Label: "nik"}, {Value: "ops", Label: "ops"}}
+				return choices, err
+			},
+			Validate: func(answer string) (err error) {
+				if answer != "ops" {
+					err = errors.New("no such key")
+				}
+				return err
+			},
+		},
+		{
+			Key:      "instance_type",
+			Question: "Instance type",
+			Default:  DEFAULT_INSTANCE_TYPE,
+		},
+		{
+			Key:      "subnet_ids",
+			Question: "Subnets",
+			Choices: func() (choices []Choice, err error) {
+				err = errors.New("access denied")
+				return choices, err
+			},
+			Multi: true,
+		},
+	}
+
+	out := &bytes.Buffer{}
+	p := NewPrompter(strings.NewReader("1\n2\n\nsubnet-1,subnet-2\n"), out)
+
+	values, err := p.Run(steps)
+	if err != nil {
+		t.Errorf("wizard failed: %s", err)
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"key_name":      "ops",
+		"instance_type": DEFAULT_INSTANCE_TYPE,
+		"subnet_ids":    []string{"subnet-1", "subnet-2"},
+	}, values, "answers don't meet expectations")
+	assert.Contains(t, out.String(), "no such key", "validation failure not reported")
+	assert.Contains(t, out.String(), "access denied", "choice failure not reported")
+
+	_, err = NewPrompter(strings.NewReader(""), out).Run(steps)
+	assert.Error(t, err, "expected EOF to end the wizard")
+}
+
+func TestPrompterRunSecret(t *testing.T) {
+	clearSecrets(t)
+
+	steps := []WizardStep{
+		{
+			Key:      "kotsadm_password",
+			Question: "Password",
+			Default:  "env:OPS_TEST_PASSWORD",
+			Secret:   true,
+			Warning: func(answer string) (warning string) {
+				if !IsSecretReference(answer) {
+					warning = "stored in plain text"
+				}
+				return warning
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		input    string
+		expected string
+		warned   bool
+	}{
+		{"default reference", "\n", "env:OPS_TEST_PASSWORD", false},
+		{"literal refused", "hunter22\nn\nenv:OTHER\n", "env:OTHER", true},
+		{"literal confirmed", "hunter23\ny\n", "hunter23", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+
+			values, err := NewPrompter(strings.NewReader(tc.input), out).Run(steps)
+			if err != nil {
+				t.Fatalf("wizard failed: %s", err)
+			}
+
+			assert.Equal(t, tc.expected, values["kotsadm_password"], "answer doesn't meet expectations")
+			assert.Equal(t, tc.warned, strings.Contains(out.String(), "stored in plain text"), "warning doesn't meet expectations")
+		})
+	}
+
+	assert.Equal(t, REDACTED_MASK, Redact("hunter23"), "confirmed literal not registered for redaction")
+	assert.Equal(t, "env:OTHER", Redact("env:OTHER"), "references shouldn't be redacted")
+}
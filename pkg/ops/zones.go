@@ -0,0 +1,101 @@
+package ops
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// HostedZone  The parts of a Route53 hosted zone that matter when choosing one.
+type HostedZone struct {
+	ID      string
+	Name    string // without the trailing dot
+	Private bool
+}
+
+// NewHostedZone converts a Route53 hosted zone.
+func NewHostedZone(z *route53.HostedZone) (zone HostedZone) {
+	zone = HostedZone{
+		ID:   strings.TrimPrefix(aws.StringValue(z.Id), "/hostedzone/"),
+		Name: strings.ToLower(strings.TrimSuffix(aws.StringValue(z.Name), ".")),
+	}
+
+	if z.Config != nil {
+		zone.Private = aws.BoolValue(z.Config.PrivateZone)
+	}
+
+	return zone
+}
+
+// Contains returns true if domain is the zone's own name, or any name under it.
+func (z HostedZone) Contains(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	return domain == z.Name || strings.HasSuffix(domain, fmt.Sprintf(".%s", z.Name))
+}
+
+// SelectZone chooses the hosted zone serving domain: the zone with the longest name containing it, so dev.team.example.com is served by team.example.com in preference to example.com.  Public zones win over private ones, whose records the internet can't resolve.  A private zone is only chosen if no public zone matches.  Ties are broken by zone ID.
+func SelectZone(zones []HostedZone, domain string) (zone HostedZone, err error) {
+	found := false
+
+	for _, z := range zones {
+		if !z.Contains(domain) {
+			continue
+		}
+
+		better := !found ||
+			(zone.Private && !z.Private) ||
+			(zone.Private == z.Private && len(z.Name) > len(zone.Name)) ||
+			(zone.Private == z.Private && len(z.Name) == len(zone.Name) && z.ID < zone.ID)
+
+		if better {
+			zone = z
+			found = true
+		}
+	}
+
+	if !found {
+		err = errors.New(fmt.Sprintf("no hosted zone found for %s", domain))
+		return zone, err
+	}
+
+	return zone, err
+}
+
+// DescribeHostedZones lists every hosted zone in the account.
+func (s *Stack) DescribeHostedZones() (zones []HostedZone, err error) {
+	zones = make([]HostedZone, 0)
+
+	client := route53.New(s.AwsSession)
+
+	err = client.ListHostedZonesPages(&route53.ListHostedZonesInput{}, func(page *route53.ListHostedZonesOutput, lastPage bool) bool {
+		for _, z := range page.HostedZones {
+			zones = append(zones, NewHostedZone(z))
+		}
+
+		return true
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed to list hosted zones")
+		return zones, err
+	}
+
+	return zones, err
+}
+
+// DescribeHostedZone describes a single hosted zone by ID.
+func (s *Stack) DescribeHostedZone(id string) (zone HostedZone, err error) {
+	client := route53.New(s.AwsSession)
+
+	output, err := client.GetHostedZone(&route53.GetHostedZoneInput{Id: aws.String(id)})
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting hosted zone %s", id)
+		return zone, err
+	}
+
+	zone = NewHostedZone(output.HostedZone)
+
+	return zone, err
+}
@@ -0,0 +1,67 @@
+package ops
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testZones = []HostedZone{
+	{ID: "Z1", Name: "example.com"},
+	{ID: "Z2", Name: "team.example.com"},
+	{ID: "Z3", Name: "team.example.com", Private: true},
+	{ID: "Z4", Name: "internal.example.com", Private: true},
+	{ID: "Z5", Name: "ample.com"},
+	{ID: "Z0", Name: "example.com"},
+}
+
+func TestNewHostedZone(t *testing.T) {
+	zone := NewHostedZone(&route53.HostedZone{
+		Id:     aws.String("/hostedzone/Z123"),
+		Name:   aws.String("Example.com."),
+		Config: &route53.HostedZoneConfig{PrivateZone: aws.Bool(true)},
+	})
+
+	assert.Equal(t, HostedZone{ID: "Z123", Name: "example.com", Private: true}, zone, "zone doesn't meet expectations")
+}
+
+func TestSelectZone(t *testing.T) {
+	cases := []struct {
+		name   string
+		domain string
+		zone   string
+		err    bool
+	}{
+		{"exact", "example.com", "Z0", false},
+		{"exact public over private", "team.example.com", "Z2", false},
+		{"longest parent", "dev.team.example.com", "Z2", false},
+		{"parent", "dev.example.com", "Z0", false},
+		{"public parent over private exact", "internal.example.com", "Z0", false},
+		{"trailing dot and case", "Dev.Team.Example.com.", "Z2", false},
+		{"not a label boundary", "xample.com", "", true},
+		{"no zone", "example.org", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			zone, err := SelectZone(testZones, tc.domain)
+			if tc.err {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.zone, zone.ID, "zone doesn't meet expectations")
+		})
+	}
+
+	private := []HostedZone{
+		{ID: "Z4", Name: "internal.example.com", Private: true},
+		{ID: "Z6", Name: "example.com", Private: true},
+	}
+
+	zone, err := SelectZone(private, "db.internal.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "Z4", zone.ID, "longest private zone should be used when no public zone matches")
+}